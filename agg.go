@@ -0,0 +1,625 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+)
+
+type (
+	GroupBy    string
+	Aggregates string
+)
+
+func printAgg(ctx run.Context, format DataFormat, expr Filter, aggs Aggregates, by GroupBy, files []string, typer *schemata, in *inputs) error {
+	files, err := expandFiles(files)
+	if err != nil {
+		return err
+	}
+	return withWriter(format, ctx.Stdout, func(write WriteFunc) error {
+		var ag *aggregation
+		var first string // the file ag was made for
+		err := eachFile(files, func(name string) error {
+			if partitionPrune(expr, typer, name) == matchNone {
+				return nil
+			}
+			return in.withFile(name, func(pf *parquet.File) error {
+				rowType, fill := typer.PartitionedTagged(typer.LogicalTagged(pf.Schema()), name)
+				if ag == nil {
+					var err error
+					ag, err = ParseAggregation(aggs, by, rowType, pf.Schema())
+					if err != nil {
+						return err
+					}
+					first = name
+				} else if ag.source != rowType {
+					return fmt.Errorf("%s: schema differs from %s", name, first)
+				}
+				write, err := filterWrite(expr, rowType, ag.Write)
+				if err != nil {
+					return err
+				}
+				return eachRow(pf, rowSelection{}, rowType, fill.Write(write))
+			})
+		})
+		if err != nil || ag == nil {
+			return err
+		}
+		return ag.Flush(write)
+	})
+}
+
+var (
+	aggParserOnce sync.Once
+	aggParser     *participle.Parser[aggTerms]
+)
+
+type aggTerms struct {
+	Terms []aggTerm `parser:"@@ ( ',' @@ )*"`
+}
+
+type aggTerm struct {
+	Func string `parser:"( @Ident '('"`
+	Arg  string `parser:"  ( @Ident ( @'.' @Ident )* )? ')'"`
+	Path string `parser:"| @Ident ( @'.' @Ident )* )"`
+	Name string `parser:"( As @Ident )?"`
+}
+
+func (t aggTerm) String() string {
+	if t.Func != "" {
+		return t.Func + "(" + t.Arg + ")"
+	}
+	return t.Path
+}
+
+// defaultName names a column after its function and the last part of its source.
+func (t aggTerm) defaultName() string {
+	switch {
+	case t.Name != "":
+		return t.Name
+	case t.Func == "":
+		return reLastDot(t.Path)
+	case t.Arg == "":
+		return t.Func
+	}
+	return t.Func + "_" + reLastDot(t.Arg)
+}
+
+func parseAggTerms(what, terms string) ([]aggTerm, error) {
+	aggParserOnce.Do(func() {
+		aggParser = participle.MustBuild[aggTerms](
+			participle.Lexer(lexer.MustSimple([]lexer.SimpleRule{
+				{Name: "As", Pattern: `[Aa][Ss]\b`},
+				{Name: "Ident", Pattern: `[a-zA-Z_][a-zA-Z0-9_]*`},
+				{Name: "Punct", Pattern: `[(),.]`},
+				{Name: "whitespace", Pattern: `[ \t]+`},
+			})),
+			participle.UseLookahead(2),
+		)
+	})
+	parsed, err := aggParser.ParseString(what, terms)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Terms, nil
+}
+
+// aggregation groups rows by key columns and accumulates aggregate columns
+// for each group. Groups are written in the order they are first seen.
+type aggregation struct {
+	source reflect.Type
+	keys   []aggKey
+	aggs   []aggColumn
+	row    reflect.Type
+	groups map[string]*aggGroup
+	order  []*aggGroup
+}
+
+type aggKey struct {
+	source string
+	typ    reflect.Type
+	eval   func(reflect.Value) reflect.Value
+}
+
+type aggColumn struct {
+	source string
+	typ    reflect.Type
+	new    func() aggregator
+}
+
+type aggGroup struct {
+	keys []reflect.Value
+	aggs []aggregator
+}
+
+type aggregator interface {
+	add(reflect.Value) error
+	value() reflect.Value
+}
+
+// ParseAggregation compiles aggregate and group by expressions for rows of
+// type t read from schema.
+func ParseAggregation(aggs Aggregates, by GroupBy, t reflect.Type, schema *parquet.Schema) (*aggregation, error) {
+	ag := &aggregation{source: t, groups: map[string]*aggGroup{}}
+	var fields []reflect.StructField
+	if by != "" {
+		terms, err := parseAggTerms("by", string(by))
+		if err != nil {
+			return nil, err
+		}
+		for _, term := range terms {
+			key, err := groupKey(term, t)
+			if err != nil {
+				return nil, fmt.Errorf("by %s: %w", term, err)
+			}
+			ag.keys = append(ag.keys, key)
+			fields = append(fields, aggField(term.defaultName(), key.typ))
+		}
+	}
+	terms, err := parseAggTerms("aggregates", string(aggs))
+	if err != nil {
+		return nil, err
+	}
+	for _, term := range terms {
+		col, err := aggregate(term, t, schema)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", term, err)
+		}
+		ag.aggs = append(ag.aggs, col)
+		fields = append(fields, aggField(term.defaultName(), col.typ))
+	}
+	ag.row = reflect.StructOf(fields)
+	return ag, nil
+}
+
+func aggField(name string, t reflect.Type) reflect.StructField {
+	sf := reflect.StructField{Name: name, Type: t}
+	if title := strings.ToUpper(name[:1]) + name[1:]; title != name {
+		sf.Name = title
+		sf.Tag = reflect.StructTag(`parquet:"` + name + `" json:"` + name + `"`)
+	}
+	return sf
+}
+
+func groupKey(term aggTerm, t reflect.Type) (aggKey, error) {
+	source := term.Path
+	if term.Func != "" {
+		source = term.Arg
+	}
+	ft, ok := reLookupType(t, source)
+	if !ok {
+		return aggKey{}, fmt.Errorf("unknown field %q", source)
+	}
+	key := aggKey{source: source, typ: ft, eval: func(v reflect.Value) reflect.Value { return v }}
+	if term.Func == "" {
+		return key, nil
+	}
+
+	et := ft
+	if et.Kind() == reflect.Pointer {
+		et = et.Elem()
+	}
+	if !et.Implements(reflect.TypeFor[epochUnit]()) {
+		return key, fmt.Errorf("%s requires a date, time or timestamp, not %s", term.Func, et)
+	}
+	part, typ := timePart(term.Func)
+	if part == nil {
+		return key, fmt.Errorf("unknown function %q", term.Func)
+	}
+	key.typ = optionalOf(ft, typ)
+	key.eval = func(v reflect.Value) reflect.Value {
+		t, ok := timeOf(v)
+		return valueAs(key.typ, reflect.ValueOf(part(t)), ok)
+	}
+	return key, nil
+}
+
+func timePart(name string) (func(time.Time) int64, reflect.Type) {
+	i64 := reflect.TypeFor[int64]()
+	switch name {
+	case "year":
+		return func(t time.Time) int64 { return int64(t.Year()) }, i64
+	case "month":
+		return func(t time.Time) int64 { return int64(t.Month()) }, i64
+	case "day":
+		return func(t time.Time) int64 { return int64(t.Day()) }, i64
+	case "hour":
+		return func(t time.Time) int64 { return int64(t.Hour()) }, i64
+	case "date":
+		return func(t time.Time) int64 {
+			y, m, d := t.Date()
+			return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+		}, reflect.TypeFor[Date]()
+	}
+	return nil, nil
+}
+
+// epochUnit is implemented by the logical date, time, and timestamp types.
+type epochUnit interface {
+	unit() time.Duration
+	loc() *time.Location
+}
+
+// timeOf returns the time represented by a logical date, time, or timestamp.
+func timeOf(v reflect.Value) (time.Time, bool) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return time.Time{}, false
+		}
+		v = v.Elem()
+	}
+	u, ok := v.Interface().(epochUnit)
+	if !ok {
+		return time.Time{}, false
+	}
+	return epochTime(time.Duration(v.Int()) * u.unit()).In(u.loc()), true
+}
+
+func aggregate(term aggTerm, t reflect.Type, schema *parquet.Schema) (aggColumn, error) {
+	if term.Func == "" {
+		return aggColumn{}, errors.New("expected an aggregate function")
+	}
+	if term.Arg == "" {
+		return aggregateColumn(term.Func, nil, 0, false)
+	}
+	ft, ok := reLookupType(t, term.Arg)
+	if !ok {
+		return aggColumn{}, fmt.Errorf("unknown field %q", term.Arg)
+	}
+	scale, decimal := decimalScale(schema, term.Arg)
+	col, err := aggregateColumn(term.Func, ft, scale, decimal)
+	col.source = term.Arg
+	return col, err
+}
+
+// aggregateColumn creates the aggregate function fn over values of type ft,
+// or over whole rows if ft is nil. Values of decimal columns have the given
+// scale.
+func aggregateColumn(fn string, ft reflect.Type, scale int32, decimal bool) (aggColumn, error) {
+	col := aggColumn{typ: reflect.TypeFor[int64]()}
+	if ft == nil {
+		if fn != "count" {
+			return col, fmt.Errorf("%s requires a field", fn)
+		}
+		col.new = func() aggregator { return &countAgg{all: true} }
+		return col, nil
+	}
+
+	et := ft
+	if et.Kind() == reflect.Pointer {
+		et = et.Elem()
+	}
+	if et == reflect.TypeFor[Decimal]() {
+		decimal = true
+	}
+	numeric := decimal || isNumeric(et)
+	inttime := et.Implements(reflect.TypeFor[epochUnit]())
+
+	switch fn {
+	case "count":
+		col.new = func() aggregator { return &countAgg{} }
+	case "count_distinct":
+		col.new = func() aggregator { return &distinctAgg{seen: map[string]struct{}{}} }
+	case "sum":
+		switch {
+		case decimal:
+			col.typ = reflect.TypeFor[Decimal]()
+			col.new = func() aggregator { return &decimalSumAgg{sum: Decimal{new(big.Int), scale}} }
+		case inttime || !numeric:
+			return col, fmt.Errorf("cannot sum %s", et)
+		case isFloat(et):
+			col.typ = reflect.TypeFor[float64]()
+			col.new = func() aggregator { return &floatAgg{} }
+		default:
+			col.new = func() aggregator { return &intSumAgg{} }
+		}
+	case "avg":
+		switch {
+		case inttime:
+			col.typ = reflect.PointerTo(et)
+		case !numeric:
+			return col, fmt.Errorf("cannot average %s", et)
+		default:
+			col.typ = reflect.TypeFor[*float64]()
+		}
+		col.new = func() aggregator {
+			return &floatAgg{avg: true, typ: col.typ, integral: inttime, decimal: decimal, scale: scale}
+		}
+	case "min", "max":
+		max := fn == "max"
+		col.typ = reflect.PointerTo(et)
+		if decimal {
+			col.typ = reflect.TypeFor[*Decimal]()
+		}
+		col.new = func() aggregator { return &extremeAgg{max: max, typ: col.typ, decimal: decimal, scale: scale} }
+	default:
+		return col, fmt.Errorf("unknown function %q", fn)
+	}
+	return col, nil
+}
+
+// decimalScale returns the scale of a decimal column at the dotted path.
+func decimalScale(schema *parquet.Schema, source string) (int32, bool) {
+	leaf, ok := schema.Lookup(strings.Split(source, ".")...)
+	if !ok {
+		return 0, false
+	}
+	if lt := leaf.Node.Type().LogicalType(); lt != nil && lt.Decimal != nil {
+		return lt.Decimal.Scale, true
+	}
+	return 0, false
+}
+
+func isNumeric(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isFloat(t reflect.Type) bool {
+	k := t.Kind()
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func (ag *aggregation) Write(v reflect.Value) error {
+	keys := make([]reflect.Value, len(ag.keys))
+	var id []byte
+	for i, k := range ag.keys {
+		kv := reflect.New(k.typ).Elem()
+		kv.Set(k.eval(reValueOf(v, k.source)))
+		keys[i] = kv
+		var err error
+		if id, err = appendKey(id, kv); err != nil {
+			return err
+		}
+	}
+
+	g, ok := ag.groups[string(id)]
+	if !ok {
+		g = &aggGroup{keys: keys, aggs: make([]aggregator, len(ag.aggs))}
+		for i, a := range ag.aggs {
+			g.aggs[i] = a.new()
+		}
+		ag.groups[string(id)] = g
+		ag.order = append(ag.order, g)
+	}
+	for i, a := range ag.aggs {
+		if err := g.aggs[i].add(reValueOf(v, a.source)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes one row per group. Without group keys, a single row is
+// written even if there were no rows.
+func (ag *aggregation) Flush(w WriteFunc) error {
+	if len(ag.keys) == 0 && len(ag.order) == 0 {
+		g := &aggGroup{aggs: make([]aggregator, len(ag.aggs))}
+		for i, a := range ag.aggs {
+			g.aggs[i] = a.new()
+		}
+		ag.order = append(ag.order, g)
+	}
+	row := reflect.New(ag.row).Elem()
+	for _, g := range ag.order {
+		for i, k := range g.keys {
+			row.Field(i).Set(k)
+		}
+		for i, a := range g.aggs {
+			row.Field(len(g.keys) + i).Set(a.value())
+		}
+		if err := w(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// optionalOf returns t, or a pointer to t if source is a pointer.
+func optionalOf(source, t reflect.Type) reflect.Type {
+	if source.Kind() == reflect.Pointer {
+		return reflect.PointerTo(t)
+	}
+	return t
+}
+
+// valueAs converts v to typ, which may be a pointer to v's type.
+// If ok is false it returns the zero value of typ.
+func valueAs(typ reflect.Type, v reflect.Value, ok bool) reflect.Value {
+	if !ok {
+		return reflect.Zero(typ)
+	}
+	if typ.Kind() == reflect.Pointer {
+		p := reflect.New(typ.Elem())
+		p.Elem().Set(v.Convert(typ.Elem()))
+		return p
+	}
+	return v.Convert(typ)
+}
+
+// present dereferences v, reporting false for nil and invalid values.
+func present(v reflect.Value) (reflect.Value, bool) {
+	if !v.IsValid() {
+		return v, false
+	}
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false
+		}
+		return v.Elem(), true
+	}
+	return v, true
+}
+
+type countAgg struct {
+	all bool
+	n   int64
+}
+
+func (a *countAgg) add(v reflect.Value) error {
+	if _, ok := present(v); ok || a.all {
+		a.n++
+	}
+	return nil
+}
+
+func (a *countAgg) value() reflect.Value { return reflect.ValueOf(a.n) }
+
+type distinctAgg struct {
+	seen map[string]struct{}
+}
+
+func (a *distinctAgg) add(v reflect.Value) error {
+	if v, ok := present(v); ok {
+		b, err := appendKey(nil, v)
+		if err != nil {
+			return err
+		}
+		a.seen[string(b)] = struct{}{}
+	}
+	return nil
+}
+
+func (a *distinctAgg) value() reflect.Value { return reflect.ValueOf(int64(len(a.seen))) }
+
+type intSumAgg struct {
+	sum int64
+}
+
+func (a *intSumAgg) add(v reflect.Value) error {
+	if v, ok := present(v); ok {
+		if v.CanInt() {
+			a.sum += v.Int()
+		} else {
+			a.sum += int64(v.Uint())
+		}
+	}
+	return nil
+}
+
+func (a *intSumAgg) value() reflect.Value { return reflect.ValueOf(a.sum) }
+
+type decimalSumAgg struct {
+	sum Decimal
+}
+
+func (a *decimalSumAgg) add(v reflect.Value) error {
+	if v, ok := present(v); ok {
+		d, err := decimalOf(v, a.sum.Scale)
+		if err != nil {
+			return err
+		}
+		// Decimals computed by SQL may have more digits than the sum so far.
+		switch {
+		case d.Scale > a.sum.Scale:
+			a.sum = a.sum.rescale(d.Scale)
+		case d.Scale < a.sum.Scale:
+			d = d.rescale(a.sum.Scale)
+		}
+		a.sum.Unscaled.Add(a.sum.Unscaled, d.Unscaled)
+	}
+	return nil
+}
+
+func (a *decimalSumAgg) value() reflect.Value { return reflect.ValueOf(a.sum) }
+
+// floatAgg sums or averages values as float64. Averages are converted to
+// typ, which for logical times is a pointer to the type being averaged, and
+// nil without values. Logical times are summed exactly, as big integers.
+type floatAgg struct {
+	avg      bool
+	typ      reflect.Type
+	integral bool
+	decimal  bool
+	scale    int32
+	sum      float64
+	isum     big.Int
+	n        int64
+}
+
+func (a *floatAgg) add(v reflect.Value) error {
+	v, ok := present(v)
+	if !ok {
+		return nil
+	}
+	a.n++
+	switch {
+	case a.decimal:
+		d, err := decimalOf(v, a.scale)
+		if err != nil {
+			return err
+		}
+		a.sum += d.Float64()
+	case a.integral:
+		a.isum.Add(&a.isum, big.NewInt(v.Int()))
+	case v.CanInt():
+		a.sum += float64(v.Int())
+	case v.CanUint():
+		a.sum += float64(v.Uint())
+	case v.CanFloat():
+		a.sum += v.Float()
+	}
+	return nil
+}
+
+func (a *floatAgg) value() reflect.Value {
+	if !a.avg {
+		return reflect.ValueOf(a.sum)
+	}
+	if a.n == 0 {
+		return reflect.Zero(a.typ)
+	}
+	if a.integral {
+		avg := new(big.Int).Quo(&a.isum, big.NewInt(a.n))
+		return valueAs(a.typ, reflect.ValueOf(avg.Int64()), true)
+	}
+	return valueAs(a.typ, reflect.ValueOf(a.sum/float64(a.n)), true)
+}
+
+type extremeAgg struct {
+	max     bool
+	typ     reflect.Type
+	decimal bool
+	scale   int32
+	best    reflect.Value
+}
+
+func (a *extremeAgg) add(v reflect.Value) error {
+	v, ok := present(v)
+	if !ok {
+		return nil
+	}
+	if a.decimal {
+		d, err := decimalOf(v, a.scale)
+		if err != nil {
+			return err
+		}
+		if !a.best.IsValid() || d.Cmp(a.best.Interface().(Decimal)) > 0 == a.max {
+			a.best = reflect.ValueOf(d)
+		}
+		return nil
+	}
+	if !a.best.IsValid() || compareValue(v, a.best) > 0 == a.max {
+		a.best = reflect.New(v.Type()).Elem()
+		a.best.Set(v)
+	}
+	return nil
+}
+
+func (a *extremeAgg) value() reflect.Value {
+	return valueAs(a.typ, a.best, a.best.IsValid())
+}
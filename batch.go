@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/parquet-go/parquet-go"
+)
+
+// batchSize is how many rows are read, filtered, reshaped, and written at once.
+const batchSize = 1024
+
+// BatchFunc handles a batch of rows, given as a slice of the row type. The
+// slice is reused for later batches, so it must not be kept after returning.
+type BatchFunc func(rows reflect.Value) error
+
+// Rows returns a BatchFunc that passes each row of a batch to w.
+func (w WriteFunc) Rows() BatchFunc {
+	return func(rows reflect.Value) error {
+		for i := range rows.Len() {
+			if err := w(rows.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// eachBatch reads the rows of file selected by sel into batches of rowType.
+func eachBatch(file parquet.FileView, sel rowSelection, rowType reflect.Type, do BatchFunc) error {
+	rowGroups := file.RowGroups()
+	ranges, err := groupRanges(rowGroups, sel)
+	if err != nil {
+		return err
+	}
+	return readRanges(rowGroups, ranges, rowType, do)
+}
+
+// readRanges reads rows ranges[i] of each of rowGroups into batches of rowType.
+func readRanges(rowGroups []parquet.RowGroup, ranges [][2]int64, rowType reflect.Type, do BatchFunc) error {
+	for i, rg := range rowGroups {
+		if from, to := ranges[i][0], ranges[i][1]; from < to {
+			if err := readBatches(rg, from, to, rowType, do); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readBatches reads rows [from, to) of rg into batches of rowType. Rows are
+// read from the column chunks a batch at a time, converted to the schema of
+// rowType, and reconstructed into a slice that is reused for each batch.
+func readBatches(rg parquet.RowGroup, from, to int64, rowType reflect.Type, do BatchFunc) error {
+	schema := parquet.SchemaOf(reflect.New(rowType).Interface())
+	if !parquet.EqualNodes(schema, rg.Schema()) {
+		conv, err := parquet.Convert(schema, rg.Schema())
+		if err != nil {
+			return fmt.Errorf("cannot read parquet row into go value of type %s: %w", reflect.PointerTo(rowType), err)
+		}
+		rg = parquet.ConvertRowGroup(rg, conv)
+	}
+	rows := rg.Rows()
+	defer rows.Close()
+	if from > 0 {
+		if err := rows.SeekToRow(from); err != nil {
+			return err
+		}
+	}
+
+	// Each row gets a share of one backing array, sized for the usual one
+	// value per column, so ReadRows appends to them without allocating.
+	buf := make([]parquet.Row, min(batchSize, to-from))
+	columns := len(schema.Columns())
+	values := make([]parquet.Value, len(buf)*columns)
+	for i := range buf {
+		buf[i] = values[i*columns : i*columns : (i+1)*columns]
+	}
+	batch := reflect.MakeSlice(reflect.SliceOf(rowType), len(buf), len(buf))
+	for from < to {
+		n, err := rows.ReadRows(buf[:min(int64(len(buf)), to-from)])
+		if n > 0 {
+			// Rows are zeroed first so that none share the previous
+			// batch's slices and maps, which writes may have kept.
+			batch.Clear()
+			for i, row := range buf[:n] {
+				if err := schema.Reconstruct(batch.Index(i).Addr().Interface(), row); err != nil {
+					return err
+				}
+			}
+			from += int64(n)
+			if err := do(batch.Slice(0, n)); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterBatch returns a BatchFunc that passes the rows of each batch matching
+// filter on to w. Matching rows are moved to the front of the batch, so the
+// rows of the batch it is given are not preserved.
+func filterBatch(filter Filter, rowType reflect.Type, w BatchFunc) (BatchFunc, error) {
+	if filter == "" {
+		return w, nil
+	}
+	match, err := expr.Compile(string(filter), filterOptions(rowType)...)
+	if err != nil {
+		return w, err
+	}
+	var machine vm.VM
+	return func(rows reflect.Value) error {
+		n := 0
+		for i := range rows.Len() {
+			row := rows.Index(i)
+			include, err := machine.Run(match, row.Addr().Interface())
+			if err != nil {
+				return err
+			}
+			if include.(bool) {
+				if n != i {
+					rows.Index(n).Set(row)
+				}
+				n++
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		return w(rows.Slice(0, n))
+	}, nil
+}
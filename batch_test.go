@@ -0,0 +1,192 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// openBench opens a parquet file from testdata with its logical row type.
+func openBench(tb testing.TB, name string) (*parquet.File, reflect.Type) {
+	tb.Helper()
+	pf, closer, err := newInputs(nil).openFile("testdata/parquet/" + name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { closer() })
+	return pf, new(schemata).LogicalTagged(pf.Schema())
+}
+
+// eachRowReader reads rows one at a time, as parquet.Reader does.
+func eachRowReader(pf *parquet.File, rowType reflect.Type, do WriteFunc) error {
+	pq := parquet.NewReader(pf)
+	defer pq.Close()
+	v, z := reflect.New(rowType), reflect.Zero(rowType)
+	for {
+		v.Elem().Set(z)
+		if err := pq.Read(v.Interface()); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := do(v.Elem()); err != nil {
+			return err
+		}
+	}
+}
+
+func TestEachBatch(t *testing.T) {
+	for _, name := range []string{"pages.parquet", "sales.parquet", "bloom.parquet", "example.parquet"} {
+		t.Run(name, func(t *testing.T) {
+			pf, rowType := openBench(t, name)
+			var want, got []any
+			if err := eachRowReader(pf, rowType, func(v reflect.Value) error {
+				want = append(want, v.Interface())
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if err := eachBatch(pf, rowSelection{}, rowType, func(rows reflect.Value) error {
+				for i := range rows.Len() {
+					got = append(got, rows.Index(i).Interface())
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %d rows %+v\nwant %d rows %+v", len(got), got, len(want), want)
+			}
+		})
+	}
+}
+
+func TestFilterBatch(t *testing.T) {
+	pf, rowType := openBench(t, "pages.parquet")
+	var want, got []int64
+	keep := func(ids *[]int64) WriteFunc {
+		return func(v reflect.Value) error {
+			*ids = append(*ids, v.FieldByName("Id").Int())
+			return nil
+		}
+	}
+	write, err := filterWrite(`color == "red" && note != nil`, rowType, keep(&want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := eachRowReader(pf, rowType, write); err != nil {
+		t.Fatal(err)
+	}
+	batch, err := filterBatch(`color == "red" && note != nil`, rowType, keep(&got).Rows())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := eachBatch(pf, rowSelection{}, rowType, batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(want) == 0 || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+// The benchmarks below compare reading, filtering, reshaping, and writing
+// a row at a time against doing so a batch at a time.
+
+func BenchmarkRead(b *testing.B) {
+	pf, rowType := openBench(b, "pages.parquet")
+	discard := func(reflect.Value) error { return nil }
+	b.Run("row", func(b *testing.B) {
+		for b.Loop() {
+			if err := eachRowReader(pf, rowType, discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		for b.Loop() {
+			if err := eachBatch(pf, rowSelection{}, rowType, discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkFilter(b *testing.B) {
+	const filter = `color == "red" && note != nil`
+	pf, rowType := openBench(b, "pages.parquet")
+	b.Run("row", func(b *testing.B) {
+		write, err := filterWrite(filter, rowType, func(reflect.Value) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+		for b.Loop() {
+			if err := eachRowReader(pf, rowType, write); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		write, err := filterBatch(filter, rowType, func(reflect.Value) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+		for b.Loop() {
+			if err := eachBatch(pf, rowSelection{}, rowType, write); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkReshape(b *testing.B) {
+	const shape = "code, (id, color) AS key"
+	pf, rowType := openBench(b, "pages.parquet")
+	b.Run("row", func(b *testing.B) {
+		write, err := reshapeWrite(shape, rowType, func(reflect.Value) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+		for b.Loop() {
+			if err := eachRowReader(pf, rowType, write); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		write, err := reshapeBatch(shape, rowType, func(reflect.Value) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+		for b.Loop() {
+			if err := eachBatch(pf, rowSelection{}, rowType, write); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkWrite(b *testing.B) {
+	pf, rowType := openBench(b, "pages.parquet")
+	for _, format := range []DataFormat{"go", "csv", "json", "jsonl", "parquet"} {
+		b.Run(string(format)+"/row", func(b *testing.B) {
+			for b.Loop() {
+				if err := withWriter(format, io.Discard, func(write WriteFunc) error {
+					return eachRowReader(pf, rowType, write)
+				}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(string(format)+"/batch", func(b *testing.B) {
+			for b.Loop() {
+				if err := withBatchWriter(format, io.Discard, func(write BatchFunc) error {
+					return eachBatch(pf, rowSelection{}, rowType, write)
+				}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+)
+
+func printBloom(ctx run.Context, file, column string, values []string, in *inputs) error {
+	return in.withFile(file, func(pf *parquet.File) error {
+		leaf, ok := pf.Schema().Lookup(strings.Split(column, ".")...)
+		if !ok {
+			return fmt.Errorf("%s: unknown column %q", file, column)
+		}
+		typ := leaf.Node.Type()
+		pvs := make([]parquet.Value, len(values))
+		for i, s := range values {
+			pv, err := parseBloomValue(typ, s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", column, err)
+			}
+			pvs[i] = pv
+		}
+
+		var unfiltered []string
+		for i, rg := range pf.RowGroups() {
+			if chunk, ok := rg.ColumnChunks()[leaf.ColumnIndex].(*parquet.FileColumnChunk); !ok || chunk.BloomFilter() == nil {
+				unfiltered = append(unfiltered, strconv.Itoa(i))
+			}
+		}
+		if len(unfiltered) == len(pf.RowGroups()) {
+			return fmt.Errorf("%s: column %s has no bloom filters", file, column)
+		}
+
+		for i, pv := range pvs {
+			var groups []string
+			for j, rg := range pf.RowGroups() {
+				if mayContain(rg, leaf.ColumnIndex, pv) {
+					groups = append(groups, strconv.Itoa(j))
+				}
+			}
+			if len(groups) == 0 {
+				fmt.Fprintf(ctx.Stdout, "%s: no row groups\n", values[i])
+			} else {
+				fmt.Fprintf(ctx.Stdout, "%s: row groups %s\n", values[i], strings.Join(groups, ", "))
+			}
+		}
+		if len(unfiltered) > 0 {
+			fmt.Fprintf(ctx.Stderr, "row groups %s have no bloom filter for %s\n", strings.Join(unfiltered, ", "), column)
+		}
+		return nil
+	})
+}
+
+// mayContain reports whether the bloom filter of column in rg may hold pv.
+// Chunks without a bloom filter may hold anything.
+func mayContain(rg parquet.RowGroup, column int, pv parquet.Value) bool {
+	chunk, ok := rg.ColumnChunks()[column].(*parquet.FileColumnChunk)
+	if !ok {
+		return true
+	}
+	bf := chunk.BloomFilter()
+	if bf == nil {
+		return true
+	}
+	found, err := bf.Check(pv)
+	return found || err != nil
+}
+
+// parseBloomValue parses s as a physical value of typ: the bytes of a string
+// or binary column, or the number or boolean of others.
+func parseBloomValue(typ parquet.Type, s string) (parquet.Value, error) {
+	unsigned := false
+	if lt := typ.LogicalType(); lt != nil && lt.Integer != nil {
+		unsigned = !lt.Integer.IsSigned
+	}
+	switch typ.Kind() {
+	case parquet.Boolean:
+		b, err := strconv.ParseBool(s)
+		return parquet.BooleanValue(b), err
+	case parquet.Int32:
+		if unsigned {
+			n, err := strconv.ParseUint(s, 10, 32)
+			return parquet.Int32Value(int32(uint32(n))), err
+		}
+		n, err := strconv.ParseInt(s, 10, 32)
+		return parquet.Int32Value(int32(n)), err
+	case parquet.Int64:
+		if unsigned {
+			n, err := strconv.ParseUint(s, 10, 64)
+			return parquet.Int64Value(int64(n)), err
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		return parquet.Int64Value(n), err
+	case parquet.Float:
+		f, err := strconv.ParseFloat(s, 32)
+		return parquet.FloatValue(float32(f)), err
+	case parquet.Double:
+		f, err := strconv.ParseFloat(s, 64)
+		return parquet.DoubleValue(f), err
+	case parquet.ByteArray:
+		return parquet.ByteArrayValue([]byte(s)), nil
+	case parquet.FixedLenByteArray:
+		if len(s) != typ.Length() {
+			return parquet.Value{}, fmt.Errorf("%q is not %d bytes", s, typ.Length())
+		}
+		return parquet.FixedLenByteArrayValue([]byte(s)), nil
+	}
+	return parquet.Value{}, fmt.Errorf("bloom filters of %s columns are not supported", typ.Kind())
+}
+
+// physicalValue converts the result of a filter constant to a physical value
+// of typ, for the integer and byte array kinds whose conversion is plain.
+func physicalValue(typ parquet.Type, v any) (parquet.Value, bool) {
+	switch typ.Kind() {
+	case parquet.Int32, parquet.Int64:
+		var n int64
+		switch v := v.(type) {
+		case int:
+			n = int64(v)
+		case int8:
+			n = int64(v)
+		case int16:
+			n = int64(v)
+		case int32:
+			n = int64(v)
+		case int64:
+			n = v
+		case uint:
+			n = int64(v)
+		case uint8:
+			n = int64(v)
+		case uint16:
+			n = int64(v)
+		case uint32:
+			n = int64(v)
+		case uint64:
+			n = int64(v)
+		case float64:
+			if v != math.Trunc(v) || math.Abs(v) >= 1<<63 {
+				return parquet.Value{}, false
+			}
+			n = int64(v)
+		default:
+			return parquet.Value{}, false
+		}
+		if typ.Kind() == parquet.Int64 {
+			return parquet.Int64Value(n), true
+		}
+		// Unsigned 32 bit columns hold values above MaxInt32 as negatives.
+		if n < math.MinInt32 || n > math.MaxUint32 {
+			return parquet.Value{}, false
+		}
+		return parquet.Int32Value(int32(n)), true
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		var b []byte
+		switch v := v.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		default:
+			return parquet.Value{}, false
+		}
+		if typ.Kind() == parquet.ByteArray {
+			return parquet.ByteArrayValue(b), true
+		}
+		if len(b) != typ.Length() {
+			return parquet.Value{}, false
+		}
+		return parquet.FixedLenByteArrayValue(b), true
+	}
+	return parquet.Value{}, false
+}
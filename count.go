@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm"
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+)
+
+func printCount(ctx run.Context, filter Filter, files []string, typer *schemata, in *inputs) error {
+	files, err := expandFiles(files)
+	if err != nil {
+		return err
+	}
+	var total int64
+	err = eachFile(files, func(name string) error {
+		count := func(n int64) (err error) {
+			total += n
+			if len(files) > 1 {
+				_, err = fmt.Fprintln(ctx.Stdout, name+":", n)
+			}
+			return err
+		}
+		if partitionPrune(filter, typer, name) == matchNone {
+			return count(0)
+		}
+		return in.withFile(name, func(pf *parquet.File) error {
+			n, err := countRows(pf, name, filter, typer)
+			if err != nil {
+				return err
+			}
+			return count(n)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if len(files) > 1 {
+		_, err = fmt.Fprintln(ctx.Stdout, "total:", total)
+	} else {
+		_, err = fmt.Fprintln(ctx.Stdout, total)
+	}
+	return err
+}
+
+// countRows counts the rows of pf matching filter. Without a filter, or one
+// decided by the file's partitions, the count comes from the footer. Otherwise
+// row groups are counted or skipped whole when their statistics decide the
+// filter, and only the columns the filter references are read from the rest.
+func countRows(pf *parquet.File, name string, filter Filter, typer *schemata) (int64, error) {
+	if partitionMatch(filter, typer, name, pf.Schema()) == matchAll {
+		return pf.Metadata().NumRows, nil
+	}
+	rowType, fill := typer.PartitionedTagged(typer.LogicalTagged(pf.Schema()), name)
+	prune, err := newGroupPruner(filter, pf.Schema(), rowType)
+	if err != nil {
+		return 0, err
+	}
+	readType, err := filterType(filter, rowType)
+	if err != nil {
+		return 0, err
+	}
+	match, err := expr.Compile(string(filter), filterOptions(readType)...)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for _, rg := range pf.RowGroups() {
+		switch prune(rg) {
+		case matchAll:
+			n += rg.NumRows()
+		case matchSome:
+			c, err := countMatches(rg, readType, fill, match)
+			if err != nil {
+				return 0, err
+			}
+			n += c
+		}
+	}
+	return n, nil
+}
+
+func countMatches(rg parquet.RowGroup, readType reflect.Type, fill partitionFill, match *vm.Program) (int64, error) {
+	pq := parquet.NewRowGroupReader(rg)
+	defer pq.Close()
+
+	var n int64
+	v, z := reflect.New(readType), reflect.Zero(readType)
+	for {
+		v.Elem().Set(z)
+		if err := pq.Read(v.Interface()); err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		if fill != nil {
+			fill(v.Elem())
+		}
+		if include, err := expr.Run(match, v.Elem().Interface()); err != nil {
+			return n, err
+		} else if include.(bool) {
+			n++
+		}
+	}
+}
+
+// filterType projects rowType onto the top level fields referenced by filter,
+// so that reading it decodes only their columns.
+func filterType(filter Filter, rowType reflect.Type) (reflect.Type, error) {
+	tree, err := parser.Parse(string(filter))
+	if err != nil {
+		return nil, err
+	}
+	refs := &identVisitor{names: map[string]bool{}}
+	ast.Walk(&tree.Node, refs)
+
+	var fields []reflect.StructField
+	for i := range rowType.NumField() {
+		if f := rowType.Field(i); refs.names[reFieldName(f)] {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return rowType, nil
+	}
+	return reflect.StructOf(fields), nil
+}
+
+type identVisitor struct{ names map[string]bool }
+
+func (v *identVisitor) Visit(node *ast.Node) {
+	if id, ok := (*node).(*ast.IdentifierNode); ok {
+		v.names[id.Value] = true
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+	"github.com/parquet-go/parquet-go"
+)
+
+// expandFiles replaces directories with the parquet files found beneath them,
+// and globs with the files they match. Hidden files and directories, and those
+// starting with an underscore such as _SUCCESS, are skipped. Other names are
+// kept as they are, so that opening them reports any error.
+func expandFiles(files []string) ([]string, error) {
+	var names []string
+	for _, name := range files {
+		matches := []string{name}
+		if _, err := os.Stat(name); err != nil && strings.ContainsAny(name, "*?[") {
+			if m, err := filepath.Glob(name); err != nil {
+				return nil, err
+			} else if len(m) > 0 {
+				matches = m
+			}
+		}
+		for _, match := range matches {
+			found, err := findParquet(match)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, found...)
+		}
+	}
+	return names, nil
+}
+
+// findParquet returns the *.parquet files beneath root in lexical order, or
+// root itself if it is not a directory.
+func findParquet(root string) ([]string, error) {
+	if stat, err := os.Stat(root); err != nil || !stat.IsDir() {
+		return []string{root}, nil
+	}
+	var names []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case path != root && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_")):
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		case !d.IsDir() && strings.HasSuffix(d.Name(), ".parquet"):
+			names = append(names, path)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// partition is a key=value directory of a hive-style dataset. Value is nil for
+// the default partition, which holds rows whose key was nil.
+type partition struct {
+	Key   string
+	Value *string
+}
+
+// partitionsOf returns the partitions named by the directories of a file.
+func partitionsOf(name string) []partition {
+	var parts []partition
+	seen := map[string]bool{}
+	for dir := range strings.SplitSeq(filepath.ToSlash(filepath.Dir(name)), "/") {
+		key, value, ok := strings.Cut(dir, "=")
+		if !ok || key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		p := partition{Key: key}
+		if value != hiveDefault {
+			if unescaped, err := url.PathUnescape(value); err == nil {
+				value = unescaped
+			}
+			p.Value = &value
+		}
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+// partitionFill sets the partition fields of a row.
+type partitionFill func(reflect.Value)
+
+// Write returns a WriteFunc that fills in each row's partition fields before
+// passing it to w.
+func (fill partitionFill) Write(w WriteFunc) WriteFunc {
+	if fill == nil {
+		return w
+	}
+	return func(v reflect.Value) error {
+		fill(v)
+		return w(v)
+	}
+}
+
+// Batch returns a BatchFunc that fills in the partition fields of each row of
+// a batch before passing it to w.
+func (fill partitionFill) Batch(w BatchFunc) BatchFunc {
+	if fill == nil {
+		return w
+	}
+	return func(rows reflect.Value) error {
+		for i := range rows.Len() {
+			fill(rows.Index(i))
+		}
+		return w(rows)
+	}
+}
+
+// Partitioned returns rowType extended with a *string field for each partition
+// of the file name, unless rowType already has a field of that name, and a
+// function to fill them in. Fields are filled by name, so it also fills rows
+// of types projected from the extended type.
+func (s schemata) Partitioned(rowType reflect.Type, name string) (reflect.Type, partitionFill) {
+	parts := partitionsOf(name)
+	if len(parts) == 0 {
+		return rowType, nil
+	}
+	fields := make([]reflect.StructField, 0, rowType.NumField()+len(parts))
+	for i := range rowType.NumField() {
+		fields = append(fields, rowType.Field(i))
+	}
+	values := map[string]reflect.Value{}
+	for _, p := range parts {
+		title := fieldName(p.Key)
+		if _, ok := reTypeField(rowType, p.Key); ok || fieldIndex(fields, title) >= 0 {
+			continue
+		}
+		sf := reflect.StructField{Name: title, Type: reflect.TypeFor[*string]()}
+		if title != p.Key && s.Tagged {
+			sf.Tag = reflect.StructTag(fmt.Sprintf("json:%[1]q parquet:%[1]q expr:%[1]q", p.Key))
+		}
+		fields = append(fields, sf)
+		values[title] = reflect.ValueOf(p.Value)
+	}
+	if len(values) == 0 {
+		return rowType, nil
+	}
+	return reflect.StructOf(fields), func(v reflect.Value) {
+		for title, value := range values {
+			if f := v.FieldByName(title); f.IsValid() {
+				f.Set(value)
+			}
+		}
+	}
+}
+
+// PartitionedTagged is Partitioned for rows of LogicalTagged types.
+func (s schemata) PartitionedTagged(rowType reflect.Type, name string) (reflect.Type, partitionFill) {
+	s.Tagged = true
+	return s.Partitioned(rowType, name)
+}
+
+func fieldIndex(fields []reflect.StructField, name string) int {
+	for i, f := range fields {
+		if f.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// partitionPrune decides from the partitions of a file, before it is opened,
+// whether any or all of its rows satisfy filter. Only the parts of filter that
+// refer to nothing but partition fields can be decided.
+func partitionPrune(filter Filter, typer *schemata, name string) groupMatch {
+	if filter == "" {
+		return matchAll
+	}
+	rowType, fill := typer.PartitionedTagged(reflect.TypeFor[struct{}](), name)
+	if fill == nil {
+		return matchSome
+	}
+	tree, err := parser.Parse(string(filter))
+	if err != nil {
+		return matchSome
+	}
+	row := reflect.New(rowType).Elem()
+	fill(row)
+	p := &partitionPruner{row: row, options: filterOptions(rowType)}
+	return p.match(tree.Node)
+}
+
+// partitionMatch is partitionPrune for a file with schema, already open to
+// read its rows. Nothing is decided for a file with a column of the same name
+// as one of its partition keys, as the filter sees that column instead.
+func partitionMatch(filter Filter, typer *schemata, name string, schema *parquet.Schema) groupMatch {
+	m := partitionPrune(filter, typer, name)
+	if m == matchSome || filter == "" {
+		return m
+	}
+	own := typer.LogicalTagged(schema)
+	for _, p := range partitionsOf(name) {
+		if _, ok := reTypeField(own, p.Key); ok {
+			return matchSome
+		}
+	}
+	return m
+}
+
+type partitionPruner struct {
+	row     reflect.Value
+	options []expr.Option
+}
+
+func (p *partitionPruner) match(node ast.Node) groupMatch {
+	switch n := node.(type) {
+	case *ast.UnaryNode:
+		if n.Operator == "not" || n.Operator == "!" {
+			return p.match(n.Node).not()
+		}
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "and", "&&":
+			return p.match(n.Left).and(p.match(n.Right))
+		case "or", "||":
+			return p.match(n.Left).or(p.match(n.Right))
+		}
+	}
+
+	refs := &identVisitor{names: map[string]bool{}}
+	ast.Walk(&node, refs)
+	if len(refs.names) == 0 {
+		return matchSome
+	}
+	for name := range refs.names {
+		if _, ok := reTypeField(p.row.Type(), name); !ok {
+			return matchSome
+		}
+	}
+	prog, err := expr.Compile(node.String(), p.options...)
+	if err != nil {
+		return matchSome
+	}
+	if out, err := expr.Run(prog, p.row.Interface()); err != nil {
+		return matchSome
+	} else if out.(bool) {
+		return matchAll
+	}
+	return matchNone
+}
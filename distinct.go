@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	byteorder "encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+)
+
+type Keep string
+
+type distinctOptions struct {
+	Key    string
+	Keep   Keep
+	Memory uint64
+}
+
+// dedupePartitions is the number of partitions rows are hashed into when
+// spilling, each of which must later fit in memory on its own.
+const dedupePartitions = 16
+
+func printDistinct(ctx run.Context, format DataFormat, expr Filter, shape Shape, files []string, typer *schemata, distinct *distinctOptions, in *inputs) error {
+	files, err := expandFiles(files)
+	if err != nil {
+		return err
+	}
+	in = in.withMemory(distinct.Memory)
+	var dd *deduper
+	var first string // the file dd was made for
+	err = withWriter(format, ctx.Stdout, func(write WriteFunc) error {
+		err := eachFile(files, func(name string) error {
+			if partitionPrune(expr, typer, name) == matchNone {
+				return nil
+			}
+			return in.withFile(name, func(pf *parquet.File) error {
+				rowType, fill := typer.PartitionedTagged(typer.LogicalTagged(pf.Schema()), name)
+				outType, err := reshapeType(shape, rowType)
+				if err != nil {
+					return err
+				}
+				if dd == nil {
+					dd, err = newDeduper(distinct, distinct.Memory, outType)
+					if err != nil {
+						return err
+					}
+					first = name
+				} else if dd.rowType != outType {
+					return fmt.Errorf("%s: schema differs from %s", name, first)
+				}
+				write, err := reshapeWrite(shape, rowType, dd.Write)
+				if err != nil {
+					return err
+				}
+				write, err = filterWrite(expr, rowType, write)
+				if err != nil {
+					return err
+				}
+				return eachRow(pf, rowSelection{}, rowType, fill.Write(write))
+			})
+		})
+		if dd == nil {
+			return err
+		}
+		if err != nil {
+			return errors.Join(err, dd.cleanup())
+		}
+		return errors.Join(dd.Flush(write), dd.cleanup())
+	})
+	if err == nil && dd != nil {
+		fmt.Fprintln(ctx.Stderr, "removed", dd.removed, "duplicate rows")
+	}
+	return err
+}
+
+// deduper removes rows with duplicate keys, keeping the first or last of each.
+// Surviving rows are held in memory up to approximately budget bytes, after
+// which they are hashed by key into partitions spilled to temporary parquet
+// files. Each partition is then deduplicated on its own, and survivors are
+// restored to their original order.
+type deduper struct {
+	keys    []string
+	last    bool
+	budget  uint64
+	rowType reflect.Type
+	seqType reflect.Type
+
+	seq     int64
+	seen    map[string]dedupeEntry
+	size    uint64
+	parts   [dedupePartitions][]*os.File
+	removed int64
+}
+
+type dedupeEntry struct {
+	seq  int64
+	row  reflect.Value
+	size uint64
+}
+
+func newDeduper(opts *distinctOptions, budget uint64, rowType reflect.Type) (*deduper, error) {
+	dd := &deduper{
+		last:    opts.Keep == "last",
+		budget:  budget,
+		rowType: rowType,
+		seqType: reflect.StructOf([]reflect.StructField{
+			{Name: "Seq", Type: reflect.TypeFor[int64]()},
+			{Name: "Row", Type: rowType},
+		}),
+		seen: map[string]dedupeEntry{},
+	}
+	if opts.Key != "" {
+		for key := range strings.SplitSeq(opts.Key, ",") {
+			key = strings.TrimSpace(key)
+			if _, ok := reLookupType(rowType, key); !ok {
+				return nil, fmt.Errorf("key %q: unknown field %q", opts.Key, key)
+			}
+			dd.keys = append(dd.keys, key)
+		}
+	}
+	return dd, nil
+}
+
+// keyOf encodes the key fields of v, or all of v if no key was given.
+func (dd *deduper) keyOf(v reflect.Value) (string, error) {
+	if dd.keys == nil {
+		b, err := appendKey(nil, v)
+		return string(b), err
+	}
+	var b []byte
+	for _, k := range dd.keys {
+		var err error
+		if b, err = appendKey(b, reValueOf(v, k)); err != nil {
+			return "", err
+		}
+	}
+	return string(b), nil
+}
+
+// appendKey appends an encoding of v to b that is equal for values that are
+// equal, taking every NaN as equal, and -0 as 0. Empty and nil lists and maps
+// are equal, as they may not survive spilling distinctly.
+func appendKey(b []byte, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(b, 0), nil
+		}
+		return appendKey(append(b, 1), v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 1), nil
+		}
+		return append(b, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return byteorder.BigEndian.AppendUint64(b, uint64(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return byteorder.BigEndian.AppendUint64(b, v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			f = math.NaN()
+		case f == 0:
+			f = 0
+		}
+		return byteorder.BigEndian.AppendUint64(b, math.Float64bits(f)), nil
+	case reflect.String:
+		b = byteorder.AppendUvarint(b, uint64(v.Len()))
+		return append(b, v.String()...), nil
+	case reflect.Slice, reflect.Array:
+		b = byteorder.AppendUvarint(b, uint64(v.Len()))
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Array && !v.CanAddr() {
+				// Bytes needs an array it can address, unlike one taken
+				// from a map or interface.
+				a := reflect.New(v.Type()).Elem()
+				a.Set(v)
+				v = a
+			}
+			return append(b, v.Bytes()...), nil
+		}
+		for i := range v.Len() {
+			var err error
+			if b, err = appendKey(b, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Map:
+		// Entries are encoded in the order of their encoded keys.
+		entries := make([][2][]byte, 0, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			k, err := appendKey(nil, iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			e, err := appendKey(nil, iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, [2][]byte{k, e})
+		}
+		slices.SortFunc(entries, func(a, b [2][]byte) int { return bytes.Compare(a[0], b[0]) })
+		b = byteorder.AppendUvarint(b, uint64(len(entries)))
+		for _, e := range entries {
+			b = append(append(b, e[0]...), e[1]...)
+		}
+		return b, nil
+	case reflect.Struct:
+		for i := range v.NumField() {
+			var err error
+			if b, err = appendKey(b, v.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("distinct: cannot compare %s", v.Type())
+}
+
+func (dd *deduper) Write(v reflect.Value) error {
+	row := reflect.New(dd.rowType).Elem()
+	row.Set(v)
+	dd.seq++
+	if err := dd.add(dd.seq, row); err != nil {
+		return err
+	}
+	if dd.budget > 0 && dd.size >= dd.budget {
+		return dd.spill()
+	}
+	return nil
+}
+
+func (dd *deduper) add(seq int64, row reflect.Value) error {
+	key, err := dd.keyOf(row)
+	if err != nil {
+		return err
+	}
+	e, dup := dd.seen[key]
+	if dup {
+		dd.removed++
+		if (seq > e.seq) != dd.last {
+			return nil
+		}
+		dd.size -= e.size
+	}
+	e = dedupeEntry{seq: seq, row: row, size: uint64(len(key)) + sizeOf(row)}
+	dd.seen[key] = e
+	dd.size += e.size
+	return nil
+}
+
+func (dd *deduper) spill() error {
+	var pws [dedupePartitions]*parquet.Writer
+	schema := parquet.SchemaOf(reflect.Zero(dd.seqType).Interface())
+	v := reflect.New(dd.seqType)
+	for key, e := range dd.seen {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		p := h.Sum32() % dedupePartitions
+		if pws[p] == nil {
+			f, err := os.CreateTemp("", "parquetry-distinct-*.parquet")
+			if err != nil {
+				return err
+			}
+			dd.parts[p] = append(dd.parts[p], f)
+			pws[p] = parquet.NewWriter(f, schema)
+		}
+		v.Elem().Field(0).SetInt(e.seq)
+		v.Elem().Field(1).Set(e.row)
+		if err := pws[p].Write(v.Interface()); err != nil {
+			return err
+		}
+	}
+	clear(dd.seen)
+	dd.size = 0
+	for _, pw := range pws {
+		if pw != nil {
+			if err := pw.Close(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush writes the surviving rows to w in their original order.
+func (dd *deduper) Flush(w WriteFunc) error {
+	if !dd.spilled() {
+		entries := make([]dedupeEntry, 0, len(dd.seen))
+		for _, e := range dd.seen {
+			entries = append(entries, e)
+		}
+		slices.SortFunc(entries, func(a, b dedupeEntry) int { return cmp.Compare(a.seq, b.seq) })
+		for _, e := range entries {
+			if err := w(e.row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := dd.spill(); err != nil {
+		return err
+	}
+	s := &rowSorter{keys: []sortKey{{Source: "Seq"}}, budget: dd.budget, rowType: dd.seqType}
+	defer s.cleanup()
+	v := reflect.New(dd.seqType).Elem()
+	for _, part := range dd.parts {
+		for _, f := range part {
+			if err := dd.load(f); err != nil {
+				return err
+			}
+		}
+		for _, e := range dd.seen {
+			v.Field(0).SetInt(e.seq)
+			v.Field(1).Set(e.row)
+			if err := s.Write(v); err != nil {
+				return err
+			}
+		}
+		clear(dd.seen)
+	}
+	return s.Flush(func(v reflect.Value) error { return w(v.Field(1)) })
+}
+
+func (dd *deduper) spilled() bool {
+	for _, part := range dd.parts {
+		if len(part) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// load adds the rows of a spilled partition file back into memory.
+func (dd *deduper) load(f *os.File) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	pf, err := parquet.OpenFile(f, stat.Size())
+	if err != nil {
+		return err
+	}
+	pq := parquet.NewReader(pf)
+	defer pq.Close()
+	for {
+		v := reflect.New(dd.seqType)
+		if err := pq.Read(v.Interface()); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := dd.add(v.Elem().Field(0).Int(), v.Elem().Field(1)); err != nil {
+			return err
+		}
+	}
+}
+
+func (dd *deduper) cleanup() error {
+	var errs []error
+	for p, part := range dd.parts {
+		for _, f := range part {
+			errs = append(errs, f.Close(), os.Remove(f.Name()))
+		}
+		dd.parts[p] = nil
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDistinctKeys(t *testing.T) {
+	type row struct {
+		F float64
+		P *float32
+		S []string
+		M map[string]int
+	}
+	nan, inf := float32(math.NaN()), float32(math.Inf(-1))
+	rows := []row{
+		{F: math.NaN()},
+		{F: math.Float64frombits(math.Float64bits(math.NaN()) | 1)},
+		{F: math.Inf(1)},
+		{F: math.Inf(1), S: []string{}},
+		{F: math.Copysign(0, -1), P: &nan},
+		{F: 0, P: &nan, M: map[string]int{}},
+		{P: &inf, M: map[string]int{"a": 1, "b": 2}},
+		{P: &inf, M: map[string]int{"b": 2, "a": 1}},
+		{P: &inf, M: map[string]int{"b": 1, "a": 2}},
+		{S: []string{"a", "b"}},
+		{S: []string{"ab"}},
+	}
+	want := 7 // of rows 0, 2, 4, 6, 8, 9, and 10
+
+	for _, budget := range []uint64{0, 1} {
+		dd, err := newDeduper(&distinctOptions{}, budget, reflect.TypeFor[row]())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range rows {
+			if err := dd.Write(reflect.ValueOf(r)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var got int
+		err = dd.Flush(func(reflect.Value) error {
+			got++
+			return nil
+		})
+		dd.cleanup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("budget %d: got %d distinct rows, want %d", budget, got, want)
+		}
+	}
+}
+
+func TestDistinctKeyArrays(t *testing.T) {
+	// arrays in maps and interfaces cannot be addressed
+	a, err := appendKey(nil, reflect.ValueOf(map[string][4]byte{"k": {1, 2, 3, 4}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := appendKey(nil, reflect.ValueOf([]any{[4]byte{1, 2, 3, 4}}).Index(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(a, []byte{1, 2, 3, 4}) || !bytes.HasSuffix(b, []byte{1, 2, 3, 4}) {
+		t.Errorf("got keys %v and %v", a, b)
+	}
+}
+
+func TestDistinctKeyFields(t *testing.T) {
+	type row struct {
+		A float64
+		B string
+	}
+	dd, err := newDeduper(&distinctOptions{Key: "A"}, 0, reflect.TypeFor[row]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := dd.keyOf(reflect.ValueOf(row{A: math.NaN(), B: "x"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := dd.keyOf(reflect.ValueOf(row{A: -math.NaN(), B: "y"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("NaN keys differ: %q and %q", a, b)
+	}
+}
@@ -12,25 +12,7 @@ func filterWrite(filter Filter, rowType reflect.Type, w WriteFunc) (WriteFunc, e
 	if filter == "" {
 		return w, nil
 	}
-	env := reflect.New(rowType).Elem().Interface()
-
-	match, err := expr.Compile(
-		string(filter),
-		slices.Concat(
-			[]expr.Option{
-				expr.Env(env),
-				expr.AsBool(),
-				expr.Timezone("UTC"),
-			},
-			typeCompare[Date, time.Time](epochCompare),
-			typeCompare[TimeMilliUTC, time.Duration](timeCompare),
-			typeCompare[TimeMicroUTC, time.Duration](timeCompare),
-			typeCompare[TimeNanoUTC, time.Duration](timeCompare),
-			typeCompare[StampMilliUTC, time.Time](epochCompare),
-			typeCompare[StampMicroUTC, time.Time](epochCompare),
-			typeCompare[StampNanoUTC, time.Time](epochCompare),
-		)...,
-	)
+	match, err := expr.Compile(string(filter), filterOptions(rowType)...)
 	if err != nil {
 		return w, err
 	}
@@ -44,6 +26,30 @@ func filterWrite(filter Filter, rowType reflect.Type, w WriteFunc) (WriteFunc, e
 	}, nil
 }
 
+// filterOptions configures expr to evaluate filters against rows of rowType.
+func filterOptions(rowType reflect.Type) []expr.Option {
+	return append(exprOptions(rowType), expr.AsBool())
+}
+
+// exprOptions configures expr to evaluate expressions against rows of rowType,
+// comparing logical types to each other, their storage, or strings.
+func exprOptions(rowType reflect.Type) []expr.Option {
+	env := reflect.New(rowType).Elem().Interface()
+	return slices.Concat(
+		[]expr.Option{
+			expr.Env(env),
+			expr.Timezone("UTC"),
+		},
+		typeCompare[Date, time.Time](epochCompare),
+		typeCompare[TimeMilliUTC, time.Duration](timeCompare),
+		typeCompare[TimeMicroUTC, time.Duration](timeCompare),
+		typeCompare[TimeNanoUTC, time.Duration](timeCompare),
+		typeCompare[StampMilliUTC, time.Time](epochCompare),
+		typeCompare[StampMicroUTC, time.Time](epochCompare),
+		typeCompare[StampNanoUTC, time.Time](epochCompare),
+	)
+}
+
 func typeCompare[T inttime, U any](cmp func(T, any) (int, error)) []expr.Option {
 	relate := func(op, name string, is func(int) bool) []expr.Option {
 		return []expr.Option{
@@ -9,6 +9,8 @@ require (
 	github.com/mutility/cli v0.0.0-20240522180618-9cd49fd46400
 	github.com/parquet-go/parquet-go v0.30.1
 	github.com/rogpeppe/go-internal v1.15.0
+	golang.org/x/term v0.37.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
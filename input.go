@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+// inputs opens the files commands read. Inputs that can only be read once,
+// such as stdin or a fifo, are spooled when first opened, so that commands
+// reading a file more than once, such as merge, see the same contents each
+// time.
+type inputs struct {
+	stdin io.Reader
+	// memory is how much of an input that cannot be read at random is held
+	// in memory before the rest spills to a temporary file.
+	memory  int64
+	spooled map[string]*spooled
+}
+
+func newInputs(stdin io.Reader) *inputs {
+	return &inputs{stdin: stdin, memory: 64 << 20, spooled: map[string]*spooled{}}
+}
+
+// withMemory returns inputs sharing the spooled contents of in, which spool up
+// to memory bytes of each input in memory, as set by --memory or --sort-memory.
+func (in *inputs) withMemory(memory uint64) *inputs {
+	c := *in
+	c.memory = int64(min(memory, math.MaxInt64))
+	return &c
+}
+
+// Close removes any temporary files.
+func (in *inputs) Close() error {
+	var errs []error
+	for name, s := range in.spooled {
+		errs = append(errs, s.Close())
+		delete(in.spooled, name)
+	}
+	return errors.Join(errs...)
+}
+
+// open opens name for reading at random, with range requests for s3:// and
+// http(s):// URLs, and spooling stdin (named "-") and other files that are not
+// regular files.
+func (in *inputs) open(name string) (io.ReaderAt, int64, func() error, error) {
+	nop := func() error { return nil }
+	if isRemote(name) {
+		r, err := openRemote(name)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return r, r.size, nop, nil
+	}
+	if s, ok := in.spooled[name]; ok {
+		return s, s.size, nop, nil
+	}
+	var r io.Reader
+	if name == "-" {
+		r = in.stdin
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			return nil, 0, nil, errors.Join(err, f.Close())
+		}
+		if stat.Mode().IsRegular() {
+			return f, stat.Size(), f.Close, nil
+		}
+		defer f.Close()
+		r = f
+	}
+	s, err := spool(r, in.memory)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	in.spooled[name] = s
+	return s, s.size, nop, nil
+}
+
+// spooled is the content of a reader, in memory or a temporary file.
+type spooled struct {
+	io.ReaderAt
+	size int64
+	file *os.File
+}
+
+// spool reads all of r, keeping up to limit bytes in memory.
+func spool(r io.Reader, limit int64) (*spooled, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if n <= limit {
+		return &spooled{ReaderAt: bytes.NewReader(buf.Bytes()), size: n}, nil
+	}
+
+	f, err := os.CreateTemp("", "parquetry-spool-*")
+	if err != nil {
+		return nil, err
+	}
+	s := &spooled{ReaderAt: f, file: f}
+	if s.size, err = io.Copy(f, io.MultiReader(&buf, r)); err != nil {
+		return nil, errors.Join(err, s.Close())
+	}
+	return s, nil
+}
+
+func (s *spooled) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return errors.Join(s.file.Close(), os.Remove(s.file.Name()))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	data := []byte("0123456789")
+	for _, limit := range []int64{20, 10, 4} {
+		s, err := spool(bytes.NewReader(data), limit)
+		if err != nil {
+			t.Fatal(limit, err)
+		}
+		if spilled := s.file != nil; spilled != (limit < int64(len(data))) {
+			t.Errorf("limit %d: spilled = %v", limit, spilled)
+		}
+		got := make([]byte, s.size)
+		if _, err := s.ReadAt(got, 0); err != nil && err != io.EOF {
+			t.Fatal(limit, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("limit %d: read %q", limit, got)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(limit, err)
+		}
+		if s.file != nil {
+			if _, err := os.Stat(s.file.Name()); !os.IsNotExist(err) {
+				t.Errorf("limit %d: %s not removed", limit, s.file.Name())
+			}
+		}
+	}
+}
+
+func TestOpenInputMemory(t *testing.T) {
+	const memory = 4
+	in := newInputs(bytes.NewReader([]byte("0123456789"))).withMemory(memory)
+	defer in.Close()
+
+	if _, _, _, err := in.open("-"); err != nil {
+		t.Fatal(err)
+	}
+	if in.spooled["-"].file == nil {
+		t.Errorf("stdin not spilled past %d bytes", memory)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// fileRows describes how the rows of one file are read and processed.
+type fileRows struct {
+	name    string
+	file    *parquet.File
+	rowType reflect.Type
+	sel     rowSelection // the rows of the file to read
+
+	// filtered is set if stage may drop rows, so that rows selected after
+	// filtering must be counted as it passes them on, not found by position.
+	filtered bool
+
+	// prune, if set, decides from their statistics and bloom filters which
+	// row groups stage would drop every row of, so that they are not read.
+	prune groupPruner
+
+	// stage wraps a BatchFunc with the work done to rows as they are read,
+	// such as filtering. With --jobs, it is called for each row group, and
+	// the BatchFuncs it returns run on several goroutines at once.
+	stage func(BatchFunc) (BatchFunc, error)
+}
+
+// ranges returns the rows of each row group of f that f.sel selects, less
+// those of row groups f.prune rules out.
+func (f *fileRows) ranges() ([][2]int64, error) {
+	rowGroups := f.file.RowGroups()
+	ranges, err := groupRanges(rowGroups, f.sel)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.name, err)
+	}
+	if f.prune != nil {
+		for i, r := range ranges {
+			if r[0] < r[1] && f.prune(rowGroups[i]) == matchNone {
+				ranges[i][1] = r[0]
+			}
+		}
+	}
+	return ranges, nil
+}
+
+// emitFunc writes the rows of a file, which read passes to a BatchFunc.
+type emitFunc func(f *fileRows, read func(BatchFunc) error) error
+
+// eachFileRows opens each of files in turn, calls prepare to set its row type
+// and stage, then calls emit with a function that reads its rows through the
+// stage into a BatchFunc.
+//
+// Rows are selected by position in each file, before they are staged, unless
+// rows.afterFilter, when they are selected from the rows of all the files
+// together, as each stage passes them on.
+//
+// With more than one job, row groups are decoded and staged on that many
+// goroutines, reading ahead into later row groups and files while emit writes
+// earlier ones. Rows are written in the order of the file, or with unordered,
+// as each row group finishes. Files are always emitted one at a time, in order.
+func eachFileRows(in *inputs, files []string, rows *rowOptions, prepare func(*fileRows) error, emit emitFunc) error {
+	jobs := rows.Jobs
+	switch {
+	case jobs < 0:
+		return fmt.Errorf("jobs must not be negative")
+	case jobs == 0:
+		jobs = runtime.GOMAXPROCS(0)
+	}
+	sel := rows.selection()
+	if rows.afterFilter() {
+		return eachSelectedRows(in, files, jobs, rows.Unordered, sel, prepare, emit)
+	}
+	return readFileRows(in, files, jobs, rows.Unordered, func(f *fileRows) error {
+		f.sel = sel
+		return prepare(f)
+	}, emit)
+}
+
+// readFileRows reads files for eachFileRows, selecting the rows of each file
+// by its sel.
+func readFileRows(in *inputs, files []string, jobs int, unordered bool, prepare func(*fileRows) error, emit emitFunc) error {
+	if jobs == 1 {
+		return eachFile(files, func(name string) error {
+			return in.withFile(name, func(pf *parquet.File) error {
+				f := &fileRows{name: name, file: pf}
+				if err := prepare(f); err != nil {
+					return err
+				}
+				return emit(f, func(write BatchFunc) error {
+					write, err := f.stage(write)
+					if err != nil {
+						return err
+					}
+					ranges, err := f.ranges()
+					if err != nil {
+						return err
+					}
+					return readRanges(pf.RowGroups(), ranges, f.rowType, write)
+				})
+			})
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &rowJobs{
+		ctx:     ctx,
+		in:      in,
+		ordered: !unordered,
+		running: make(chan struct{}, jobs),
+		held:    make(chan struct{}, 2*jobs),
+	}
+	queue := make(chan *fileJob, jobs)
+	go r.dispatch(files, prepare, queue)
+
+	var err error
+	for job := range queue {
+		if err == nil {
+			err = job.err
+		}
+		if err == nil {
+			err = emit(&job.fileRows, job.read)
+		}
+		if err != nil {
+			cancel()
+		}
+		for range job.batches {
+			<-r.held
+		}
+		if job.close != nil {
+			job.close()
+		}
+	}
+	return err
+}
+
+// rowJobs reads row groups on several goroutines.
+type rowJobs struct {
+	ctx     context.Context
+	in      *inputs
+	ordered bool
+	running chan struct{} // a token for each row group being decoded
+	held    chan struct{} // a token for each row group read but not yet written
+}
+
+// fileJob is a file whose row groups are being read.
+type fileJob struct {
+	fileRows
+	close   func() error
+	err     error
+	batches chan rowBatch // closed once every row group read is sent
+	held    chan struct{}
+	ordered bool
+}
+
+// rowBatch is the staged rows of one row group.
+type rowBatch struct {
+	seq  int // of the row groups read from the file
+	rows reflect.Value
+	err  error
+}
+
+// dispatch opens and prepares each file, queues it for emitting, and starts
+// reading its row groups, until every file is read or the context is done.
+func (r *rowJobs) dispatch(files []string, prepare func(*fileRows) error, queue chan<- *fileJob) {
+	defer close(queue)
+	for _, name := range files {
+		job := &fileJob{fileRows: fileRows{name: name}, held: r.held, ordered: r.ordered}
+		job.file, job.close, job.err = r.in.openFile(name)
+		if job.err == nil {
+			job.err = prepare(&job.fileRows)
+		}
+		var ranges [][2]int64
+		if job.err == nil {
+			ranges, job.err = job.ranges()
+		}
+		job.batches = make(chan rowBatch, len(ranges))
+		select {
+		case queue <- job:
+		case <-r.ctx.Done():
+			if job.close != nil {
+				job.close()
+			}
+			return
+		}
+		if job.err != nil {
+			close(job.batches)
+			return
+		}
+
+		var wg sync.WaitGroup
+		seq := 0
+	read:
+		for i, rg := range job.file.RowGroups() {
+			from, to := ranges[i][0], ranges[i][1]
+			if from >= to {
+				continue
+			}
+			select {
+			case r.held <- struct{}{}:
+			case <-r.ctx.Done():
+				break read
+			}
+			b := rowBatch{seq: seq}
+			seq++
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.running <- struct{}{}
+				defer func() { <-r.running }()
+				if b.err = r.ctx.Err(); b.err == nil {
+					b.rows, b.err = readRowGroup(rg, from, to, &job.fileRows)
+				}
+				job.batches <- b
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(job.batches)
+		}()
+	}
+}
+
+// readRowGroup reads rows [from, to) of rg through the stage of f, keeping
+// the rows of each batch it passes on. On error, it returns the rows staged
+// before it, which are written before the error.
+func readRowGroup(rg parquet.RowGroup, from, to int64, f *fileRows) (reflect.Value, error) {
+	kept := reflect.MakeSlice(reflect.SliceOf(f.rowType), 0, 0)
+	write, err := f.stage(func(rows reflect.Value) error {
+		if kept.Len() == 0 {
+			kept = reflect.MakeSlice(reflect.SliceOf(rows.Type().Elem()), 0, int(to-from))
+		}
+		kept = reflect.AppendSlice(kept, rows)
+		return nil
+	})
+	if err != nil {
+		return kept, err
+	}
+	err = readBatches(rg, from, to, f.rowType, write)
+	return kept, err
+}
+
+// read passes the rows of each row group to write, in order unless unordered.
+func (job *fileJob) read(write BatchFunc) error {
+	pending := map[int]rowBatch{}
+	defer func() {
+		for range pending {
+			<-job.held
+		}
+	}()
+	writeBatch := func(b rowBatch) error {
+		defer func() { <-job.held }()
+		if b.rows.Len() > 0 {
+			if err := write(b.rows); err != nil {
+				return err
+			}
+		}
+		return b.err
+	}
+
+	next := 0
+	for b := range job.batches {
+		if !job.ordered {
+			if err := writeBatch(b); err != nil {
+				return err
+			}
+			continue
+		}
+		pending[b.seq] = b
+		for b, ok := pending[next]; ok; b, ok = pending[next] {
+			delete(pending, next)
+			next++
+			if err := writeBatch(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
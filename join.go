@@ -0,0 +1,512 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+)
+
+type JoinType string
+
+type joinOptions struct {
+	On   string
+	Type JoinType
+}
+
+func printJoin(ctx run.Context, format DataFormat, join *joinOptions, left, right string, typer *schemata, rows *rowOptions, in *inputs) error {
+	in = in.withMemory(rows.Memory)
+	return in.withFile(left, func(lpf *parquet.File) error {
+		return in.withFile(right, func(rpf *parquet.File) error {
+			j, err := newJoiner(join, rows.Memory,
+				typer.LogicalTagged(lpf.Schema()), left,
+				typer.LogicalTagged(rpf.Schema()), right)
+			if err != nil {
+				return err
+			}
+			return withWriter(format, ctx.Stdout, func(write WriteFunc) error {
+				return j.join(lpf, rpf, write)
+			})
+		})
+	})
+}
+
+// joinSpillPartitions is the number of partitions each side of a join is
+// hashed into when spilling, the right of each of which must later fit in
+// memory on its own.
+const joinSpillPartitions = 16
+
+// joiner performs a hash join, building a table of the right rows keyed by
+// their join keys, and probing it with each left row in turn. Output follows
+// the order of the left rows, followed by any unmatched right rows.
+//
+// If the right rows exceed approximately budget bytes, both sides are instead
+// hashed by key into partitions spilled to temporary parquet files, each of
+// which is joined on its own. The joined rows are then restored to the order
+// they would have had in memory.
+type joiner struct {
+	kind      JoinType
+	keys      []string
+	budget    uint64
+	leftType  reflect.Type
+	rightType reflect.Type
+	outType   reflect.Type
+	fields    []joinField
+}
+
+// joinField describes the source of an output field: the index of the field
+// in the left or right row, or -1 if it has none on that side. Fields with
+// both come from the left row, or the right if there is no left row.
+type joinField struct {
+	left, right int
+}
+
+func newJoiner(opts *joinOptions, budget uint64, leftType reflect.Type, leftName string, rightType reflect.Type, rightName string) (*joiner, error) {
+	j := &joiner{
+		kind:      opts.Type,
+		budget:    budget,
+		leftType:  leftType,
+		rightType: rightType,
+	}
+	if opts.On == "" {
+		return nil, errors.New("join requires --on")
+	}
+	for key := range strings.SplitSeq(opts.On, ",") {
+		key = strings.TrimSpace(key)
+		lt, ok := reLookupType(leftType, key)
+		if !ok {
+			return nil, fmt.Errorf("on %q: unknown field %q in %s", opts.On, key, leftName)
+		}
+		rt, ok := reLookupType(rightType, key)
+		if !ok {
+			return nil, fmt.Errorf("on %q: unknown field %q in %s", opts.On, key, rightName)
+		}
+		if !joinable(lt, rt) {
+			return nil, fmt.Errorf("on %q: cannot join %s %s with %s", opts.On, key, lt, rt)
+		}
+		j.keys = append(j.keys, key)
+	}
+
+	if j.kind == "semi" || j.kind == "anti" {
+		j.outType = leftType
+		return j, nil
+	}
+
+	leftNullable := j.kind == "right" || j.kind == "full"
+	rightNullable := j.kind == "left" || j.kind == "full"
+	var out []reflect.StructField
+	names := map[string]bool{}
+	for i := range leftType.NumField() {
+		f := leftType.Field(i)
+		jf := joinField{left: i, right: -1}
+		rf, ok := reTypeField(rightType, reFieldName(f))
+		if ok && slices.Contains(j.keys, reFieldName(f)) {
+			jf.right = rf.Index[0]
+			if leftNullable && rf.Type.Kind() == reflect.Pointer {
+				f.Type = nullable(f.Type)
+			}
+		} else if leftNullable {
+			f.Type = nullable(f.Type)
+		}
+		names[reFieldName(f)], names[f.Name] = true, true
+		j.fields = append(j.fields, jf)
+		out = append(out, f)
+	}
+	for i := range rightType.NumField() {
+		f := rightType.Field(i)
+		name := reFieldName(f)
+		if slices.Contains(j.keys, name) {
+			continue
+		}
+		if names[name] || names[f.Name] {
+			name = "right." + name
+			f.Name = fieldName(name)
+			f.Tag = reflect.StructTag(fmt.Sprintf("json:%[1]q parquet:%[1]q expr:%[1]q", name))
+			if names[name] || names[f.Name] {
+				return nil, fmt.Errorf("%s: field %q collides with %s", rightName, name, leftName)
+			}
+		}
+		if rightNullable {
+			f.Type = nullable(f.Type)
+		}
+		names[name], names[f.Name] = true, true
+		j.fields = append(j.fields, joinField{left: -1, right: i})
+		out = append(out, f)
+	}
+	j.outType = reflect.StructOf(out)
+	return j, nil
+}
+
+// joinable reports whether keys of types l and r can be compared.
+func joinable(l, r reflect.Type) bool {
+	for l.Kind() == reflect.Pointer {
+		l = l.Elem()
+	}
+	for r.Kind() == reflect.Pointer {
+		r = r.Elem()
+	}
+	return l == r || l.Kind() == r.Kind() || numeric(l) && numeric(r)
+}
+
+func numeric(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// nullable returns t, or a pointer to t if t cannot represent a missing value.
+func nullable(t reflect.Type) reflect.Type {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		return t
+	}
+	return reflect.PointerTo(t)
+}
+
+// assign sets dst to src, adding or removing pointers and converting between
+// joinable types as necessary.
+func assign(dst, src reflect.Value) {
+	switch {
+	case src.Type() == dst.Type():
+		dst.Set(src)
+	case src.Kind() == reflect.Pointer:
+		if !src.IsNil() {
+			assign(dst, src.Elem())
+		}
+	case dst.Kind() == reflect.Pointer:
+		p := reflect.New(dst.Type().Elem())
+		assign(p.Elem(), src)
+		dst.Set(p)
+	default:
+		dst.Set(src.Convert(dst.Type()))
+	}
+}
+
+// keyOf encodes the join keys of v, reporting false if any is missing.
+func (j *joiner) keyOf(v reflect.Value) (string, bool, error) {
+	vals := make([]reflect.Value, len(j.keys))
+	for i, k := range j.keys {
+		vals[i] = reValueOf(v, k)
+	}
+	return encodeKey(vals)
+}
+
+// encodeKey encodes vals so that equal values of joinable types encode
+// equally, reporting false if any is missing. Numbers are encoded as integers
+// whenever they have an integer value, so that 3 of one type joins 3.0 of
+// another, and otherwise as they are, with every NaN equal.
+func encodeKey(vals []reflect.Value) (string, bool, error) {
+	var b []byte
+	for _, kv := range vals {
+		for kv.Kind() == reflect.Pointer || kv.Kind() == reflect.Interface {
+			if kv.IsNil() {
+				return "", false, nil
+			}
+			kv = kv.Elem()
+		}
+		if !kv.IsValid() {
+			return "", false, nil
+		}
+		switch {
+		case kv.CanInt():
+			kv = reflect.ValueOf(kv.Int())
+		case kv.CanUint() && kv.Uint() <= math.MaxInt64:
+			kv = reflect.ValueOf(int64(kv.Uint()))
+		case kv.CanFloat():
+			if f := kv.Float(); f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+				kv = reflect.ValueOf(int64(f))
+			} else {
+				kv = reflect.ValueOf(f)
+			}
+		}
+		// The kind tells apart values of different kinds encoded alike.
+		var err error
+		if b, err = appendKey(append(b, byte(kv.Kind())), kv); err != nil {
+			return "", false, err
+		}
+	}
+	return string(b), true, nil
+}
+
+func (j *joiner) out(l, r reflect.Value) reflect.Value {
+	if j.kind == "semi" || j.kind == "anti" {
+		return l
+	}
+	o := reflect.New(j.outType).Elem()
+	for i, f := range j.fields {
+		if l.IsValid() && f.left >= 0 {
+			assign(o.Field(i), l.Field(f.left))
+		} else if r.IsValid() && f.right >= 0 {
+			assign(o.Field(i), r.Field(f.right))
+		}
+	}
+	return o
+}
+
+type joinEmit func(seq int64, v reflect.Value) error
+
+type joinTable struct {
+	rows    []reflect.Value
+	seqs    []int64
+	matched []bool
+	index   map[string][]int
+	size    uint64
+}
+
+func (j *joiner) add(t *joinTable, seq int64, v reflect.Value) error {
+	row := reflect.New(j.rightType).Elem()
+	row.Set(v)
+	key, ok, err := j.keyOf(row)
+	if err != nil {
+		return err
+	}
+	if ok {
+		t.index[key] = append(t.index[key], len(t.rows))
+		t.size += uint64(len(key))
+	}
+	t.rows = append(t.rows, row)
+	t.seqs = append(t.seqs, seq)
+	t.matched = append(t.matched, false)
+	t.size += sizeOf(row)
+	return nil
+}
+
+func (j *joiner) probe(t *joinTable, seq int64, l reflect.Value, emit joinEmit) error {
+	key, ok, err := j.keyOf(l)
+	if err != nil {
+		return err
+	}
+	var matches []int
+	if ok {
+		matches = t.index[key]
+	}
+	switch j.kind {
+	case "semi":
+		if len(matches) > 0 {
+			return emit(seq, l)
+		}
+		return nil
+	case "anti":
+		if len(matches) == 0 {
+			return emit(seq, l)
+		}
+		return nil
+	}
+	for _, i := range matches {
+		t.matched[i] = true
+		if err := emit(seq, j.out(l, t.rows[i])); err != nil {
+			return err
+		}
+	}
+	if len(matches) == 0 && (j.kind == "left" || j.kind == "full") {
+		return emit(seq, j.out(l, reflect.Value{}))
+	}
+	return nil
+}
+
+func (j *joiner) unmatched(t *joinTable, emit joinEmit) error {
+	if j.kind != "right" && j.kind != "full" {
+		return nil
+	}
+	for i, row := range t.rows {
+		if !t.matched[i] {
+			if err := emit(t.seqs[i], j.out(reflect.Value{}, row)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (j *joiner) join(left, right *parquet.File, w WriteFunc) error {
+	emit := func(_ int64, v reflect.Value) error { return w(v) }
+	t := &joinTable{index: map[string][]int{}}
+	var rparts *joinPartitions
+	var seq int64
+	err := eachRow(right, rowSelection{}, j.rightType, func(v reflect.Value) error {
+		seq++
+		if rparts != nil {
+			return j.partition(rparts, seq, v)
+		}
+		if err := j.add(t, seq, v); err != nil {
+			return err
+		}
+		if j.budget > 0 && t.size >= j.budget {
+			rparts = newJoinPartitions(j.rightType)
+			for i, row := range t.rows {
+				if err := j.partition(rparts, t.seqs[i], row); err != nil {
+					return err
+				}
+			}
+			t = nil
+		}
+		return nil
+	})
+	if rparts != nil {
+		defer rparts.cleanup()
+	}
+	if err != nil {
+		return err
+	}
+
+	if rparts == nil {
+		seq = 0
+		err := eachRow(left, rowSelection{}, j.leftType, func(v reflect.Value) error {
+			seq++
+			return j.probe(t, seq, v, emit)
+		})
+		if err != nil {
+			return err
+		}
+		return j.unmatched(t, emit)
+	}
+
+	lparts := newJoinPartitions(j.leftType)
+	defer lparts.cleanup()
+	var lseq int64
+	err = eachRow(left, rowSelection{}, j.leftType, func(v reflect.Value) error {
+		lseq++
+		return j.partition(lparts, lseq, v)
+	})
+	if err != nil {
+		return err
+	}
+	if err := errors.Join(rparts.close(), lparts.close()); err != nil {
+		return err
+	}
+
+	seqType := reflect.StructOf([]reflect.StructField{
+		{Name: "Seq", Type: reflect.TypeFor[int64]()},
+		{Name: "Row", Type: j.outType},
+	})
+	s := &rowSorter{keys: []sortKey{{Source: "Seq"}}, budget: j.budget, rowType: seqType}
+	defer s.cleanup()
+	sv := reflect.New(seqType).Elem()
+	emit = func(seq int64, v reflect.Value) error {
+		sv.Field(0).SetInt(seq)
+		sv.Field(1).Set(v)
+		return s.Write(sv)
+	}
+	for p := range joinSpillPartitions {
+		t := &joinTable{index: map[string][]int{}}
+		err := rparts.each(p, func(seq int64, v reflect.Value) error { return j.add(t, seq, v) })
+		if err != nil {
+			return err
+		}
+		err = lparts.each(p, func(seq int64, v reflect.Value) error { return j.probe(t, seq, v, emit) })
+		if err != nil {
+			return err
+		}
+		err = j.unmatched(t, func(seq int64, v reflect.Value) error { return emit(lseq+seq, v) })
+		if err != nil {
+			return err
+		}
+	}
+	return s.Flush(func(v reflect.Value) error { return w(v.Field(1)) })
+}
+
+// partition writes v to the partition of its key. Rows without a key never
+// match, so they can go in any partition.
+func (j *joiner) partition(parts *joinPartitions, seq int64, v reflect.Value) error {
+	key, _, err := j.keyOf(v)
+	if err != nil {
+		return err
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return parts.write(int(h.Sum32()%joinSpillPartitions), seq, v)
+}
+
+// joinPartitions are the temporary parquet files holding rows of one side of
+// a spilled join, along with their original sequence numbers.
+type joinPartitions struct {
+	seqType reflect.Type
+	files   [joinSpillPartitions]*os.File
+	writers [joinSpillPartitions]*parquet.Writer
+	v       reflect.Value
+}
+
+func newJoinPartitions(rowType reflect.Type) *joinPartitions {
+	seqType := reflect.StructOf([]reflect.StructField{
+		{Name: "Seq", Type: reflect.TypeFor[int64]()},
+		{Name: "Row", Type: rowType},
+	})
+	return &joinPartitions{seqType: seqType, v: reflect.New(seqType)}
+}
+
+func (jp *joinPartitions) write(p int, seq int64, row reflect.Value) error {
+	if jp.writers[p] == nil {
+		f, err := os.CreateTemp("", "parquetry-join-*.parquet")
+		if err != nil {
+			return err
+		}
+		jp.files[p] = f
+		jp.writers[p] = parquet.NewWriter(f, parquet.SchemaOf(jp.v.Elem().Interface()))
+	}
+	jp.v.Elem().Field(0).SetInt(seq)
+	jp.v.Elem().Field(1).Set(row)
+	return jp.writers[p].Write(jp.v.Interface())
+}
+
+func (jp *joinPartitions) close() error {
+	var errs []error
+	for p, pw := range jp.writers {
+		if pw != nil {
+			errs = append(errs, pw.Close())
+			jp.writers[p] = nil
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (jp *joinPartitions) each(p int, do func(seq int64, row reflect.Value) error) error {
+	f := jp.files[p]
+	if f == nil {
+		return nil
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	pf, err := parquet.OpenFile(f, stat.Size())
+	if err != nil {
+		return err
+	}
+	pq := parquet.NewReader(pf)
+	defer pq.Close()
+	for {
+		v := reflect.New(jp.seqType)
+		if err := pq.Read(v.Interface()); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := do(v.Elem().Field(0).Int(), v.Elem().Field(1)); err != nil {
+			return err
+		}
+	}
+}
+
+func (jp *joinPartitions) cleanup() error {
+	var errs []error
+	for p, f := range jp.files {
+		if f != nil {
+			errs = append(errs, f.Close(), os.Remove(f.Name()))
+			jp.files[p] = nil
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,11 +9,14 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
+	"unicode"
 
 	"github.com/dustin/go-humanize"
 	"github.com/mutility/cli/run"
 	"github.com/parquet-go/parquet-go"
+	"gopkg.in/yaml.v3"
 )
 
 type parquetReader = parquet.Reader //nolint:staticcheck
@@ -26,9 +30,56 @@ type (
 	DataFormat   string
 	Filter       string
 	Shape        string
+	OrderBy      string
+	Selection    string
 )
 
+// rowOptions control which rows are read and the order they are written in.
+type rowOptions struct {
+	Head, Tail int64
+	Rows       rowSlice
+	RowGroup   *int
+	Select     Selection
+	OrderBy    OrderBy
+	Memory     uint64
+	Jobs       int
+	Unordered  bool
+}
+
+// selection returns the rows selected by --row-group, then --rows, --head,
+// and --tail in turn, each of the rows selected before it.
+func (r *rowOptions) selection() rowSelection {
+	var window rowWindow
+	if r.Rows != (rowSlice{}) {
+		window = append(window, r.Rows)
+	}
+	if r.Head != 0 {
+		window = append(window, headSlice(r.Head))
+	}
+	if r.Tail != 0 {
+		window = append(window, tailSlice(r.Tail))
+	}
+	return rowSelection{group: r.RowGroup, window: window}
+}
+
+// afterFilter reports whether rows are selected from those passing the filter
+// of all files together, rather than by position in each file. Unless --select
+// says, only a lone --tail does so.
+func (r *rowOptions) afterFilter() bool {
+	switch r.Select {
+	case "before":
+		return false
+	case "after":
+		return true
+	}
+	_, ok := r.selection().window.fromEnd()
+	return ok && r.Tail != 0
+}
+
 func runEnv(env run.Environ) error {
+	in := newInputs(env.Stdin)
+	defer in.Close()
+
 	schemaFormats := []run.NamedValue[SchemaFormat]{
 		{Name: "message", Value: "message"},
 		{Name: "m", Value: "message"},
@@ -42,27 +93,94 @@ func runEnv(env run.Environ) error {
 	stringify := run.EnablerVar(&typer.Stringify, "string", "Treat all []uint as string.", true)
 
 	schemaFmt := run.NamedOf("format", "Output schema as message or logical/physical struct", schemaFormats)
-	outFmt := run.StringOf[DataFormat]("format", "Output as go, csv, json, or jsonl", "go", "csv", "json", "jsonl")
-	head := run.IntLike[int64]("head", "Include first n or skip first -n rows", 0)
-	tail := run.IntLike[int64]("tail", "Include last n or skip last -n rows", 0)
+	metaFmt := run.StringOf[MetaFormat]("format", "Output metadata as text, json, or yaml", "text", "json", "yaml")
+	outFmt := run.StringOf[DataFormat]("format", "Output as go, csv, json, jsonl, parquet, table, box, or markdown", "go", "csv", "json", "jsonl", "parquet", "table", "box", "markdown")
+	rows := &rowOptions{Memory: 64 << 20, Jobs: 1}
+	head := run.IntLikeVar(&rows.Head, "head", "Include first n or skip first -n rows", 0)
+	tail := run.IntLikeVar(&rows.Tail, "tail", "Include last n or skip last -n rows", 0)
+	rowSlices := run.ParserVar(&rows.Rows, "rows", "Include rows START:STOP, counting negatives from the end", parseRowSlice)
+	rowGroup := run.ParserVar(&rows.RowGroup, "row-group", "Include only row group n, counting negatives from the end", parseRowGroup)
+	selectWhen := run.StringVarOf[Selection](&rows.Select, "select", "Select rows before or after filtering", "before", "after")
 	filter := run.StringLike[Filter]("filter", "Include rows matching FILTER")
 	shape := run.StringLike[Shape]("shape", "Transform rows into SHAPE")
+	order := run.StringLikeVar(&rows.OrderBy, "order", "Sort rows by ORDER")
+	sortMemory := run.ParserVar(&rows.Memory, "sort-memory", "Sort up to SIZE in memory before spilling to disk", humanize.ParseBytes)
+	jobs := run.IntLikeVar(&rows.Jobs, "jobs", "Read row groups on n goroutines, or 0 for one per CPU", 0)
+	unordered := run.EnablerVar(&rows.Unordered, "unordered", "Write rows as their row groups are read, not in file order", true)
+	keepMemory := run.ParserVar(&rows.Memory, "memory", "Track up to SIZE of rows in memory before spilling to disk", humanize.ParseBytes)
+
+	aggregates := run.StringLike[Aggregates]("aggregates", "Compute AGGREGATES for each group")
+	by := run.StringLike[GroupBy]("by", "Group rows by KEYS")
+
+	distinct := &distinctOptions{Memory: 64 << 20}
+	key := run.StringVar(&distinct.Key, "key", "Compare only KEY fields")
+	keep := run.StringVarOf[Keep](&distinct.Keep, "keep", "Keep the first or last of each duplicate", "first", "last")
+	distinctMemory := run.ParserVar(&distinct.Memory, "memory", "Track up to SIZE of rows in memory before spilling to disk", humanize.ParseBytes)
+
+	sample := new(sampleOptions)
+	sampleCount := run.IntLikeVar(&sample.N, "count", "Sample n rows (default 10)", 0)
+	fraction := run.ParserVar(&sample.Fraction, "fraction", "Sample row groups with probability P", parseFraction)
+	seed := run.ParserVar(&sample.Seed, "seed", "Seed the random choice for a reproducible sample", parseSeed)
+
+	join := new(joinOptions)
+	on := run.StringVar(&join.On, "on", "Join rows with equal KEYS")
+	joinType := run.StringVarOf[JoinType](&join.Type, "type", "Join as inner, left, right, full, anti, or semi", "inner", "left", "right", "full", "anti", "semi")
+
+	query := run.StringLike[Query]("query", "SQL query")
+
+	writes := &writeOptions{RowGroupSize: 1 << 20}
+	output := run.StringVar(&writes.Output, "output", "Write to FILE instead of stdout")
+	outputDir := run.StringVar(&writes.Output, "output", "Write files under DIR")
+	rowGroupSize := run.IntLikeVar(&writes.RowGroupSize, "row-group-size", "Write up to n rows per row group", 0)
+	compression := run.StringVarOf[Compression](&writes.Compression, "compression", "Compress as none, snappy, gzip, zstd, lz4, or brotli", "none", "snappy", "gzip", "zstd", "lz4", "brotli")
+
+	split := new(splitOptions)
+	splitRows := run.IntLikeVar(&split.Rows, "rows", "Write up to n rows per file", 0)
+	splitParts := run.IntLikeVar(&split.Parts, "parts", "Write n files of equal rows", 0)
+	splitSize := run.ParserVar(&split.Size, "size", "Write files of about SIZE", humanize.ParseBytes)
+	splitBy := run.StringVar(&split.By, "by", "Write a directory for each value of COLUMN")
+	splitOpen := run.IntLikeVar(&split.Open, "open", "Write up to n files at once", 0)
+
+	rewrite := &rewriteOptions{RowGroup: rowGroupLimit{rows: 1 << 20}}
+	rewriteOut := run.StringVar(&writes.Output, "out", "Parquet file to write, or - for stdout")
+	level := run.IntLikeVar(&writes.Level, "level", "Compress at level n of the codec", 0)
+	rewriteRowGroup := run.ParserVar(&rewrite.RowGroup, "row-group-size", "Write up to n rows or SIZE per row group", parseRowGroupLimit)
+	pageSize := run.ParserVar(&rewrite.PageSize, "page-size", "Write pages of about SIZE", humanize.ParseBytes)
+	dictionary := run.StringVarOf[Dictionary](&rewrite.Dictionary, "dictionary", "Dictionary encode columns: auto, on, or off", "auto", "on", "off")
+	sortBy := run.StringLikeVar(&rewrite.SortBy, "sort-by", "Sort rows by ORDER")
+	bloomFilter := run.StringVar(&rewrite.BloomFilter, "bloom-filter", "Write bloom filters for COLUMNS")
+	stats := run.StringVarOf[Stats](&rewrite.Stats, "stats", "Write column statistics: on or off", "on", "off")
+
+	pageColumn := run.String("column", "Show only pages of COLUMN")
+	bloomColumn := run.String("column", "Column whose bloom filters to check")
+	bloomValues := run.StringSlice("value", "Values to look up")
+	addr := run.String("addr", "Listen on ADDR")
 
 	file := run.File("file", "Parquet file")
-	files := run.FileSlice("file", "Parquet files")
+	left := run.File("left", "Left parquet file")
+	right := run.File("right", "Right parquet file")
+	files := run.FileSlice("file", "Parquet files, directories, or globs")
 
 	headFlag := head.Flags(0, "head", "n|-n")
 	tailFlag := tail.Flags(0, "tail", "n|-n")
+	rowsFlag := rowSlices.Flags(0, "rows", "START:STOP")
+	rowGroupFlag := rowGroup.Flags(0, "row-group", "n")
+	selectFlag := selectWhen.Flags(0, "select", "WHEN")
 	dataFlag := outFmt.Flags('f', "format", "").Default("go")
+	orderFlag := order.Flags(0, "order-by", "ORDER")
+	memoryFlag := sortMemory.Flags(0, "sort-memory", "SIZE").Default("64MiB")
+	jobsFlag := jobs.Flags('j', "jobs", "n").Default("1")
+	unorderedFlag := unordered.Flag()
 
-	printOne := run.Handler7(printFile, outFmt, head, tail, filter, shape, file.Slice(), run.Pass(typer))
-	printMany := run.Handler7(printFile, outFmt, head, tail, filter, shape, files, run.Pass(typer))
+	printOne := run.Handler7(printFile, outFmt, filter, shape, file.Slice(), run.Pass(typer), run.Pass(rows), run.Pass(in))
+	printMany := run.Handler7(printFile, outFmt, filter, shape, files, run.Pass(typer), run.Pass(rows), run.Pass(in))
 
 	app := run.MustApp("parquetry", "Tooling for parquet files",
 		stringify.Flag(),
 		run.MustCmd("cat", "Print a parquet file",
-			dataFlag, headFlag, tailFlag,
+			dataFlag, headFlag, tailFlag, rowsFlag, rowGroupFlag, selectFlag, orderFlag, memoryFlag, jobsFlag, unorderedFlag,
 			files.Args("file"),
+			run.Details(filesHelp+rowsHelp),
 			printMany,
 		),
 
@@ -78,36 +196,161 @@ func runEnv(env run.Environ) error {
 			printOne,
 		),
 
+		run.MustCmd("view", "Browse a parquet file in the terminal",
+			file.Arg("file"),
+			run.Details(viewHelp),
+			run.Handler3(viewFile, file, run.Pass(typer), run.Pass(in)),
+		),
+
+		run.MustCmd("repl", "Run commands against parquet files kept open",
+			files.Args("file"),
+			run.Details(replHelp),
+			run.Handler3(runRepl, files, run.Pass(typer), run.Pass(in)),
+		),
+
+		run.MustCmd("serve", "Serve parquet files as a JSON API",
+			addr.Flags(0, "addr", "ADDR").Default("localhost:8080"),
+			files.Args("file"),
+			run.Details(serveHelp),
+			run.Handler4(serveFiles, addr, files, run.Pass(typer), run.Pass(in)),
+		),
+
 		run.MustCmd("meta", "Print parquet metadata",
+			metaFmt.Flags('f', "format", "").Default("text"),
 			files.Args("file"),
-			run.Handler2(printMeta, files, run.Pass(typer)),
+			run.Handler4(printMeta, metaFmt, files, run.Pass(typer), run.Pass(in)),
+		),
+
+		run.MustCmd("pages", "Print the pages of a parquet file",
+			pageColumn.Flags(0, "column", "COLUMN"),
+			file.Arg("file"),
+			run.Details(pagesHelp),
+			run.Handler4(printPages, pageColumn, file, run.Pass(typer), run.Pass(in)),
+		),
+
+		run.MustCmd("bloom", "Check which row groups might contain values",
+			file.Arg("file"), bloomColumn.Arg("column"), bloomValues.Args("value"),
+			run.Details(bloomHelp),
+			run.Handler4(printBloom, file, bloomColumn, bloomValues, run.Pass(in)),
+		),
+
+		run.MustCmd("verify", "Check parquet files for corruption",
+			files.Args("file"),
+			run.Details(verifyHelp),
+			run.Handler3(printVerify, files, run.Pass(typer), run.Pass(in)),
 		),
 
 		run.MustCmd("schema", "Print parquet schema",
 			schemaFmt.Flags('f', "format", "").Default("message"),
 			files.Args("file"),
-			run.Handler3(printSchema, schemaFmt, files, run.Pass(typer)),
+			run.Handler4(printSchema, schemaFmt, files, run.Pass(typer), run.Pass(in)),
 		),
 
 		run.MustCmd("to", "Convert parquet to...",
-			headFlag, tailFlag,
+			headFlag, tailFlag, rowsFlag, rowGroupFlag, selectFlag, orderFlag, memoryFlag, jobsFlag, unorderedFlag,
 			outFmt.Arg("format"), files.Args("file"),
+			run.Details(filesHelp+rowsHelp),
 			printMany,
 		),
 
 		run.MustCmd("where", "Filter a parquet file",
-			dataFlag, shape.Flags('x', "shape", "SHAPE"),
+			dataFlag, shape.Flags('x', "shape", "SHAPE"), headFlag, tailFlag, rowsFlag, rowGroupFlag, selectFlag, orderFlag, memoryFlag, jobsFlag, unorderedFlag,
 			filter.Arg("filter"), files.Args("file"),
-			run.DetailsFor(filterHelp, filter),
+			run.DetailsFor(filterHelp+rowsHelp, filter),
 			printMany,
 		),
 
 		run.MustCmd("reshape", "Reshape a parquet file",
-			dataFlag, filter.Flags('m', "filter", "FILTER"),
+			dataFlag, filter.Flags('m', "filter", "FILTER"), headFlag, tailFlag, rowsFlag, rowGroupFlag, selectFlag, orderFlag, memoryFlag, jobsFlag, unorderedFlag,
 			shape.Arg("shape"), files.Args("file"),
-			run.DetailsFor(shapeHelp, shape),
+			run.DetailsFor(shapeHelp+rowsHelp, shape),
+			printMany,
+		),
+
+		run.MustCmd("sort", "Sort a parquet file",
+			dataFlag, filter.Flags('m', "filter", "FILTER"), shape.Flags('x', "shape", "SHAPE"), memoryFlag, jobsFlag, unorderedFlag,
+			order.Arg("order"), files.Args("file"),
+			run.DetailsFor(orderHelp, order),
 			printMany,
 		),
+
+		run.MustCmd("distinct", "Remove duplicate rows from parquet files",
+			dataFlag, filter.Flags('m', "filter", "FILTER"), shape.Flags('x', "shape", "SHAPE"),
+			key.Flags(0, "key", "KEY,..."), keep.Flags(0, "keep", "").Default("first"),
+			distinctMemory.Flags(0, "memory", "SIZE").Default("64MiB"),
+			files.Args("file"),
+			run.Details(distinctHelp),
+			run.Handler7(printDistinct, outFmt, filter, shape, files, run.Pass(typer), run.Pass(distinct), run.Pass(in)),
+		),
+
+		run.MustCmd("sample", "Print a random sample of rows from parquet files",
+			dataFlag, filter.Flags('m', "filter", "FILTER"), shape.Flags('x', "shape", "SHAPE"),
+			sampleCount.Flags('n', "count", "n"), fraction.Flags(0, "fraction", "P"), seed.Flags(0, "seed", "n"),
+			files.Args("file"),
+			run.Details(sampleHelp),
+			run.Handler7(printSample, outFmt, filter, shape, files, run.Pass(typer), run.Pass(sample), run.Pass(in)),
+		),
+
+		run.MustCmd("agg", "Aggregate groups of rows in parquet files",
+			dataFlag, filter.Flags('m', "filter", "FILTER"), by.Flags(0, "by", "KEYS"),
+			aggregates.Arg("aggregates"), files.Args("file"),
+			run.DetailsFor(aggHelp, aggregates),
+			run.Handler7(printAgg, outFmt, filter, aggregates, by, files, run.Pass(typer), run.Pass(in)),
+		),
+
+		run.MustCmd("count", "Count rows in parquet files",
+			filter.Flags('m', "filter", "FILTER"),
+			files.Args("file"),
+			run.Details(countHelp),
+			run.Handler4(printCount, filter, files, run.Pass(typer), run.Pass(in)),
+		),
+
+		run.MustCmd("join", "Join rows of two parquet files",
+			dataFlag, on.Flags(0, "on", "KEY,..."), joinType.Flags(0, "type", "").Default("inner"),
+			keepMemory.Flags(0, "memory", "SIZE").Default("64MiB"),
+			left.Arg("left"), right.Arg("right"),
+			run.Details(joinHelp),
+			run.Handler7(printJoin, outFmt, run.Pass(join), left, right, run.Pass(typer), run.Pass(rows), run.Pass(in)),
+		),
+
+		run.MustCmd("sql", "Query parquet files with SQL",
+			dataFlag, keepMemory.Flags(0, "memory", "SIZE").Default("64MiB"),
+			query.Arg("query"),
+			run.Details(sqlHelp),
+			run.Handler5(printSQL, outFmt, query, run.Pass(typer), run.Pass(rows), run.Pass(in)),
+		),
+
+		run.MustCmd("merge", "Combine parquet files into one",
+			output.Flags('o', "output", "FILE"), rowGroupSize.Flags(0, "row-group-size", "n").Default("1048576"),
+			compression.Flags(0, "compression", "").Default("snappy"),
+			files.Args("file"),
+			run.Details(mergeHelp),
+			run.Handler3(mergeFiles, run.Pass(writes), files, run.Pass(in)),
+		),
+
+		run.MustCmd("split", "Divide a parquet file into parts",
+			outputDir.Flags('o', "output", "DIR").Default("."),
+			splitRows.Flags(0, "rows", "n"), splitParts.Flags(0, "parts", "n"), splitSize.Flags(0, "size", "SIZE"),
+			splitBy.Flags(0, "by", "COLUMN"), splitOpen.Flags(0, "open", "n").Default("64"),
+			rowGroupSize.Flags(0, "row-group-size", "n").Default("1048576"),
+			compression.Flags(0, "compression", "").Default("snappy"),
+			file.Arg("file"),
+			run.Details(splitHelp),
+			run.Handler5(splitFile, run.Pass(split), run.Pass(writes), file, run.Pass(typer), run.Pass(in)),
+		),
+
+		run.MustCmd("rewrite", "Recompress and re-layout a parquet file",
+			compression.Flags(0, "compression", "").Default("snappy"), level.Flags(0, "level", "n"),
+			rewriteRowGroup.Flags(0, "row-group-size", "n|SIZE").Default("1048576"),
+			pageSize.Flags(0, "page-size", "SIZE"),
+			dictionary.Flags(0, "dictionary", "").Default("auto"),
+			sortBy.Flags(0, "sort-by", "ORDER"),
+			bloomFilter.Flags(0, "bloom-filter", "COLUMNS"),
+			stats.Flags(0, "stats", "").Default("on"),
+			file.Arg("in"), rewriteOut.Arg("out"),
+			run.Details(rewriteHelp),
+			run.Handler5(rewriteFile, run.Pass(writes), run.Pass(rewrite), file, run.Pass(typer), run.Pass(in)),
+		),
 	)
 
 	err := app.Main(context.Background(), run.DefaultEnviron())
@@ -117,9 +360,29 @@ func runEnv(env run.Environ) error {
 	return err
 }
 
-func printMeta(ctx run.Context, files []string, typer *schemata) error {
+func printMeta(ctx run.Context, format MetaFormat, files []string, typer *schemata, in *inputs) error {
+	files, err := expandFiles(files)
+	if err != nil {
+		return err
+	}
+	var encode func(any) error
+	switch format {
+	case "json":
+		enc := json.NewEncoder(ctx.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		encode = enc.Encode
+	case "yaml":
+		enc := yaml.NewEncoder(ctx.Stdout)
+		enc.SetIndent(2)
+		defer enc.Close()
+		encode = enc.Encode
+	}
 	return eachFile(files, func(name string) error {
-		return withFile(name, func(pf *parquet.File) (err error) {
+		return in.withFile(name, func(pf *parquet.File) (err error) {
+			if encode != nil {
+				return encode(footerOf(name, pf, typer.LogicalTagged(pf.Schema())))
+			}
 			m := pf.Metadata()
 			if len(files) > 1 {
 				fmt.Fprintln(ctx.Stdout, name+":")
@@ -147,9 +410,13 @@ func printMeta(ctx run.Context, files []string, typer *schemata) error {
 	})
 }
 
-func printSchema(ctx run.Context, format SchemaFormat, files []string, typer *schemata) error {
+func printSchema(ctx run.Context, format SchemaFormat, files []string, typer *schemata, in *inputs) error {
+	files, err := expandFiles(files)
+	if err != nil {
+		return err
+	}
 	return eachFile(files, func(name string) error {
-		return withReader(name, func(pq *parquetReader) (err error) {
+		return in.withReader(name, func(pq *parquetReader) (err error) {
 			var schema any
 			switch format {
 			case "message":
@@ -157,7 +424,8 @@ func printSchema(ctx run.Context, format SchemaFormat, files []string, typer *sc
 			case "physical":
 				schema = pq.Schema().GoType()
 			case "logical":
-				s := typer.Logical(pq.Schema()).String()
+				t, _ := typer.Partitioned(typer.Logical(pq.Schema()), name)
+				s := t.String()
 				schema = strings.ReplaceAll(s, " main.", " ")
 			}
 			if len(files) > 1 {
@@ -170,29 +438,128 @@ func printSchema(ctx run.Context, format SchemaFormat, files []string, typer *sc
 	})
 }
 
-func printFile(ctx run.Context, format DataFormat, head, tail int64, expr Filter, shape Shape, files []string, typer *schemata) error {
-	return eachFile(files, func(name string) error {
-		return withReader(name, func(pq *parquetReader) error {
-			return withWriter(format, ctx.Stdout, func(write WriteFunc) error {
-				rowType := typer.LogicalTagged(pq.Schema())
-				write, err := reshapeWrite(shape, rowType, write)
-				if err != nil {
+func printFile(ctx run.Context, format DataFormat, expr Filter, shape Shape, files []string, typer *schemata, rows *rowOptions, in *inputs) error {
+	files, err := expandFiles(files)
+	if err != nil {
+		return err
+	}
+	files = slices.DeleteFunc(files, func(name string) bool {
+		return partitionPrune(expr, typer, name) == matchNone
+	})
+	in = in.withMemory(rows.Memory)
+	prepare := func(f *fileRows) error {
+		rowType, fill := typer.PartitionedTagged(typer.LogicalTagged(f.file.Schema()), f.name)
+		f.rowType = rowType
+		f.filtered = expr != ""
+		if f.filtered {
+			prune, err := newGroupPruner(expr, f.file.Schema(), rowType)
+			if err != nil {
+				return err
+			}
+			f.prune = prune
+		}
+		f.stage = func(write BatchFunc) (BatchFunc, error) {
+			// Rows are reshaped after sorting, or else as they are read.
+			if rows.OrderBy == "" {
+				var err error
+				if write, err = reshapeBatch(shape, rowType, write); err != nil {
+					return nil, err
+				}
+			}
+			write, err := filterBatch(expr, rowType, write)
+			return fill.Batch(write), err
+		}
+		return nil
+	}
+	if rows.OrderBy == "" {
+		// One writer writes the rows of every file, opened by the first so
+		// that nothing is written without any.
+		var rw rowWriter
+		var outType reflect.Type
+		var first string
+		err := eachFileRows(in, files, rows, prepare, func(f *fileRows, read func(BatchFunc) error) error {
+			t, err := reshapeType(shape, f.rowType)
+			if err != nil {
+				return err
+			}
+			switch {
+			case rw == nil:
+				if rw, err = newRowWriter(format, ctx.Stdout); err != nil {
 					return err
 				}
-				write, err = filterWrite(expr, rowType, write)
+				outType, first = t, f.name
+			case t != outType && !mixesSchemas(format):
+				return fmt.Errorf("%s: schema differs from %s", f.name, first)
+			}
+			return read(rw.WriteBatch)
+		})
+		if rw != nil {
+			err = errors.Join(err, rw.Close())
+		}
+		return err
+	}
+
+	// The rows of all the files are sorted together, then reshaped. A lone
+	// file whose metadata already describes the order is written as it is.
+	return withWriter(format, ctx.Stdout, func(write WriteFunc) error {
+		var sorter *rowSorter
+		var first string
+		err := eachFileRows(in, files, rows, prepare, func(f *fileRows, read func(BatchFunc) error) error {
+			if sorter != nil {
+				if f.rowType != sorter.rowType {
+					return fmt.Errorf("%s: schema differs from %s", f.name, first)
+				}
+				return read(WriteFunc(sorter.Write).Rows())
+			}
+			keys, err := ParseOrderBy(rows.OrderBy, f.rowType)
+			if err != nil {
+				return err
+			}
+			if len(files) == 1 && sortedByMetadata(f.file, keys) {
+				write, err := reshapeWrite(shape, f.rowType, write)
 				if err != nil {
 					return err
 				}
-				return eachRow(pq, head, tail, rowType, write)
-			})
+				return read(write.Rows())
+			}
+			sorter, first = &rowSorter{keys: keys, budget: rows.Memory, rowType: f.rowType}, f.name
+			return read(WriteFunc(sorter.Write).Rows())
 		})
+		if sorter == nil {
+			return err
+		}
+		if err == nil {
+			write, err = reshapeWrite(shape, sorter.rowType, write)
+		}
+		if err == nil {
+			err = sorter.Flush(write)
+		}
+		return errors.Join(err, sorter.cleanup())
 	})
 }
 
-type WriteCloser interface {
-	Write(v reflect.Value) error
-	Close() error
-}
+const filesHelp = `
+Files may be named directly, or found as the *.parquet files beneath
+directories and matching globs, skipping those whose names start with . or _.
+
+Files under key=value directories, such as region=EU/part-0.parquet, have a
+*string field for each key that is not a column of the file, which is nil for
+__HIVE_DEFAULT_PARTITION__. With a filter, files whose directories exclude all
+of their rows are skipped without being opened.
+`
+
+const rowsHelp = `
+--rows, --head, and --tail select rows by position in each file, and --row-group
+a row group of each file. Combined, --rows, --head, and --tail apply in that
+order, each to the rows the one before selected, so --head 2000 --tail 1000
+selects rows 1000:2000.
+
+With a filter, they select rows before filtering, except that a lone --tail
+selects the last rows to match across all files, found by reading row groups
+backwards from the end. With --select after, --rows, --head, and --tail all
+select from the rows that match across all files, and with --select before,
+all by position. --row-group always selects before filtering.
+`
 
 const filterHelp = `
 Specify the desired filter per the expr language, a go-like syntax.
@@ -252,31 +619,367 @@ If the source has a group Person with fields Name and Age:
   - 'Person.Name, Person.Age' will flatten the nested group into Name,Age
 `
 
+const orderHelp = `
+Specify the desired order as a list of fields, each optionally followed by asc or desc.
+  - Fields are a dotted name like a.b.c specifying their source
+  - Rows are ordered by the first field, then ties by the next, and so on
+  - Rows that compare equal on every field keep their original order
+
+Values compare by their logical type: dates, times, and timestamps chronologically,
+strings lexically, and numbers numerically. Missing (nil) values sort first.
+Rows of all the files are sorted together, and must share a schema. If a lone file's
+sorting_columns metadata already describes the order, rows are written without sorting.
+Otherwise rows beyond --sort-memory are sorted in runs spilled to temporary files and merged.
+
+For example, given the fields described in the filter help:
+  - 'i' orders by i, smallest first
+  - 'w.s desc, i' orders by most recent w.s, then by smallest i
+`
+
+const distinctHelp = `
+Rows are duplicates if they are equal after filtering and shaping, or if
+--key is provided, if the listed (dotted) fields are equal. All files must
+share a schema, and duplicates are removed across all of them. Surviving rows
+are written in their original order, and the number removed reported to stderr.
+Floating point NaNs are equal to each other, and -0 to 0.
+
+For example:
+  - 'parquetry distinct -x region a.parquet b.parquet' lists each region once
+  - 'parquetry distinct --key id --keep last events.parquet' keeps the latest of each id
+`
+
+const sampleHelp = `
+With --count, a uniform random sample of n rows is chosen from all the rows
+that match the filter, across every row group of every file, so each file is
+read in full. With --fraction, each row group is instead chosen with
+probability P, and only the chosen row groups are read, writing each of their
+rows that match. This is much faster, but the rows of a row group are sampled
+together. All files must share a schema, and rows are written in their
+original order.
+
+The same --seed samples the same rows of the same files.
+
+For example:
+  - 'parquetry sample -n 100 --seed 42 -f jsonl events.parquet'
+  - parquetry sample --fraction 0.01 -m 'region == "EU"' parts/
+`
+
+const aggHelp = `
+Specify the desired aggregates as a list of functions of dotted field names,
+and optionally group keys with --by as a list of fields or functions of them.
+Each may be named with: AS $name
+
+Aggregates include:
+  - count()                  // rows in the group
+  - count(a); count_distinct(a) // non-nil values, distinct non-nil values
+  - sum(a); avg(a)           // numbers and decimals; avg also of dates, times, and timestamps
+  - min(a); max(a)           // any comparable value
+
+avg, min, and max are nil for a group without non-nil values.
+
+Group keys may extract part of a date or timestamp with:
+  - year(a); month(a); day(a); hour(a); date(a)
+
+All files must share a schema, and one row is written per group in the order
+groups are first seen. Without --by, a single row summarizes all rows.
+
+For example, given the fields described in the filter help:
+  - 'count(), min(w.s), max(w.s)' counts rows and finds the earliest and latest w.s
+  - 'sum(i) as total' --by 'rs, year(w.d) as y' totals i by rs and year
+`
+
+const countHelp = `
+Without --filter, counts come from the file footer without reading any rows.
+With --filter, row groups whose column statistics or bloom filters show that
+all or none of their rows match are counted or skipped without reading them,
+and otherwise only the columns the filter references are read. Files whose
+directories exclude all of their rows count none without being opened.
+
+When counting several files, each file's count is followed by the total.
+`
+
+const joinHelp = `
+Rows of the left and right files are joined when all the --on fields are equal.
+Missing (nil) keys never match. Each type of join writes:
+  - inner: each matching pair of rows
+  - left:  each matching pair, and each left row without a match
+  - right: each matching pair, and each right row without a match
+  - full:  each matching pair, and each row of either without a match
+  - semi:  each left row that has a match
+  - anti:  each left row that has no match
+
+Joined rows hold the fields of the left row, followed by those of the right
+row other than top level keys. Right fields whose names collide with the left
+are prefixed with 'right.', and fields missing from unmatched rows are nil.
+Rows are written in the order of the left file, followed by unmatched right rows.
+
+The right file is held in memory up to --memory, beyond which both files are
+partitioned into temporary files and joined a partition at a time.
+
+For example:
+  - 'parquetry join --on id orders.parquet customers.parquet'
+  - 'parquetry join -f parquet --type left --on id a.parquet b.parquet'
+`
+
+const sqlHelp = `
+Queries select from parquet files named by quoted paths, each of which may be
+referred to by its base name or an alias:
+
+  SELECT items FROM "path" [[AS] alias]
+    [[INNER | LEFT | RIGHT | FULL] JOIN "path" [[AS] alias] ON condition]...
+    [WHERE condition] [GROUP BY expr, ...] [HAVING condition]
+    [ORDER BY expr [ASC | DESC], ...] [LIMIT n [OFFSET n]]
+
+Items are *, alias.*, or expressions optionally named with AS. Expressions
+include columns (a, alias.a, a.b), literals ('text', 42, 1.5, TRUE, NULL,
+DATE '2024-01-01', TIMESTAMP '…'), arithmetic (+ - * / % ||), comparisons
+(= <> < <= > >= IS [NOT] NULL, [NOT] IN (…), [NOT] BETWEEN, [NOT] LIKE),
+AND, OR, NOT, and the functions lower, upper, length, abs, round, floor,
+ceil, coalesce, year, month, day, hour, and date. Aggregates are count(*),
+count(a), count(DISTINCT a), sum, avg, min, and max. ORDER BY may also refer
+to selected columns by position or name.
+
+Column names are case sensitive, and compare by their logical types as in
+filters. Decimals are exact in sums, differences, and products, but divide
+as floats. NULLs propagate through expressions, division by zero is NULL,
+and only the columns a query uses are read. The first file is read a row at
+a time, while joined files are held in memory. Sorting beyond --memory spills
+to temporary files.
+
+For example:
+  - parquetry sql 'SELECT region, count(*) FROM "a.parquet" GROUP BY region ORDER BY 2 DESC'
+  - parquetry sql -f parquet 'SELECT o.*, c.name FROM "o.parquet" o JOIN "c.parquet" c ON o.id = c.id'
+`
+
+const mergeHelp = `
+Rows of each file are written in turn to a single parquet file, converted to a
+schema that unifies those of all the files:
+  - Columns are written in the order they are first seen
+  - Columns missing from some files become optional, and are nil for their rows
+  - Columns optional in any file are optional
+  - int32 columns widen to int64, and float to double, if other files need it
+  - Other differences in the type or repetition of a column are errors
+
+Key/value metadata of all files is kept, with the first file's value of a key
+taking precedence. The output is written to a temporary file that replaces
+--output only once complete, so an input file may also be the output.
+
+For example:
+  - 'parquetry merge -o all.parquet 2024-*.parquet'
+  - 'parquetry merge -o all.parquet --compression zstd --row-group-size 100000 a.parquet b.parquet'
+`
+
+const splitHelp = `
+Rows are written in order to files named part-0.parquet, part-1.parquet, and
+so on, under --output. Each file has the schema and key/value metadata of the
+original, and holds up to:
+  - --rows n rows
+  - an equal share of the rows for --parts n files
+  - an estimated SIZE of rows for --size, from the average stored row size
+
+With --by, rows are instead written under a directory for each value of
+COLUMN, such as region=EU/part-0.parquet, and nil values under
+region=__HIVE_DEFAULT_PARTITION__. --rows, --parts, or --size then limit the
+files within each directory. Existing files of the same name are replaced.
+At most --open files are written at once; when another directory needs one,
+the file least recently written is finished, and that directory's later rows
+start its next file.
+
+For example:
+  - 'parquetry split -o parts --rows 1000000 big.parquet'
+  - 'parquetry split -o parts --size 128MiB --compression zstd big.parquet'
+  - 'parquetry split -o by-region --by region sales.parquet'
+`
+
+const rewriteHelp = `
+The rows of the input are copied unchanged to the output, which may be the
+same file, with new compression and layout. A report of the compressed size
+of each column, before and after, follows.
+
+Compression levels run from 1 to 9 for gzip and lz4, 1 to 11 for brotli, and
+1 to 22 for zstd. The zstd encoder has only four speeds, so levels 1 and 2
+compress alike, as do 3 to 5, 6 to 9, and 10 to 22. A row group size may be
+given as a number of rows, or as a size such as 128MiB, which is estimated
+from the input's average row size.
+
+With --dictionary auto, every column other than booleans is dictionary encoded
+until its dictionary reaches 1MiB; with on, dictionaries may grow without
+limit; and with off, no dictionaries are written. Rows sorted with --sort-by
+are recorded as sorted in the output's metadata. Bloom filters are written for
+each of a comma separated list of --bloom-filter columns, and --stats off
+omits the min and max of columns and pages.
+
+For example:
+  - 'parquetry rewrite --compression zstd --level 9 in.parquet out.parquet'
+  - 'parquetry rewrite --row-group-size 128MiB --sort-by ts a.parquet b.parquet'
+  - 'parquetry rewrite --bloom-filter user_id --stats off a.parquet b.parquet'
+`
+
+const viewHelp = `
+Rows are shown in a grid that scrolls with the keys below, reading each row
+group as it comes into view. Columns can be hidden and reordered, a filter
+typed after / applies as soon as it compiles, and panes show the schema and
+each field of the selected row, with nested maps and lists in full.
+
+Keys:
+  - j, k, space, b, g, G: next, previous, next page, previous page, first, last
+  - h, l: select the previous or next column
+  - <, >: move the selected column left or right
+  - x, a: hide the selected column, or show all columns in file order
+  - ':' n: jump to row n of the file, or the first matching row after it
+  - / FILTER: show only rows matching FILTER; esc restores the last filter
+  - s, enter: show or hide the schema or the selected row
+  - q: quit
+
+For example:
+  - 'parquetry view big.parquet'
+`
+
+const replHelp = `
+The files are opened once, then each command runs against them all. Filters
+added by where and shapes added by shape apply to the rows of later commands,
+each to the rows the one before it passes on, until undone or reset. Rows are
+printed as a table unless format changes it. Type help for the commands.
+
+In a terminal, earlier commands are recalled with the arrow keys, and tab
+completes commands, formats, and the columns of the rows. Otherwise commands
+are read from each line of stdin, stopping at the first that fails.
+
+For example:
+  - 'parquetry repl sales/'
+  - 'printf "where amount > 100\ncount\n" | parquetry repl sales.parquet'
+`
+
+const serveHelp = `
+The files, and any parquet files in the directories or matching the globs,
+are served over HTTP by their paths, found again at most every 10s so files
+added or changed later are seen:
+  - GET /files: each file with its rows and row groups
+  - GET /schema/NAME: the message, logical type, and columns of a file
+  - GET /meta/NAME: the metadata of a file, as 'meta --format json' prints it
+  - GET /rows/NAME: rows of a file, as jsonl unless format is json or csv
+
+Rows are filtered by the filter parameter, then reshaped by the shape
+parameter; offset skips that many rows that pass the filter, and limit caps
+those returned, 100 unless set and at most 100000. Errors are returned as JSON
+with the reason.
+
+Only this machine can connect unless --addr says otherwise; with an address
+such as :8080, anyone who can reach it may read every file served, as there
+is no authentication.
+
+For example:
+  - 'parquetry serve data/'
+  - 'parquetry serve --addr :8080 data/'
+  - 'curl "localhost:8080/rows/data/sales.parquet?filter=amount>100&limit=10"'
+`
+
+const pagesHelp = `
+Each page of each column chunk is listed with its type, encoding, compressed
+and uncompressed sizes in bytes, and number of values. Null counts come from
+v2 data page headers or the column index, and the bounds of data pages from
+the column index, when the file has one.
+
+A summary of each column follows, showing the size of its dictionary against
+the values encoded with it, and how many data pages fell back to another
+encoding, such as when the dictionary grew too large.
+
+For example:
+  - 'parquetry pages big.parquet'
+  - 'parquetry pages --column address.city big.parquet'
+`
+
+const bloomHelp = `
+Each value is looked up in the bloom filter of the column in each row group,
+printing the row groups that might contain it. A bloom filter can rule a value
+out, but not in, so a listed row group may still lack it. Row groups without a
+bloom filter for the column might contain any value, and are noted.
+
+Values are given as the column's physical type: the text of a string or binary
+column, or a number or boolean. Dates and timestamps are integers from their
+epoch.
+
+The filters of count, where, reshape, and sort use the same bloom filters to
+skip reading row groups where they compare a top-level column to a number or
+string with == or in, and rule out every value compared. Other commands read
+every row group.
+
+For example:
+  - 'parquetry bloom events.parquet user_id u123 u456'
+`
+
+const verifyHelp = `
+Each file is checked for its magic bytes and a footer that decodes, then each
+column chunk for page headers that decode, page checksums where they were
+written, and values that decode fully. The numbers of rows and values in each
+column chunk are compared to its metadata, as are its null count and its
+min_value and max_value statistics.
+
+Each problem is printed with the file, row group, column, and offset where it
+was found, and any problem fails the command.
+
+For example:
+  - 'parquetry verify incoming/*.parquet'
+`
+
 // once fixed...
 // Dates and timestamps can also be compared to times (as returned by date(…)).
 // Times can also be compaed to durations (as returned by duration(…)).
 
 func withWriter(format DataFormat, w io.Writer, do func(WriteFunc) error) error {
+	rw, err := newRowWriter(format, w)
+	if err != nil {
+		return err
+	}
+	return errors.Join(do(rw.Write), rw.Close())
+}
+
+// withBatchWriter is withWriter for batches of rows.
+func withBatchWriter(format DataFormat, w io.Writer, do func(BatchFunc) error) error {
+	rw, err := newRowWriter(format, w)
+	if err != nil {
+		return err
+	}
+	return errors.Join(do(rw.WriteBatch), rw.Close())
+}
+
+// rowWriter writes rows in a data format, one at a time or in batches.
+type rowWriter interface {
+	Write(v reflect.Value) error
+	WriteBatch(rows reflect.Value) error
+	Close() error
+}
+
+// mixesSchemas reports whether rows of different types may be written
+// together in format, as each row stands alone.
+func mixesSchemas(format DataFormat) bool {
+	switch format {
+	case "go", "json", "jsonl":
+		return true
+	}
+	return false
+}
+
+func newRowWriter(format DataFormat, w io.Writer) (rowWriter, error) {
 	switch format {
 	case "go":
-		return do(func(v reflect.Value) error {
-			_, err := fmt.Fprintf(w, "%+v\n", v)
-			return err
-		})
+		return &goWriter{w: bufio.NewWriter(w)}, nil
 	case "csv":
-		cw := &csvWriter{w: w}
-		err := do(cw.Write)
-		return errors.Join(err, cw.Close())
+		return &csvWriter{w: w}, nil
 	case "json":
-		jw := &jsonWriter{w: w}
-		err := do(jw.Write)
-		return errors.Join(err, jw.Close())
+		return &jsonWriter{w: w}, nil
 	case "jsonl":
-		enc := json.NewEncoder(w)
-		enc.SetEscapeHTML(false)
-		return do(func(v reflect.Value) error { return enc.Encode(v.Interface()) })
+		return newJSONLWriter(w), nil
+	case "parquet":
+		return &parquetWriter{w: w}, nil
+	case "table":
+		return newTableWriter(w, asciiTable), nil
+	case "box":
+		return newTableWriter(w, boxTable), nil
+	case "markdown":
+		return newTableWriter(w, markdownTable), nil
 	}
-	return fmt.Errorf("format %q: %w", format, errors.ErrUnsupported)
+	return nil, fmt.Errorf("format %q: %w", format, errors.ErrUnsupported)
 }
 
 type WriteFunc func(reflect.Value) error
@@ -290,76 +993,41 @@ func eachFile(files []string, do func(name string) error) error {
 	return nil
 }
 
-func withFile(name string, do func(*parquet.File) error) error {
-	f, err := os.Open(name)
+func (in *inputs) withFile(name string, do func(*parquet.File) error) error {
+	pf, closer, err := in.openFile(name)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	defer closer()
 
-	stat, err := f.Stat()
+	return do(pf)
+}
+
+// openFile opens name as a parquet file, returning a function to close it.
+func (in *inputs) openFile(name string) (*parquet.File, func() error, error) {
+	f, size, closer, err := in.open(name)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-
-	pf, err := parquet.OpenFile(f, stat.Size())
+	pf, err := parquet.OpenFile(f, size)
 	if err != nil {
-		return fmt.Errorf("%s: %w", name, err)
+		return nil, nil, errors.Join(fmt.Errorf("%s: %w", name, err), closer())
 	}
-
-	return do(pf)
+	return pf, closer, nil
 }
 
-func withReader(name string, do func(*parquetReader) error) error {
-	return withFile(name, func(pf *parquet.File) error {
+func (in *inputs) withReader(name string, do func(*parquetReader) error) error {
+	return in.withFile(name, func(pf *parquet.File) error {
 		pq := parquet.NewReader(pf)
 		defer pq.Close()
 		return do(pq)
 	})
 }
 
-func eachRow(pq *parquetReader, head, tail int64, rowType reflect.Type, do WriteFunc) error {
-	rows := pq.NumRows()
-	var start, stop int64 = 0, rows
-
-	switch {
-	case head != 0 && tail != 0:
-		return fmt.Errorf("only one of --head and --tail may be provided")
-	case head > 0:
-		stop = head
-	case head < 0:
-		start = -head
-	case tail > 0:
-		start = rows - tail
-	case tail < 0:
-		stop = rows + tail
-	}
-	if start < 0 {
-		start = 0
-	}
-	if stop > rows {
-		stop = rows
-	}
-	v, z := reflect.New(rowType), reflect.Zero(rowType)
-
-	if start > 0 {
-		if err := pq.SeekToRow(start); err != nil {
-			return err
-		}
-	}
-	for i := start; i < stop; i++ {
-		v.Elem().Set(z)
-		if err := pq.Read(v.Interface()); err != nil {
-			if err == io.EOF {
-				return nil
-			}
-			return err
-		}
-		if err := do(v.Elem()); err != nil {
-			return err
-		}
-	}
-	return nil
+// eachRow passes the rows of file selected by sel to do, reading them in
+// batches. Each row is reused for a later one, so do must not keep it.
+func eachRow(file parquet.FileView, sel rowSelection, rowType reflect.Type, do WriteFunc) error {
+	return eachBatch(file, sel, rowType, do.Rows())
 }
 
 type schemata struct {
@@ -397,9 +1065,21 @@ func (s schemata) logicalTypeFields(flds []parquet.Field, path []string) []refle
 	return sf
 }
 
+// fieldName returns an exported go field name for a parquet field name,
+// replacing any characters not valid in go identifiers with underscores.
+func fieldName(name string) string {
+	title := []rune(strings.ToTitle(name[:1]) + name[1:])
+	for i, r := range title {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			title[i] = '_'
+		}
+	}
+	return string(title)
+}
+
 func (s schemata) logicalTypeField(pf parquet.Field, path []string) reflect.StructField {
 	name := pf.Name()
-	title := strings.ToTitle(name[:1]) + name[1:]
+	title := fieldName(name)
 	sf := reflect.StructField{
 		Name: title,
 		Type: pf.GoType(),
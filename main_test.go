@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -23,6 +25,7 @@ func Test(t *testing.T) {
 	testscript.Run(t, testscript.Params{
 		Dir: "testdata",
 		Cmds: map[string]func(ts *testscript.TestScript, neg bool, args []string){
+			"starts3": startS3,
 			"trim": func(ts *testscript.TestScript, neg bool, args []string) {
 				remove := []byte{'\n'}
 				if len(args) == 2 {
@@ -62,3 +65,37 @@ func Test(t *testing.T) {
 		},
 	})
 }
+
+// startS3 serves the files of a script's work directory as the bucket named
+// test, from a stand-in for S3 that checks requests carry the signature
+// headers for the credentials it sets in the script's environment. The
+// signature itself is checked by TestSignV4.
+func startS3(ts *testscript.TestScript, neg bool, args []string) {
+	if neg || len(args) != 0 {
+		ts.Fatalf("usage: starts3")
+	}
+	const access, secret = "parquetry", "parquetry-secret"
+	work := ts.Getenv("WORK")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		switch {
+		case r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Content-Sha256") == "":
+			http.Error(w, "missing signed headers", http.StatusForbidden)
+			return
+		case !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+access+"/"):
+			http.Error(w, "missing signature", http.StatusForbidden)
+			return
+		}
+		key, ok := strings.CutPrefix(r.URL.Path, "/test/")
+		if !ok {
+			http.Error(w, "no such bucket", http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join(work, filepath.FromSlash(key)))
+	}))
+	ts.Defer(srv.Close)
+	ts.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	ts.Setenv("AWS_ACCESS_KEY_ID", access)
+	ts.Setenv("AWS_SECRET_ACCESS_KEY", secret)
+	ts.Setenv("AWS_REGION", "us-east-1")
+}
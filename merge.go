@@ -0,0 +1,392 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/compress/brotli"
+	"github.com/parquet-go/parquet-go/compress/gzip"
+	"github.com/parquet-go/parquet-go/compress/lz4"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+type Compression string
+
+// writeOptions control how parquet files are written.
+type writeOptions struct {
+	Output       string
+	RowGroupSize int64
+	Compression  Compression
+	Level        int // of compression, or 0 for the codec's default
+}
+
+func (o *writeOptions) writer(w io.Writer, schema *parquet.Schema, meta []format.KeyValue) *parquet.Writer {
+	return parquet.NewWriter(w, append(o.options(meta), o.schema(schema))...)
+}
+
+// schema returns schema with every column compressed per o, as the columns
+// of a file's schema otherwise keep the codec they were read with.
+func (o *writeOptions) schema(schema *parquet.Schema) *parquet.Schema {
+	codec := o.Compression.codec(o.Level)
+	return parquet.NewSchema(schema.Name(), mapLeaves(schema, func(leaf parquet.Node) parquet.Node {
+		return parquet.Compressed(leaf, codec)
+	}))
+}
+
+func (o *writeOptions) options(meta []format.KeyValue) []parquet.WriterOption {
+	opts := []parquet.WriterOption{
+		parquet.Compression(o.Compression.codec(o.Level)),
+		parquet.MaxRowsPerRowGroup(o.RowGroupSize),
+	}
+	for _, kv := range meta {
+		opts = append(opts, parquet.KeyValueMetadata(kv.Key, kv.Value))
+	}
+	return opts
+}
+
+func mergeFiles(ctx run.Context, merge *writeOptions, files []string, in *inputs) error {
+	files, err := expandFiles(files)
+	if err != nil {
+		return err
+	}
+	var schema parquet.Node
+	var name string
+	var meta []format.KeyValue
+	seen := map[string]string{}
+	differ := false
+	err = eachFile(files, func(file string) error {
+		return in.withFile(file, func(pf *parquet.File) error {
+			if schema == nil {
+				schema, name = pf.Schema(), pf.Schema().Name()
+			} else {
+				differ = differ || !parquet.EqualNodes(schema, pf.Schema())
+				g, err := mergeFields("", schema.Fields(), pf.Schema().Fields())
+				if err != nil {
+					return fmt.Errorf("%s: %w", file, err)
+				}
+				schema = g
+			}
+			for _, kv := range pf.Metadata().KeyValueMetadata {
+				prev, ok := seen[kv.Key]
+				switch {
+				case !ok:
+					seen[kv.Key] = file
+					meta = append(meta, kv)
+				case kv.Value != lookupKeyValue(meta, kv.Key):
+					fmt.Fprintf(ctx.Stderr, "%s: keeping metadata %s from %s\n", file, kv.Key, prev)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	target := parquet.NewSchema(name, schema)
+
+	return withOutput(ctx, merge.Output, func(w io.Writer) error {
+		if differ {
+			// An arrow schema would no longer describe the merged schema.
+			meta = slices.DeleteFunc(meta, func(kv format.KeyValue) bool { return kv.Key == "ARROW:schema" })
+		}
+		pw := merge.writer(w, target, meta)
+		err := eachFile(files, func(file string) error {
+			return in.withFile(file, func(pf *parquet.File) error {
+				conv, err := parquet.Convert(target, pf.Schema())
+				if err != nil {
+					return fmt.Errorf("%s: %w", file, err)
+				}
+				for _, rg := range pf.RowGroups() {
+					rows := parquet.ConvertRowGroup(rg, conv).Rows()
+					_, err := parquet.CopyRows(pw, rows)
+					if err = errors.Join(err, rows.Close()); err != nil {
+						return fmt.Errorf("%s: %w", file, err)
+					}
+				}
+				return nil
+			})
+		})
+		return errors.Join(err, pw.Close())
+	})
+}
+
+// mapLeaves returns node with each of its leaves replaced by f(leaf).
+func mapLeaves(node parquet.Node, f func(parquet.Node) parquet.Node) parquet.Node {
+	if node.Leaf() {
+		return f(node)
+	}
+	fields := make([]parquet.Field, len(node.Fields()))
+	for i, field := range node.Fields() {
+		fields[i] = &orderedField{Node: mapLeaves(field, f), name: field.Name(), index: i}
+	}
+	return withFields{Node: node, fields: fields}
+}
+
+// withFields replaces the fields of a group, keeping its repetition and any
+// logical type such as LIST or MAP.
+type withFields struct {
+	parquet.Node
+	fields []parquet.Field
+}
+
+func (n withFields) Fields() []parquet.Field { return n.fields }
+
+func lookupKeyValue(kvs []format.KeyValue, key string) string {
+	for _, kv := range kvs {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return ""
+}
+
+// codec returns the codec for c at level, which must be 0 or within c's
+// levels.
+func (c Compression) codec(level int) compress.Codec {
+	switch c {
+	case "snappy":
+		return &parquet.Snappy
+	case "gzip":
+		if level != 0 {
+			return &gzip.Codec{Level: level}
+		}
+		return &parquet.Gzip
+	case "zstd":
+		if level != 0 {
+			return &zstd.Codec{Level: zstdLevel(level)}
+		}
+		return &parquet.Zstd
+	case "lz4":
+		if level != 0 {
+			return &lz4.Codec{Level: lz4.Level1 << (level - 1)}
+		}
+		return &parquet.Lz4Raw
+	case "brotli":
+		if level != 0 {
+			return &brotli.Codec{Quality: level}
+		}
+		return &parquet.Brotli
+	}
+	return &parquet.Uncompressed
+}
+
+// zstdLevel maps a zstd level to the nearest of the encoder's speeds.
+func zstdLevel(level int) zstd.Level {
+	switch {
+	case level < 3:
+		return zstd.SpeedFastest
+	case level < 6:
+		return zstd.SpeedDefault
+	case level < 10:
+		return zstd.SpeedBetterCompression
+	}
+	return zstd.SpeedBestCompression
+}
+
+// levels returns the range of compression levels c accepts, if any.
+func (c Compression) levels() (lo, hi int, ok bool) {
+	switch c {
+	case "gzip":
+		return 1, 9, true
+	case "zstd":
+		return 1, 22, true
+	case "lz4":
+		return 1, 9, true
+	case "brotli":
+		return 1, 11, true
+	}
+	return 0, 0, false
+}
+
+func (c Compression) checkLevel(level int) error {
+	if level == 0 {
+		return nil
+	}
+	lo, hi, ok := c.levels()
+	switch {
+	case !ok:
+		return fmt.Errorf("compression %s has no levels", c)
+	case level < lo || level > hi:
+		return fmt.Errorf("compression %s: level %d is not from %d to %d", c, level, lo, hi)
+	}
+	return nil
+}
+
+// withOutput calls do with a writer for the named file, or stdout if name is
+// empty. Files are written under a temporary name, and only replace name if
+// do succeeds, so that an input can safely be overwritten. They keep the mode
+// of the file they replace, or are created like any other, subject to umask.
+func withOutput(ctx run.Context, name string, do func(io.Writer) error) error {
+	if name == "" || name == "-" {
+		return do(ctx.Stdout)
+	}
+	f, err := createTemp(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	if fi, serr := os.Stat(name); serr == nil {
+		err = f.Chmod(fi.Mode().Perm())
+	}
+	if err == nil {
+		err = do(f)
+	}
+	if err := errors.Join(err, f.Close()); err != nil {
+		return errors.Join(err, os.Remove(f.Name()))
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// createTemp creates a new file in dir like os.CreateTemp, but with the mode
+// os.Create gives, rather than 0600.
+func createTemp(dir string) (*os.File, error) {
+	for {
+		name := filepath.Join(dir, ".parquetry-"+strconv.FormatUint(rand.Uint64(), 36)+".parquet")
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+// mergeFields unifies the fields of two groups. Fields keep the order they
+// are first seen in, and those missing from either side become optional.
+func mergeFields(path string, a, b []parquet.Field) (orderedGroup, error) {
+	var g orderedGroup
+	add := func(name string, node parquet.Node) {
+		g = append(g, &orderedField{Node: node, name: name, index: len(g)})
+	}
+	for _, fa := range a {
+		fb := findField(b, fa.Name())
+		if fb == nil {
+			add(fa.Name(), missingNode(fa))
+			continue
+		}
+		node, err := mergeNodes(joinPath(path, fa.Name()), fa, fb)
+		if err != nil {
+			return nil, err
+		}
+		add(fa.Name(), node)
+	}
+	for _, fb := range b {
+		if findField(a, fb.Name()) == nil {
+			add(fb.Name(), missingNode(fb))
+		}
+	}
+	return g, nil
+}
+
+func findField(fields []parquet.Field, name string) parquet.Field {
+	for _, f := range fields {
+		if f.Name() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// missingNode returns node as it must be written when some files lack it.
+func missingNode(node parquet.Node) parquet.Node {
+	if node.Repeated() || node.Optional() {
+		return node
+	}
+	return parquet.Optional(node)
+}
+
+// mergeNodes unifies two nodes of the same column. Required columns stay
+// required only if they are required in both, and repeated columns must be
+// repeated in both.
+func mergeNodes(path string, a, b parquet.Node) (parquet.Node, error) {
+	if a.Repeated() != b.Repeated() {
+		return nil, fmt.Errorf("column %s: cannot merge repeated with non-repeated values", path)
+	}
+	var node parquet.Node
+	var err error
+	switch {
+	case a.Leaf() && b.Leaf():
+		node, err = mergeLeaves(path, a.Type(), b.Type())
+	case a.Leaf() != b.Leaf():
+		err = fmt.Errorf("column %s: cannot merge group with %s", path, leafOf(a, b).Type())
+	case a.Type().LogicalType() != nil || b.Type().LogicalType() != nil:
+		node = parquet.Required(a)
+		if !parquet.EqualNodes(node, parquet.Required(b)) {
+			err = fmt.Errorf("column %s: cannot merge differing %s", path, a.Type())
+		}
+	default:
+		node, err = mergeFields(path, a.Fields(), b.Fields())
+	}
+	switch {
+	case err != nil:
+		return nil, err
+	case a.Repeated():
+		return parquet.Repeated(node), nil
+	case a.Optional() || b.Optional():
+		return parquet.Optional(node), nil
+	}
+	return parquet.Required(node), nil
+}
+
+func leafOf(a, b parquet.Node) parquet.Node {
+	if a.Leaf() {
+		return a
+	}
+	return b
+}
+
+// mergeLeaves unifies two leaf types, widening int32 to int64 and float to
+// double.
+func mergeLeaves(path string, a, b parquet.Type) (parquet.Node, error) {
+	if parquet.EqualTypes(a, b) {
+		return parquet.Leaf(a), nil
+	}
+	ka, kb := a.Kind(), b.Kind()
+	switch {
+	case ka == parquet.Int32 && kb == parquet.Int64 || ka == parquet.Int64 && kb == parquet.Int32:
+		sa, oka := integerSign(a)
+		sb, okb := integerSign(b)
+		switch {
+		case !oka || !okb || sa != sb:
+		case a.LogicalType() == nil && b.LogicalType() == nil:
+			return parquet.Leaf(parquet.Int64Type), nil
+		case sa:
+			return parquet.Int(64), nil
+		default:
+			return parquet.Uint(64), nil
+		}
+	case ka == parquet.Float && kb == parquet.Double || ka == parquet.Double && kb == parquet.Float:
+		if a.LogicalType() == nil && b.LogicalType() == nil {
+			return parquet.Leaf(parquet.DoubleType), nil
+		}
+	}
+	return nil, fmt.Errorf("column %s: cannot merge %s with %s", path, a, b)
+}
+
+// integerSign reports whether t is a signed integer, and whether t is a plain
+// integer at all, rather than for example a date or decimal.
+func integerSign(t parquet.Type) (signed, ok bool) {
+	lt := t.LogicalType()
+	switch {
+	case lt == nil:
+		return true, true
+	case lt.Integer != nil:
+		return lt.Integer.IsSigned, true
+	}
+	return false, false
+}
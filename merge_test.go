@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mutility/cli/run"
+)
+
+func TestWithOutputMode(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) fs.FileMode {
+		t.Helper()
+		if err := withOutput(run.Context{}, name, func(w io.Writer) error {
+			_, err := io.WriteString(w, "rows")
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Mode().Perm()
+	}
+
+	// New files get the mode os.Create would give them.
+	probe, err := os.Create(filepath.Join(dir, "probe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe.Close()
+	fi, err := os.Stat(probe.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "new.parquet")
+	if got, want := write(name), fi.Mode().Perm(); got != want {
+		t.Errorf("new file mode %v, want %v", got, want)
+	}
+
+	// Replaced files keep their mode.
+	if err := os.Chmod(name, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if got := write(name); got != 0o640 {
+		t.Errorf("replaced file mode %v, want %v", got, fs.FileMode(0o640))
+	}
+}
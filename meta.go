@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+type MetaFormat string
+
+// fileMeta is the footer of a parquet file, as written by meta -f json or
+// yaml. Fields follow the names of the parquet thrift definitions, and those
+// absent from the footer are omitted.
+type fileMeta struct {
+	File             string         `json:"file" yaml:"file"`
+	Version          int32          `json:"version" yaml:"version"`
+	CreatedBy        string         `json:"created_by,omitempty" yaml:"created_by,omitempty"`
+	NumRows          int64          `json:"num_rows" yaml:"num_rows"`
+	Schema           []schemaMeta   `json:"schema" yaml:"schema"`
+	RowGroups        []rowGroupMeta `json:"row_groups" yaml:"row_groups"`
+	KeyValueMetadata []keyValueMeta `json:"key_value_metadata,omitempty" yaml:"key_value_metadata,omitempty"`
+}
+
+type schemaMeta struct {
+	Name           string `json:"name" yaml:"name"`
+	Type           string `json:"type,omitempty" yaml:"type,omitempty"`
+	TypeLength     *int32 `json:"type_length,omitempty" yaml:"type_length,omitempty"`
+	RepetitionType string `json:"repetition_type,omitempty" yaml:"repetition_type,omitempty"`
+	NumChildren    *int32 `json:"num_children,omitempty" yaml:"num_children,omitempty"`
+	ConvertedType  string `json:"converted_type,omitempty" yaml:"converted_type,omitempty"`
+	LogicalType    string `json:"logical_type,omitempty" yaml:"logical_type,omitempty"`
+	Scale          *int32 `json:"scale,omitempty" yaml:"scale,omitempty"`
+	Precision      *int32 `json:"precision,omitempty" yaml:"precision,omitempty"`
+	FieldID        int32  `json:"field_id,omitempty" yaml:"field_id,omitempty"`
+}
+
+type rowGroupMeta struct {
+	Ordinal             int16               `json:"ordinal" yaml:"ordinal"`
+	NumRows             int64               `json:"num_rows" yaml:"num_rows"`
+	FileOffset          int64               `json:"file_offset" yaml:"file_offset"`
+	TotalByteSize       int64               `json:"total_byte_size" yaml:"total_byte_size"`
+	TotalCompressedSize int64               `json:"total_compressed_size" yaml:"total_compressed_size"`
+	SortingColumns      []sortingColumnMeta `json:"sorting_columns,omitempty" yaml:"sorting_columns,omitempty"`
+	Columns             []columnChunkMeta   `json:"columns" yaml:"columns"`
+}
+
+type sortingColumnMeta struct {
+	Column     string `json:"column" yaml:"column"`
+	ColumnIdx  int32  `json:"column_idx" yaml:"column_idx"`
+	Descending bool   `json:"descending" yaml:"descending"`
+	NullsFirst bool   `json:"nulls_first" yaml:"nulls_first"`
+}
+
+type columnChunkMeta struct {
+	PathInSchema          string              `json:"path_in_schema" yaml:"path_in_schema"`
+	Type                  string              `json:"type" yaml:"type"`
+	Codec                 string              `json:"codec" yaml:"codec"`
+	Encodings             []string            `json:"encodings" yaml:"encodings"`
+	NumValues             int64               `json:"num_values" yaml:"num_values"`
+	TotalUncompressedSize int64               `json:"total_uncompressed_size" yaml:"total_uncompressed_size"`
+	TotalCompressedSize   int64               `json:"total_compressed_size" yaml:"total_compressed_size"`
+	DataPageOffset        int64               `json:"data_page_offset" yaml:"data_page_offset"`
+	DictionaryPageOffset  int64               `json:"dictionary_page_offset,omitempty" yaml:"dictionary_page_offset,omitempty"`
+	IndexPageOffset       int64               `json:"index_page_offset,omitempty" yaml:"index_page_offset,omitempty"`
+	Statistics            *statisticsMeta     `json:"statistics,omitempty" yaml:"statistics,omitempty"`
+	EncodingStats         []encodingStatsMeta `json:"encoding_stats,omitempty" yaml:"encoding_stats,omitempty"`
+	ColumnIndexOffset     int64               `json:"column_index_offset,omitempty" yaml:"column_index_offset,omitempty"`
+	ColumnIndexLength     int32               `json:"column_index_length,omitempty" yaml:"column_index_length,omitempty"`
+	OffsetIndexOffset     int64               `json:"offset_index_offset,omitempty" yaml:"offset_index_offset,omitempty"`
+	OffsetIndexLength     int32               `json:"offset_index_length,omitempty" yaml:"offset_index_length,omitempty"`
+	BloomFilterOffset     int64               `json:"bloom_filter_offset,omitempty" yaml:"bloom_filter_offset,omitempty"`
+	BloomFilterLength     int32               `json:"bloom_filter_length,omitempty" yaml:"bloom_filter_length,omitempty"`
+	KeyValueMetadata      []keyValueMeta      `json:"key_value_metadata,omitempty" yaml:"key_value_metadata,omitempty"`
+}
+
+// statisticsMeta holds a column chunk's statistics, with bounds shown as
+// their logical values.
+type statisticsMeta struct {
+	Min           *string `json:"min,omitempty" yaml:"min,omitempty"`
+	Max           *string `json:"max,omitempty" yaml:"max,omitempty"`
+	NullCount     int64   `json:"null_count" yaml:"null_count"`
+	DistinctCount int64   `json:"distinct_count,omitempty" yaml:"distinct_count,omitempty"`
+}
+
+type encodingStatsMeta struct {
+	PageType string `json:"page_type" yaml:"page_type"`
+	Encoding string `json:"encoding" yaml:"encoding"`
+	Count    int32  `json:"count" yaml:"count"`
+}
+
+type keyValueMeta struct {
+	Key   string `json:"key" yaml:"key"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// footerOf describes the footer of pf, whose logical row type is rowType.
+func footerOf(name string, pf *parquet.File, rowType reflect.Type) fileMeta {
+	m := pf.Metadata()
+	fm := fileMeta{
+		File:             name,
+		Version:          m.Version,
+		CreatedBy:        m.CreatedBy,
+		NumRows:          m.NumRows,
+		Schema:           make([]schemaMeta, len(m.Schema)),
+		RowGroups:        make([]rowGroupMeta, len(m.RowGroups)),
+		KeyValueMetadata: keyValuesOf(m.KeyValueMetadata),
+	}
+	for i, se := range m.Schema {
+		fm.Schema[i] = schemaMetaOf(se)
+	}
+	for i, rg := range m.RowGroups {
+		rgm := rowGroupMeta{
+			Ordinal:             rg.Ordinal,
+			NumRows:             rg.NumRows,
+			FileOffset:          rg.FileOffset,
+			TotalByteSize:       rg.TotalByteSize,
+			TotalCompressedSize: rg.TotalCompressedSize,
+			Columns:             make([]columnChunkMeta, len(rg.Columns)),
+		}
+		for _, sc := range rg.SortingColumns {
+			var column string
+			if int(sc.ColumnIdx) < len(rg.Columns) {
+				column = strings.Join(rg.Columns[sc.ColumnIdx].MetaData.PathInSchema, ".")
+			}
+			rgm.SortingColumns = append(rgm.SortingColumns, sortingColumnMeta{
+				Column:     column,
+				ColumnIdx:  sc.ColumnIdx,
+				Descending: sc.Descending,
+				NullsFirst: sc.NullsFirst,
+			})
+		}
+		for j, cc := range rg.Columns {
+			rgm.Columns[j] = columnChunkMetaOf(cc, rowType)
+		}
+		fm.RowGroups[i] = rgm
+	}
+	return fm
+}
+
+func schemaMetaOf(se format.SchemaElement) schemaMeta {
+	sm := schemaMeta{Name: se.Name, FieldID: se.FieldID}
+	if t, ok := se.Type.Get(); ok {
+		sm.Type = t.String()
+	}
+	if n, ok := se.TypeLength.Get(); ok {
+		sm.TypeLength = &n
+	}
+	if r, ok := se.RepetitionType.Get(); ok {
+		sm.RepetitionType = r.String()
+	}
+	if n, ok := se.NumChildren.Get(); ok {
+		sm.NumChildren = &n
+	}
+	if ct, ok := se.ConvertedType.Get(); ok {
+		if int(ct) < len(convertedTypes) {
+			sm.ConvertedType = convertedTypes[ct]
+		} else {
+			sm.ConvertedType = fmt.Sprint(int32(ct))
+		}
+	}
+	if lt, ok := se.LogicalType.Get(); ok {
+		sm.LogicalType = lt.String()
+	}
+	if n, ok := se.Scale.Get(); ok {
+		sm.Scale = &n
+	}
+	if n, ok := se.Precision.Get(); ok {
+		sm.Precision = &n
+	}
+	return sm
+}
+
+// convertedTypes names the deprecated converted types by value.
+var convertedTypes = []string{
+	"UTF8", "MAP", "MAP_KEY_VALUE", "LIST", "ENUM", "DECIMAL", "DATE",
+	"TIME_MILLIS", "TIME_MICROS", "TIMESTAMP_MILLIS", "TIMESTAMP_MICROS",
+	"UINT_8", "UINT_16", "UINT_32", "UINT_64", "INT_8", "INT_16", "INT_32", "INT_64",
+	"JSON", "BSON", "INTERVAL",
+}
+
+func columnChunkMetaOf(cc format.ColumnChunk, rowType reflect.Type) columnChunkMeta {
+	md := cc.MetaData
+	cm := columnChunkMeta{
+		PathInSchema:          strings.Join(md.PathInSchema, "."),
+		Type:                  md.Type.String(),
+		Codec:                 md.Codec.String(),
+		NumValues:             md.NumValues,
+		TotalUncompressedSize: md.TotalUncompressedSize,
+		TotalCompressedSize:   md.TotalCompressedSize,
+		DataPageOffset:        md.DataPageOffset,
+		DictionaryPageOffset:  md.DictionaryPageOffset,
+		IndexPageOffset:       md.IndexPageOffset,
+		ColumnIndexOffset:     cc.ColumnIndexOffset,
+		ColumnIndexLength:     cc.ColumnIndexLength,
+		OffsetIndexOffset:     cc.OffsetIndexOffset,
+		OffsetIndexLength:     cc.OffsetIndexLength,
+		BloomFilterOffset:     md.BloomFilterOffset,
+		BloomFilterLength:     md.BloomFilterLength,
+		KeyValueMetadata:      keyValuesOf(md.KeyValueMetadata),
+	}
+	for _, e := range md.Encoding {
+		cm.Encodings = append(cm.Encodings, e.String())
+	}
+	for _, es := range md.EncodingStats {
+		cm.EncodingStats = append(cm.EncodingStats, encodingStatsMeta{
+			PageType: es.PageType.String(),
+			Encoding: es.Encoding.String(),
+			Count:    es.Count,
+		})
+	}
+
+	st := md.Statistics
+	minValue, maxValue := st.MinValue, st.MaxValue
+	if minValue == nil && maxValue == nil {
+		minValue, maxValue = st.Min, st.Max
+	}
+	if minValue != nil || maxValue != nil || st.NullCount != 0 || st.DistinctCount != 0 {
+		kind := parquet.Kind(md.Type)
+		cm.Statistics = &statisticsMeta{
+			Min:           statText(rowType, md.PathInSchema, kind, minValue),
+			Max:           statText(rowType, md.PathInSchema, kind, maxValue),
+			NullCount:     st.NullCount,
+			DistinctCount: st.DistinctCount,
+		}
+	}
+	return cm
+}
+
+// statText shows a statistics bound as the logical value of the field at
+// path, or its physical value if that field cannot hold it.
+func statText(rowType reflect.Type, path []string, kind parquet.Kind, b []byte) *string {
+	if b == nil {
+		return nil
+	}
+	if size := physicalSize(kind); size > 0 && len(b) != size {
+		return nil
+	}
+	text := logicalText(rowType, path, kind.Value(b))
+	return &text
+}
+
+// physicalSize returns the size in bytes of a fixed size physical kind.
+func physicalSize(kind parquet.Kind) int {
+	switch kind {
+	case parquet.Boolean:
+		return 1
+	case parquet.Int32, parquet.Float:
+		return 4
+	case parquet.Int64, parquet.Double:
+		return 8
+	case parquet.Int96:
+		return 12
+	}
+	return 0
+}
+
+func keyValuesOf(kvs []format.KeyValue) []keyValueMeta {
+	var out []keyValueMeta
+	for _, kv := range kvs {
+		out = append(out, keyValueMeta{Key: kv.Key, Value: kv.Value})
+	}
+	return out
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/encoding/thrift"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// dictionaryUse summarizes how well a column's values were dictionary encoded.
+type dictionaryUse struct {
+	column       string
+	entries      int64 // values in dictionary pages
+	size         int64 // uncompressed size of dictionary pages
+	values       int64 // values in data pages
+	encodedPages int   // data pages encoded against the dictionary
+	dataPages    int
+}
+
+func printPages(ctx run.Context, column string, file string, typer *schemata, in *inputs) error {
+	return in.withFile(file, func(pf *parquet.File) error {
+		rowType := typer.LogicalTagged(pf.Schema())
+		var table bytes.Buffer
+		tw := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ROW GROUP\tCOLUMN\tPAGE\tTYPE\tENCODING\tCOMPRESSED\tUNCOMPRESSED\tVALUES\tNULLS\tMIN\tMAX")
+
+		var uses []*dictionaryUse
+		for i, rg := range pf.RowGroups() {
+			for j, cc := range rg.ColumnChunks() {
+				md := pf.Metadata().RowGroups[i].Columns[j].MetaData
+				path := strings.Join(md.PathInSchema, ".")
+				if column != "" && path != column && !strings.HasPrefix(path, column+".") {
+					continue
+				}
+				if len(uses) <= j {
+					uses = append(uses, make([]*dictionaryUse, j+1-len(uses))...)
+				}
+				if uses[j] == nil {
+					uses[j] = &dictionaryUse{column: path}
+				}
+				headers, err := readPageHeaders(pf, md)
+				if err != nil {
+					return fmt.Errorf("%s: row group %d column %s: %w", file, i, path, err)
+				}
+				var index parquet.ColumnIndex
+				if fcc, ok := cc.(*parquet.FileColumnChunk); ok {
+					index, _ = fcc.ColumnIndex()
+				}
+				printPageHeaders(tw, i, path, headers, index, rowType, md.PathInSchema, uses[j])
+			}
+		}
+		if column != "" && len(uses) == 0 {
+			return fmt.Errorf("%s: unknown column %q", file, column)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		// Pages without bounds would otherwise leave padding at line ends.
+		for line := range bytes.Lines(table.Bytes()) {
+			ctx.Stdout.Write(append(bytes.TrimRight(line, " \n"), '\n'))
+		}
+
+		fmt.Fprintln(ctx.Stdout)
+		for _, use := range uses {
+			if use != nil {
+				fmt.Fprintln(ctx.Stdout, use)
+			}
+		}
+		return nil
+	})
+}
+
+func printPageHeaders(w io.Writer, rowGroup int, path string, headers []pageHeader, index parquet.ColumnIndex, rowType reflect.Type, columnPath []string, use *dictionaryUse) {
+	data := 0
+	for page, h := range headers {
+		var encoding format.Encoding
+		var values, nulls int64 = 0, -1
+		dataPage := true
+		if d, ok := h.DictionaryPageHeader.Get(); ok {
+			encoding, values, dataPage = d.Encoding, int64(d.NumValues), false
+			use.entries += values
+			use.size += int64(h.UncompressedPageSize)
+		} else if d, ok := h.DataPageHeader.Get(); ok {
+			encoding, values = d.Encoding, int64(d.NumValues)
+		} else if d, ok := h.DataPageHeaderV2.Get(); ok {
+			encoding, values, nulls = d.Encoding, int64(d.NumValues), int64(d.NumNulls)
+		} else {
+			dataPage = false
+		}
+
+		minText, maxText, nullText := "", "", ""
+		if dataPage {
+			use.values += values
+			use.dataPages++
+			if encoding == format.RLEDictionary || encoding == format.PlainDictionary {
+				use.encodedPages++
+			}
+			if index != nil && data < index.NumPages() {
+				if nulls < 0 {
+					nulls = index.NullCount(data)
+				}
+				if !index.NullPage(data) {
+					minText = logicalText(rowType, columnPath, index.MinValue(data))
+					maxText = logicalText(rowType, columnPath, index.MaxValue(data))
+				}
+			}
+			data++
+		}
+		if nulls >= 0 {
+			nullText = fmt.Sprint(nulls)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\n",
+			rowGroup, path, page, h.Type, encoding, h.CompressedPageSize, h.UncompressedPageSize, values, nullText, minText, maxText)
+	}
+}
+
+func (u *dictionaryUse) String() string {
+	if u.entries == 0 {
+		return fmt.Sprintf("%s: no dictionary", u.column)
+	}
+	return fmt.Sprintf("%s: %d dictionary entries (%s) for %d values, %.1f values per entry; %d of %d data pages dictionary encoded",
+		u.column, u.entries, humanize.IBytes(uint64(u.size)), u.values, float64(u.values)/float64(u.entries), u.encodedPages, u.dataPages)
+}
+
+// pageHeader is the header of a page, and where the page is in its file.
+type pageHeader struct {
+	format.PageHeader
+	offset     int64 // of the header
+	dataOffset int64 // of the page data, after the header
+}
+
+// readPageHeaders reads the header of each page in a column chunk.
+func readPageHeaders(r io.ReaderAt, md format.ColumnMetaData) ([]pageHeader, error) {
+	start := md.DataPageOffset
+	if md.DictionaryPageOffset > 0 && md.DictionaryPageOffset < start {
+		start = md.DictionaryPageOffset
+	}
+	section := &countingReader{r: io.NewSectionReader(r, start, md.TotalCompressedSize)}
+	rbuf := bufio.NewReader(section)
+	decoder := thrift.NewDecoder(new(thrift.CompactProtocol).NewReader(rbuf))
+
+	pos := func() int64 { return section.n - int64(rbuf.Buffered()) }
+	var headers []pageHeader
+	for pos() < md.TotalCompressedSize {
+		h := pageHeader{offset: start + pos()}
+		if err := decoder.Decode(&h.PageHeader); err != nil {
+			return headers, err
+		}
+		h.dataOffset = start + pos()
+		if _, err := rbuf.Discard(int(h.CompressedPageSize)); err != nil {
+			return headers, errors.Join(errors.New("truncated page"), err)
+		}
+		headers = append(headers, h)
+	}
+	return headers, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm"
+	"github.com/parquet-go/parquet-go"
+)
+
+// groupMatch describes which rows of a row group can satisfy a filter.
+type groupMatch int8
+
+const (
+	matchSome groupMatch = iota // some rows may match; they must be read to tell
+	matchNone                   // no rows match
+	matchAll                    // every row matches
+)
+
+func (m groupMatch) not() groupMatch {
+	switch m {
+	case matchNone:
+		return matchAll
+	case matchAll:
+		return matchNone
+	}
+	return matchSome
+}
+
+func (m groupMatch) and(o groupMatch) groupMatch {
+	switch {
+	case m == matchNone || o == matchNone:
+		return matchNone
+	case m == matchAll && o == matchAll:
+		return matchAll
+	}
+	return matchSome
+}
+
+func (m groupMatch) or(o groupMatch) groupMatch {
+	switch {
+	case m == matchAll || o == matchAll:
+		return matchAll
+	case m == matchNone && o == matchNone:
+		return matchNone
+	}
+	return matchSome
+}
+
+// groupPruner decides from a row group's column statistics and bloom filters
+// whether any or all of its rows satisfy a filter.
+type groupPruner func(rg parquet.RowGroup) groupMatch
+
+// newGroupPruner analyzes filter for comparisons between fields and constants
+// that can be decided from column chunk min/max statistics. Each comparison is
+// evaluated by expr itself at the chunk's bounds, so the same logical type
+// conversions apply as when filtering rows. Equality with a number or string
+// is also checked against the chunk's bloom filter, if it has one. Anything it
+// cannot decide, such as comparisons between fields, repeated columns, or
+// chunks containing nulls or lacking statistics, may match some rows.
+func newGroupPruner(filter Filter, schema *parquet.Schema, rowType reflect.Type) (groupPruner, error) {
+	if filter == "" {
+		return func(parquet.RowGroup) groupMatch { return matchAll }, nil
+	}
+	tree, err := parser.Parse(string(filter))
+	if err != nil {
+		return nil, err
+	}
+	p := &pruneBuilder{schema: schema, rowType: rowType, options: filterOptions(rowType)}
+	return p.build(tree.Node), nil
+}
+
+type pruneBuilder struct {
+	schema  *parquet.Schema
+	rowType reflect.Type
+	options []expr.Option
+}
+
+func (p *pruneBuilder) build(node ast.Node) groupPruner {
+	switch n := node.(type) {
+	case *ast.BoolNode:
+		m := matchNone
+		if n.Value {
+			m = matchAll
+		}
+		return func(parquet.RowGroup) groupMatch { return m }
+	case *ast.UnaryNode:
+		if n.Operator == "not" || n.Operator == "!" {
+			inner := p.build(n.Node)
+			return func(rg parquet.RowGroup) groupMatch { return inner(rg).not() }
+		}
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "and", "&&":
+			left, right := p.build(n.Left), p.build(n.Right)
+			return func(rg parquet.RowGroup) groupMatch { return left(rg).and(right(rg)) }
+		case "or", "||":
+			left, right := p.build(n.Left), p.build(n.Right)
+			return func(rg parquet.RowGroup) groupMatch { return left(rg).or(right(rg)) }
+		case "<", "<=", ">", ">=":
+			if field, _, ok := p.fieldConst(n.Left, n.Right); ok {
+				return p.monotone(field, n.String())
+			}
+		case "==":
+			if field, value, ok := p.fieldConst(n.Left, n.Right); ok {
+				return p.equal(field, value)
+			}
+		case "!=":
+			if field, value, ok := p.fieldConst(n.Left, n.Right); ok {
+				eq := p.equal(field, value)
+				return func(rg parquet.RowGroup) groupMatch { return eq(rg).not() }
+			}
+		case "in":
+			array, isArray := n.Right.(*ast.ArrayNode)
+			if field, ok := p.field(n.Left); ok && isArray && isConstant(array) {
+				eqs := make([]groupPruner, len(array.Nodes))
+				for i, elem := range array.Nodes {
+					eqs[i] = p.equal(field, elem)
+				}
+				return func(rg parquet.RowGroup) groupMatch {
+					m := matchNone
+					for _, eq := range eqs {
+						m = m.or(eq(rg))
+					}
+					return m
+				}
+			}
+		}
+	case *ast.IdentifierNode, *ast.MemberNode:
+		if field, ok := p.field(node); ok {
+			return p.monotone(field, node.String())
+		}
+	}
+	return func(parquet.RowGroup) groupMatch { return matchSome }
+}
+
+// fieldConst returns the field and constant of a comparison in either order.
+func (p *pruneBuilder) fieldConst(left, right ast.Node) (pruneField, ast.Node, bool) {
+	if field, ok := p.field(left); ok && isConstant(right) {
+		return field, right, true
+	}
+	if field, ok := p.field(right); ok && isConstant(left) {
+		return field, left, true
+	}
+	return pruneField{}, nil, false
+}
+
+// pruneField is a non-repeated leaf column referenced by a filter.
+type pruneField struct {
+	source string
+	path   []string
+	leaf   parquet.LeafColumn
+}
+
+func (p *pruneBuilder) field(node ast.Node) (pruneField, bool) {
+	path, ok := fieldPath(node)
+	if !ok {
+		return pruneField{}, false
+	}
+	leaf, ok := p.schema.Lookup(path...)
+	if !ok || leaf.MaxRepetitionLevel > 0 {
+		return pruneField{}, false
+	}
+	if _, ok := reLookupType(p.rowType, strings.Join(path, ".")); !ok {
+		return pruneField{}, false
+	}
+	return pruneField{source: node.String(), path: path, leaf: leaf}, true
+}
+
+func fieldPath(node ast.Node) ([]string, bool) {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		return []string{n.Value}, true
+	case *ast.MemberNode:
+		prop, ok := n.Property.(*ast.StringNode)
+		if !ok || n.Optional || n.Method {
+			return nil, false
+		}
+		path, ok := fieldPath(n.Node)
+		return append(path, prop.Value), ok
+	}
+	return nil, false
+}
+
+// isConstant reports whether node refers to no fields of the row.
+func isConstant(node ast.Node) bool {
+	v := &fieldVisitor{}
+	ast.Walk(&node, v)
+	return !v.found
+}
+
+type fieldVisitor struct{ found bool }
+
+func (v *fieldVisitor) Visit(node *ast.Node) {
+	switch (*node).(type) {
+	case *ast.IdentifierNode, *ast.MemberNode, *ast.ChainNode, *ast.PointerNode, *ast.VariableDeclaratorNode:
+		v.found = true
+	}
+}
+
+// monotone prunes predicates that can only change once between the smallest
+// and largest values of field, so that if they agree at both bounds, they
+// agree for every row.
+func (p *pruneBuilder) monotone(field pruneField, predicate string) groupPruner {
+	prog, err := expr.Compile(predicate, p.options...)
+	if err != nil {
+		return func(parquet.RowGroup) groupMatch { return matchSome }
+	}
+	return func(rg parquet.RowGroup) groupMatch {
+		atMin, atMax, ok := p.evalBounds(rg, field, prog)
+		switch {
+		case !ok || atMin != atMax:
+			return matchSome
+		case atMin:
+			return matchAll
+		}
+		return matchNone
+	}
+}
+
+// equal prunes field == value: no rows match if the value is below the
+// smallest or above the largest; all rows match if both bounds equal it.
+// Otherwise, if the chunk has a bloom filter, it may rule the value out.
+func (p *pruneBuilder) equal(field pruneField, value ast.Node) groupPruner {
+	compile := func(op string) *vm.Program {
+		prog, _ := expr.Compile("("+field.source+") "+op+" ("+value.String()+")", p.options...)
+		return prog
+	}
+	lt, gt, eq := compile("<"), compile(">"), compile("==")
+	if lt == nil || gt == nil || eq == nil {
+		return func(parquet.RowGroup) groupMatch { return matchSome }
+	}
+	bounds := func(rg parquet.RowGroup) groupMatch {
+		if _, below, ok := p.evalBounds(rg, field, lt); !ok {
+			return matchSome
+		} else if below {
+			return matchNone
+		}
+		if above, _, _ := p.evalBounds(rg, field, gt); above {
+			return matchNone
+		}
+		if atMin, atMax, _ := p.evalBounds(rg, field, eq); atMin && atMax {
+			return matchAll
+		}
+		return matchSome
+	}
+	candidate, ok := p.physical(field, value, eq)
+	if !ok {
+		return bounds
+	}
+	return func(rg parquet.RowGroup) groupMatch {
+		if m := bounds(rg); m != matchSome || mayContain(rg, field.leaf.ColumnIndex, candidate) {
+			return m
+		}
+		return matchNone
+	}
+}
+
+// physical returns the value a column chunk's bloom filter would hold for
+// rows where field equals value. As a value may convert to its column in more
+// than one way, the result is used only if eq holds for it.
+func (p *pruneBuilder) physical(field pruneField, value ast.Node, eq *vm.Program) (parquet.Value, bool) {
+	prog, err := expr.Compile(value.String(), exprOptions(p.rowType)...)
+	if err != nil {
+		return parquet.Value{}, false
+	}
+	out, err := expr.Run(prog, reflect.New(p.rowType).Elem().Interface())
+	if err != nil {
+		return parquet.Value{}, false
+	}
+	pv, ok := physicalValue(field.leaf.Node.Type(), out)
+	if !ok {
+		return parquet.Value{}, false
+	}
+	match, ok := p.eval(field, eq, pv)
+	return pv, ok && match
+}
+
+// evalBounds runs prog with field set to the minimum and maximum values of its
+// column chunk in rg. It fails if the chunk lacks statistics or has nulls.
+func (p *pruneBuilder) evalBounds(rg parquet.RowGroup, field pruneField, prog *vm.Program) (atMin, atMax, ok bool) {
+	chunk, ok := rg.ColumnChunks()[field.leaf.ColumnIndex].(*parquet.FileColumnChunk)
+	if !ok || chunk.NullCount() > 0 {
+		return false, false, false
+	}
+	min, max, ok := chunk.Bounds()
+	if !ok {
+		return false, false, false
+	}
+	if atMin, ok = p.eval(field, prog, min); !ok {
+		return false, false, false
+	}
+	if atMax, ok = p.eval(field, prog, max); !ok {
+		return false, false, false
+	}
+	return atMin, atMax, true
+}
+
+// eval runs prog with field set to the physical value pv.
+func (p *pruneBuilder) eval(field pruneField, prog *vm.Program, pv parquet.Value) (result, ok bool) {
+	row := reflect.New(p.rowType).Elem()
+	if !setStat(row, field.path, pv) {
+		return false, false
+	}
+	out, err := expr.Run(prog, row.Interface())
+	if err != nil {
+		return false, false
+	}
+	result, ok = out.(bool)
+	return result, ok
+}
+
+// setStat stores a physical statistics value into the logical field at path.
+func setStat(v reflect.Value, path []string, pv parquet.Value) bool {
+	for _, step := range path {
+		if v.Kind() == reflect.Pointer {
+			v.Set(reflect.New(v.Type().Elem()))
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return false
+		}
+		if v = reValueField(v, step); !v.IsValid() {
+			return false
+		}
+	}
+	if v.Kind() == reflect.Pointer {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if pv.Kind() != parquet.Boolean {
+			return false
+		}
+		v.SetBool(pv.Boolean())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch pv.Kind() {
+		case parquet.Int32:
+			n = int64(pv.Int32())
+		case parquet.Int64:
+			n = pv.Int64()
+		default:
+			return false
+		}
+		if v.OverflowInt(n) {
+			return false
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		switch pv.Kind() {
+		case parquet.Int32:
+			n = uint64(uint32(pv.Int32()))
+		case parquet.Int64:
+			n = uint64(pv.Int64())
+		default:
+			return false
+		}
+		if v.OverflowUint(n) {
+			return false
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		switch pv.Kind() {
+		case parquet.Float:
+			v.SetFloat(float64(pv.Float()))
+		case parquet.Double:
+			v.SetFloat(pv.Double())
+		default:
+			return false
+		}
+	case reflect.String:
+		if k := pv.Kind(); k != parquet.ByteArray && k != parquet.FixedLenByteArray {
+			return false
+		}
+		v.SetString(string(pv.ByteArray()))
+	case reflect.Slice:
+		if k := pv.Kind(); v.Type().Elem().Kind() != reflect.Uint8 || k != parquet.ByteArray && k != parquet.FixedLenByteArray {
+			return false
+		}
+		v.SetBytes(slices.Clone(pv.ByteArray()))
+	case reflect.Array:
+		b := pv.ByteArray()
+		if v.Type().Elem().Kind() != reflect.Uint8 || pv.Kind() != parquet.FixedLenByteArray || v.Len() != len(b) {
+			return false
+		}
+		reflect.Copy(v, reflect.ValueOf(b))
+	default:
+		return false
+	}
+	return true
+}
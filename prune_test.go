@@ -0,0 +1,86 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestGroupPruner(t *testing.T) {
+	const some, none, all = matchSome, matchNone, matchAll
+	err := newInputs(nil).withFile("testdata/parquet/sorted.parquet", func(pf *parquet.File) error {
+		rowType := new(schemata).LogicalTagged(pf.Schema())
+		// row groups hold n in [1,2], [3,4], [5,6] with s in [e,f], [c,d], [a,b]
+		for filter, want := range map[Filter][]groupMatch{
+			"true":                    {all, all, all},
+			"n < 3":                   {all, none, none},
+			"3 > n":                   {all, none, none},
+			"n <= 4":                  {all, all, none},
+			"n == 3":                  {none, some, none},
+			"n != 3":                  {all, some, all},
+			"n in [1, 2, 6]":          {some, none, some},
+			`s >= "c"`:                {all, all, none},
+			`n > 2 and s < "d"`:       {none, some, all},
+			"not (n > 2) or false":    {all, none, none},
+			"n + 1 > 3":               {some, some, some},
+			"n == n":                  {some, some, some},
+			`s contains "a"`:          {some, some, some},
+			`n < 3 or s contains "a"`: {all, some, some},
+		} {
+			prune, err := newGroupPruner(filter, pf.Schema(), rowType)
+			if err != nil {
+				return err
+			}
+			var got []groupMatch
+			for _, rg := range pf.RowGroups() {
+				got = append(got, prune(rg))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("%q: got %v want %v", filter, got, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBloomPruner(t *testing.T) {
+	const some, none, all = matchSome, matchNone, matchAll
+	err := newInputs(nil).withFile("testdata/parquet/bloom.parquet", func(pf *parquet.File) error {
+		rowType := new(schemata).LogicalTagged(pf.Schema())
+		// row groups hold k in {1,4,7}, {2,5,8}, {3,6,9}, with n = 10k and
+		// user_id "uk", except a null in place of u8; only k lacks a bloom filter
+		for filter, want := range map[Filter][]groupMatch{
+			`user_id == "u5"`:            {none, some, none},
+			`"u5" == user_id`:            {none, some, none},
+			`user_id == "u10"`:           {none, none, none},
+			`user_id != "u5"`:            {all, some, all},
+			`user_id in ["u4", "u6"]`:    {some, none, some},
+			"n == 50":                    {none, some, none},
+			"n == 50.0":                  {none, some, none},
+			"n == 50.5":                  {some, some, some},
+			"n in [40, 80]":              {some, some, none},
+			"k == 5":                     {some, some, some},
+			`user_id == "u5" and k == 5`: {none, some, none},
+		} {
+			prune, err := newGroupPruner(filter, pf.Schema(), rowType)
+			if err != nil {
+				return err
+			}
+			var got []groupMatch
+			for _, rg := range pf.RowGroups() {
+				got = append(got, prune(rg))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("%q: got %v want %v", filter, got, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
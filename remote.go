@@ -0,0 +1,292 @@
+package main
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpReadAhead is the least a range request fetches, so that the small reads
+// of footers and pages do not each need a request.
+var httpReadAhead int64 = 1 << 20
+
+// httpCacheBlocks is the number of fetched ranges kept for reuse.
+const httpCacheBlocks = 8
+
+// httpClient fetches remote files. It gives up on servers that do not
+// connect or respond, as well as on each request that does not finish in time,
+// rather than waiting on them for ever.
+var httpClient = &http.Client{
+	Timeout: 5 * time.Minute,
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   8,
+	},
+}
+
+// emptySHA256 is the hash of an empty request body.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func isRemote(name string) bool {
+	return strings.HasPrefix(name, "s3://") || strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://")
+}
+
+// openRemote opens an s3:// or http(s):// URL for reading at random with
+// range requests.
+func openRemote(name string) (*httpReaderAt, error) {
+	r := &httpReaderAt{name: name, client: httpClient}
+	if path, ok := strings.CutPrefix(name, "s3://"); ok {
+		bucket, key, ok := strings.Cut(path, "/")
+		if !ok || bucket == "" || key == "" {
+			return nil, fmt.Errorf("%s: expected s3://bucket/key", name)
+		}
+		cfg := s3ConfigFromEnv()
+		target := cfg.url(bucket, key).String()
+		r.request = func(method string) (*http.Request, error) {
+			req, err := http.NewRequest(method, target, nil)
+			if err == nil {
+				cfg.sign(req, time.Now())
+			}
+			return req, err
+		}
+	} else {
+		r.request = func(method string) (*http.Request, error) {
+			return http.NewRequest(method, name, nil)
+		}
+	}
+
+	req, err := r.request(http.MethodHead)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", name, resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return nil, fmt.Errorf("%s: unknown size", name)
+	}
+	r.size = resp.ContentLength
+	return r, nil
+}
+
+// httpReaderAt reads a remote file with range requests, keeping the most
+// recently fetched ranges.
+type httpReaderAt struct {
+	name    string
+	client  *http.Client
+	request func(method string) (*http.Request, error)
+	size    int64
+
+	mu     sync.Mutex
+	blocks []httpBlock
+}
+
+type httpBlock struct {
+	off  int64
+	data []byte
+}
+
+func (r *httpReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), r.size)
+
+	// The lock is held only to look in and add to the cache, so that reads
+	// from several goroutines fetch at once.
+	r.mu.Lock()
+	i := slices.IndexFunc(r.blocks, func(b httpBlock) bool {
+		return b.off <= off && end <= b.off+int64(len(b.data))
+	})
+	var b httpBlock
+	if i >= 0 {
+		b = r.blocks[i]
+	}
+	r.mu.Unlock()
+	if i < 0 {
+		var err error
+		if b, err = r.fetch(off, min(max(end, off+httpReadAhead), r.size)); err != nil {
+			return 0, err
+		}
+		r.mu.Lock()
+		if len(r.blocks) == httpCacheBlocks {
+			r.blocks = r.blocks[1:]
+		}
+		r.blocks = append(r.blocks, b)
+		r.mu.Unlock()
+	}
+	n := copy(p, b.data[off-b.off:end-b.off])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *httpReaderAt) fetch(off, end int64) (httpBlock, error) {
+	req, err := r.request(http.MethodGet)
+	if err != nil {
+		return httpBlock{}, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end-1))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return httpBlock{}, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// The server ignored the range, so skip to it.
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			return httpBlock{}, fmt.Errorf("%s: %w", r.name, err)
+		}
+	default:
+		return httpBlock{}, fmt.Errorf("%s: %s", r.name, resp.Status)
+	}
+	data := make([]byte, end-off)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return httpBlock{}, fmt.Errorf("%s: %w", r.name, err)
+	}
+	return httpBlock{off: off, data: data}, nil
+}
+
+// s3Config locates and signs requests to S3 or a compatible server, per the
+// usual AWS environment variables.
+type s3Config struct {
+	endpoint     string // path style when set, for compatible servers
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func s3ConfigFromEnv() s3Config {
+	return s3Config{
+		endpoint:     cmp.Or(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")),
+		region:       cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+func (c s3Config) url(bucket, key string) *url.URL {
+	path := "/" + key
+	u := &url.URL{Scheme: "https", Host: bucket + ".s3." + c.region + ".amazonaws.com"}
+	if c.endpoint != "" {
+		if e, err := url.Parse(c.endpoint); err == nil {
+			u.Scheme, u.Host = e.Scheme, e.Host
+			path = strings.TrimSuffix(e.Path, "/") + "/" + bucket + path
+		}
+	}
+	u.Path, u.RawPath = path, awsEscape(path)
+	return u
+}
+
+// sign adds AWS signature version 4 headers to req, unless no credentials are
+// configured.
+func (c s3Config) sign(req *http.Request, now time.Time) {
+	if c.accessKey == "" {
+		return
+	}
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+	signV4(req, "s3", c.region, c.accessKey, c.secretKey, now)
+}
+
+// signV4 signs req with AWS signature version 4, covering its host and any
+// x-amz-* headers.
+func signV4(req *http.Request, service, region, accessKey, secretKey string, now time.Time) {
+	stamp := now.UTC().Format("20060102T150405Z")
+	date := stamp[:8]
+	req.Header.Set("X-Amz-Date", stamp)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		if name := strings.ToLower(name); strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonical strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonical, "%s:%s\n", name, headers[name])
+	}
+	signed := strings.Join(names, ";")
+
+	payload := req.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		payload = emptySHA256
+	}
+	request := strings.Join([]string{
+		req.Method,
+		awsEscape(req.URL.Path),
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonical.String(),
+		signed,
+		payload,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	hash := sha256.Sum256([]byte(request))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request", toSign} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signed, hex.EncodeToString(key)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape percent-encodes a path as AWS expects, leaving only slashes and
+// unreserved characters.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestSignV4(t *testing.T) {
+	// get-vanilla from the AWS signature version 4 test suite.
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	signV4(req, "service", "us-east-1", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", now)
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestS3URL(t *testing.T) {
+	cfg := s3Config{region: "eu-west-1"}
+	if got, want := cfg.url("b", "region=EU/a b.parquet").String(), "https://b.s3.eu-west-1.amazonaws.com/region%3DEU/a%20b.parquet"; got != want {
+		t.Errorf("url: got %s, want %s", got, want)
+	}
+	cfg.endpoint = "http://localhost:9000"
+	if got, want := cfg.url("b", "k.parquet").String(), "http://localhost:9000/b/k.parquet"; got != want {
+		t.Errorf("url: got %s, want %s", got, want)
+	}
+}
+
+func TestHTTPReaderAt(t *testing.T) {
+	defer func(n int64) { httpReadAhead = n }(httpReadAhead)
+	httpReadAhead = 64
+
+	name := filepath.Join("testdata", "parquet", "sales.parquet")
+	stat, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetched atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sales.parquet" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+			t.Errorf("GET without Range")
+		}
+		cw := &countingWriter{ResponseWriter: w}
+		http.ServeFile(cw, r, name)
+		fetched.Add(cw.n)
+	}))
+	defer srv.Close()
+
+	r, err := openRemote(srv.URL + "/sales.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.size != stat.Size() {
+		t.Fatalf("size: got %d, want %d", r.size, stat.Size())
+	}
+	pf, err := parquet.OpenFile(r, r.size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := pf.NumRows(); n != 5 {
+		t.Errorf("rows: got %d, want 5", n)
+	}
+	if n := fetched.Load(); n >= stat.Size() {
+		t.Errorf("fetched %d of %d bytes to read the footer", n, stat.Size())
+	}
+
+	if _, err := openRemote(srv.URL + "/missing.parquet"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("missing: got %v", err)
+	}
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+	"golang.org/x/term"
+)
+
+// replCommands are the commands of the repl, in the order help lists them.
+var replCommands = []string{"schema", "head", "count", "where", "shape", "stages", "undo", "reset", "format", "files", "help", "quit"}
+
+// replFormats are the formats the repl can print rows in.
+var replFormats = []string{"table", "box", "markdown", "go", "csv", "json", "jsonl"}
+
+const replUsage = `Commands:
+  schema          Print the schema of the rows, after any shapes
+  head [n]        Print the first n rows, or 10
+  count           Count the rows
+  where FILTER    Keep only rows matching FILTER
+  shape SHAPE     Transform rows into SHAPE
+  stages          List the filters and shapes applied, in order
+  undo            Remove the last filter or shape
+  reset           Remove every filter and shape
+  format [FMT]    Print or set the format of rows: table, box, markdown, go, csv, json, or jsonl
+  files           List the files and their rows
+  help            Print this help
+  quit            Leave
+`
+
+func runRepl(ctx run.Context, files []string, typer *schemata, in *inputs) error {
+	files, err := expandFiles(files)
+	if err != nil {
+		return err
+	}
+	r := &repl{typer: typer, format: "table"}
+	defer r.close()
+	for _, name := range files {
+		pf, closer, err := in.openFile(name)
+		if err != nil {
+			return err
+		}
+		r.files = append(r.files, replFile{name: name, file: pf, close: closer})
+	}
+
+	stdin, ok := ctx.Stdin.(*os.File)
+	out, ok2 := ctx.Stdout.(*os.File)
+	if ok && ok2 && term.IsTerminal(int(stdin.Fd())) && term.IsTerminal(int(out.Fd())) {
+		return r.interactive(stdin, out, ctx.Stderr)
+	}
+	return r.script(ctx.Stdin, ctx.Stdout)
+}
+
+// repl runs commands against files it keeps open, applying the filters and
+// shapes its commands have added, in order, to the rows of each.
+type repl struct {
+	typer  *schemata
+	files  []replFile
+	stages []replStage
+	format DataFormat
+}
+
+type replFile struct {
+	name  string
+	file  *parquet.File
+	close func() error
+}
+
+// replStage is a filter or a shape.
+type replStage struct {
+	filter Filter
+	shape  Shape
+}
+
+func (s replStage) String() string {
+	if s.shape != "" {
+		return "shape " + string(s.shape)
+	}
+	return "where " + string(s.filter)
+}
+
+func (r *repl) close() {
+	for _, f := range r.files {
+		f.close()
+	}
+}
+
+// script runs each line of in as a command, stopping at the first error.
+func (r *repl) script(in io.Reader, out io.Writer) error {
+	lines := bufio.NewScanner(in)
+	for lines.Scan() {
+		if quit, err := r.run(lines.Text(), out); err != nil || quit {
+			return err
+		}
+	}
+	return lines.Err()
+}
+
+// interactive reads commands from a terminal with history and completion,
+// reporting errors and carrying on.
+func (r *repl) interactive(in, out *os.File, stderr io.Writer) error {
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{in, out}, "parquetry> ")
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		line, pos, matches := r.complete(line, pos)
+		if len(matches) > 1 {
+			fmt.Fprintln(t, strings.Join(matches, "  "))
+		}
+		return line, pos, true
+	}
+	for {
+		state, err := term.MakeRaw(int(in.Fd()))
+		if err != nil {
+			return err
+		}
+		if width, height, err := term.GetSize(int(out.Fd())); err == nil {
+			t.SetSize(width, height)
+		}
+		line, err := t.ReadLine()
+		term.Restore(int(in.Fd()), state)
+		if err == io.EOF {
+			fmt.Fprintln(out)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		quit, err := r.run(line, out)
+		if err != nil {
+			fmt.Fprintln(stderr, "error:", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// run runs a command, reporting whether it was quit.
+func (r *repl) run(line string, out io.Writer) (bool, error) {
+	cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+	switch cmd {
+	case "":
+	case "schema":
+		return false, r.schema(out)
+	case "head":
+		n := 10
+		if arg != "" {
+			var err error
+			if n, err = strconv.Atoi(arg); err != nil || n < 0 {
+				return false, fmt.Errorf("head %q: want a number of rows", arg)
+			}
+		}
+		return false, r.head(n, out)
+	case "count":
+		return false, r.count(out)
+	case "where":
+		return false, r.push(replStage{filter: Filter(arg)}, arg)
+	case "shape":
+		return false, r.push(replStage{shape: Shape(arg)}, arg)
+	case "stages":
+		for i, s := range r.stages {
+			fmt.Fprintf(out, "%d: %s\n", i+1, s)
+		}
+	case "undo":
+		if len(r.stages) == 0 {
+			return false, fmt.Errorf("no filter or shape to undo")
+		}
+		r.stages = r.stages[:len(r.stages)-1]
+	case "reset":
+		r.stages = nil
+	case "format":
+		if arg == "" {
+			fmt.Fprintln(out, r.format)
+		} else if slices.Contains(replFormats, arg) {
+			r.format = DataFormat(arg)
+		} else {
+			return false, fmt.Errorf("format %q: want one of %s", arg, strings.Join(replFormats, ", "))
+		}
+	case "files":
+		for _, f := range r.files {
+			fmt.Fprintf(out, "%s: %d rows\n", f.name, f.file.NumRows())
+		}
+	case "help":
+		fmt.Fprint(out, replUsage)
+	case "quit", "exit":
+		return true, nil
+	default:
+		if strings.HasPrefix(cmd, "#") {
+			return false, nil
+		}
+		return false, fmt.Errorf("unknown command %q; try help", cmd)
+	}
+	return false, nil
+}
+
+// push adds a filter or shape, if it applies to the rows of every file.
+func (r *repl) push(s replStage, arg string) error {
+	if arg == "" {
+		return fmt.Errorf("%s what?", strings.TrimSpace(s.String()))
+	}
+	r.stages = append(r.stages, s)
+	for _, f := range r.files {
+		rowType, _ := r.rowType(f)
+		if _, _, err := r.stage(rowType, func(reflect.Value) error { return nil }); err != nil {
+			r.stages = r.stages[:len(r.stages)-1]
+			if len(r.files) > 1 {
+				err = fmt.Errorf("%s: %w", f.name, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// rowType returns the type of the rows read from f, and how to fill in the
+// values of its partitions.
+func (r *repl) rowType(f replFile) (reflect.Type, partitionFill) {
+	return r.typer.PartitionedTagged(r.typer.LogicalTagged(f.file.Schema()), f.name)
+}
+
+// stage wraps write with the stages, in order, for rows of rowType. It
+// returns the type of the rows passed to write.
+func (r *repl) stage(rowType reflect.Type, write BatchFunc) (BatchFunc, reflect.Type, error) {
+	types := []reflect.Type{rowType}
+	for _, s := range r.stages {
+		t := types[len(types)-1]
+		if s.shape != "" {
+			// reshapeBatch reports unknown fields that reshapeType does not.
+			if _, err := reshapeBatch(s.shape, t, write); err != nil {
+				return nil, nil, err
+			}
+			var err error
+			if t, err = reshapeType(s.shape, t); err != nil {
+				return nil, nil, err
+			}
+		}
+		types = append(types, t)
+	}
+	for i, s := range slices.Backward(r.stages) {
+		var err error
+		if s.shape != "" {
+			write, err = reshapeBatch(s.shape, types[i], write)
+		} else {
+			write, err = filterBatch(s.filter, types[i], write)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return write, types[len(types)-1], nil
+}
+
+// rows passes the rows of each file through the stages to write.
+func (r *repl) rows(write BatchFunc) error {
+	var outType reflect.Type
+	for _, f := range r.files {
+		rowType, fill := r.rowType(f)
+		staged, t, err := r.stage(rowType, write)
+		if err != nil {
+			return err
+		}
+		if outType == nil {
+			outType = t
+		} else if t != outType {
+			return fmt.Errorf("%s: schema differs from %s", f.name, r.files[0].name)
+		}
+		if err := eachBatch(f.file, rowSelection{}, rowType, fill.Batch(staged)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *repl) head(n int, out io.Writer) error {
+	if n == 0 {
+		return nil
+	}
+	return withBatchWriter(r.format, out, func(write BatchFunc) error {
+		err := r.rows(func(rows reflect.Value) error {
+			k := min(rows.Len(), n)
+			if err := write(rows.Slice(0, k)); err != nil {
+				return err
+			}
+			if n -= k; n == 0 {
+				return errLimit
+			}
+			return nil
+		})
+		if errors.Is(err, errLimit) {
+			return nil
+		}
+		return err
+	})
+}
+
+// count counts the rows the stages pass on, or without any filters, the rows
+// in the metadata of the files.
+func (r *repl) count(out io.Writer) error {
+	var n int64
+	if !slices.ContainsFunc(r.stages, func(s replStage) bool { return s.filter != "" }) {
+		for _, f := range r.files {
+			n += f.file.NumRows()
+		}
+	} else if err := r.rows(func(rows reflect.Value) error {
+		n += int64(rows.Len())
+		return nil
+	}); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out, n)
+	return err
+}
+
+// schema prints the fields of the rows the stages pass on, for each file if
+// they differ.
+func (r *repl) schema(out io.Writer) error {
+	types := make([]reflect.Type, len(r.files))
+	for i, f := range r.files {
+		rowType, _ := r.rowType(f)
+		_, t, err := r.stage(rowType, func(reflect.Value) error { return nil })
+		if err != nil {
+			return err
+		}
+		types[i] = t
+	}
+	if len(types) > 0 && !slices.ContainsFunc(types, func(t reflect.Type) bool { return t != types[0] }) {
+		types = types[:1]
+	}
+	for i, t := range types {
+		indent := ""
+		if len(types) > 1 {
+			fmt.Fprintln(out, r.files[i].name+":")
+			indent = "  "
+		}
+		for _, line := range schemaLines(t, columnNames(t), indent) {
+			if _, err := fmt.Fprintln(out, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// complete completes the word before pos in line: a command if it is the
+// first, a format after format, or else a column of the rows the stages pass
+// on. It returns the line and position after completing as far as every
+// match agrees, and the matches.
+func (r *repl) complete(line string, pos int) (string, int, []string) {
+	start := strings.LastIndexFunc(line[:pos], func(c rune) bool {
+		return c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	}) + 1
+	word := line[start:pos]
+
+	var words []string
+	cmd, _, _ := strings.Cut(strings.TrimSpace(line[:start]), " ")
+	switch {
+	case strings.TrimSpace(line[:start]) == "":
+		words = replCommands
+	case cmd == "format":
+		words = replFormats
+	case len(r.files) > 0:
+		rowType, _ := r.rowType(r.files[0])
+		if _, t, err := r.stage(rowType, func(reflect.Value) error { return nil }); err == nil {
+			words = columnNames(t)
+		}
+	}
+
+	var matches []string
+	for _, w := range words {
+		if strings.HasPrefix(w, word) {
+			matches = append(matches, w)
+		}
+	}
+	if len(matches) == 0 {
+		return line, pos, nil
+	}
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 {
+		common += " "
+	}
+	return line[:start] + common + line[pos:], start + len(common), matches
+}
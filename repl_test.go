@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func openRepl(t *testing.T, names ...string) *repl {
+	t.Helper()
+	r := &repl{typer: new(schemata), format: "table"}
+	t.Cleanup(r.close)
+	for _, name := range names {
+		pf, closer, err := newInputs(nil).openFile("testdata/parquet/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.files = append(r.files, replFile{name: name, file: pf, close: closer})
+	}
+	return r
+}
+
+func TestReplComplete(t *testing.T) {
+	r := openRepl(t, "pages.parquet")
+	for _, tt := range []struct {
+		line    string
+		pos     int
+		want    string
+		wantPos int
+		matches []string
+	}{
+		{"he", 2, "he", 2, []string{"head", "help"}},
+		{"s", 1, "s", 1, []string{"schema", "shape", "stages"}},
+		{"sc", 2, "schema ", 7, []string{"schema"}},
+		{"format j", 8, "format json", 11, []string{"json", "jsonl"}},
+		{"where co", 8, "where co", 8, []string{"color", "code"}},
+		{"where col == 1", 9, "where color  == 1", 12, []string{"color"}},
+		{"where id > 3 && no", 18, "where id > 3 && note ", 21, []string{"note"}},
+		{"where zz", 8, "where zz", 8, nil},
+	} {
+		got, pos, matches := r.complete(tt.line, tt.pos)
+		if got != tt.want || pos != tt.wantPos || !slices.Equal(matches, tt.matches) {
+			t.Errorf("complete(%q, %d) = %q, %d, %v; want %q, %d, %v", tt.line, tt.pos, got, pos, matches, tt.want, tt.wantPos, tt.matches)
+		}
+	}
+
+	// columns follow shapes
+	if _, err := r.run("shape id AS key, note", new(strings.Builder)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, matches := r.complete("where ", 6); !slices.Equal(matches, []string{"key", "note"}) {
+		t.Errorf("after shape got %v", matches)
+	}
+}
+
+func TestReplStages(t *testing.T) {
+	r := openRepl(t, "pages.parquet")
+	var out strings.Builder
+	for _, cmd := range []string{"where id < 3", "shape nope", "where nope", "stages", "count"} {
+		r.run(cmd, &out)
+	}
+	if got, want := out.String(), "1: where id < 3\n3\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"sync"
@@ -17,6 +18,10 @@ func reshapeWrite(shape Shape, rowType reflect.Type, w WriteFunc) (WriteFunc, er
 	if err != nil {
 		return w, err
 	}
+	// planShape reports unknown fields that Eval would panic on.
+	if _, err := planShape(reshape.fields, rowType); err != nil {
+		return w, err
+	}
 	return func(v reflect.Value) error {
 		r, err := reshape.Eval(v)
 		if err != nil {
@@ -26,6 +31,107 @@ func reshapeWrite(shape Shape, rowType reflect.Type, w WriteFunc) (WriteFunc, er
 	}, nil
 }
 
+// reshapeBatch returns a BatchFunc that passes the rows of each batch,
+// reshaped, on to w. The reshaped batch is reused for each batch.
+func reshapeBatch(shape Shape, rowType reflect.Type, w BatchFunc) (BatchFunc, error) {
+	if shape == "" {
+		return w, nil
+	}
+	reshape, err := ParseShape(shape, rowType)
+	if err != nil {
+		return w, err
+	}
+	plan, err := planShape(reshape.fields, rowType)
+	if err != nil {
+		return w, err
+	}
+	out := reflect.MakeSlice(reflect.SliceOf(reshape.Type()), 0, 0)
+	return func(rows reflect.Value) error {
+		n := rows.Len()
+		if out.Cap() < n {
+			out = reflect.MakeSlice(out.Type(), n, n)
+		}
+		out = out.Slice(0, n)
+		for i := range n {
+			plan.set(out.Index(i), rows.Index(i))
+		}
+		return w(out)
+	}, nil
+}
+
+// rePlan reshapes values by field index, resolved once for their type.
+type rePlan []rePlanField
+
+type rePlanField struct {
+	index []int  // of the source field; empty for the whole value
+	group rePlan // of a group's fields
+}
+
+func planShape(fields []reValue, t reflect.Type) (rePlan, error) {
+	plan := make(rePlan, len(fields))
+	for i, f := range fields {
+		switch f := f.(type) {
+		case reField:
+			index, err := reIndexOf(t, f.Source)
+			if err != nil {
+				return nil, err
+			}
+			plan[i].index = index
+		case reStruct:
+			group, err := planShape(f.Fields, t)
+			if err != nil {
+				return nil, err
+			}
+			plan[i].group = group
+		}
+	}
+	return plan, nil
+}
+
+// reIndexOf returns the index of source in t, stopping like reValueOf at the
+// first value that is not a struct.
+func reIndexOf(t reflect.Type, source string) ([]int, error) {
+	var index []int
+	for rest := source; rest != "" && t.Kind() == reflect.Struct; {
+		var step string
+		step, rest, _ = strings.Cut(rest, ".")
+		fld, ok := reTypeField(t, step)
+		if !ok {
+			return nil, fmt.Errorf("shape: unknown field %q", source)
+		}
+		index = append(index, fld.Index...)
+		t = fld.Type
+	}
+	return index, nil
+}
+
+// set fills the reshaped dst from src.
+func (p rePlan) set(dst, src reflect.Value) {
+	for i, f := range p {
+		if f.group != nil {
+			f.group.set(dst.Field(i), src)
+		} else {
+			dst.Field(i).Set(src.FieldByIndex(f.index))
+		}
+	}
+}
+
+// reshapeType returns the type of rows written by reshapeWrite.
+func reshapeType(shape Shape, rowType reflect.Type) (reflect.Type, error) {
+	if shape == "" {
+		return rowType, nil
+	}
+	reshape, err := ParseShape(shape, rowType)
+	if err != nil {
+		return nil, err
+	}
+	// planShape reports unknown fields that Type would panic on.
+	if _, err := planShape(reshape.fields, rowType); err != nil {
+		return nil, err
+	}
+	return reshape.Type(), nil
+}
+
 var (
 	reshapeParserOnce sync.Once
 	reshapeParser     *participle.Parser[reFields]
@@ -122,7 +228,7 @@ func reStructFor(fields []reValue, t reflect.Type) reflect.Type {
 		sf[i].Type = f.Type(t)
 		if len(name) > 0 && name[:1] != strings.ToUpper(name[:1]) {
 			sf[i].Name = strings.ToUpper(name[:1]) + name[1:]
-			sf[i].Tag = reflect.StructTag(`parquet:"` + name + `" json:"` + name + `"`)
+			sf[i].Tag = reflect.StructTag(`parquet:"` + name + `" json:"` + name + `" expr:"` + name + `"`)
 		}
 	}
 	return reflect.StructOf(sf)
@@ -185,18 +291,21 @@ func reValueOf(v reflect.Value, source string) reflect.Value {
 
 func reTypeField(t reflect.Type, name string) (reflect.StructField, bool) {
 	for f, F := 0, t.NumField(); f < F; f++ {
-		fld := t.Field(f)
-		if n, _, _ := strings.Cut(fld.Tag.Get("parquet"), ","); n != "" {
-			if n == name {
-				return fld, true
-			}
-		} else if fld.Name == name {
+		if fld := t.Field(f); reFieldName(fld) == name {
 			return fld, true
 		}
 	}
 	return reflect.StructField{}, false
 }
 
+// reFieldName returns the parquet name of a field, or its go name if untagged.
+func reFieldName(fld reflect.StructField) string {
+	if n, _, _ := strings.Cut(fld.Tag.Get("parquet"), ","); n != "" {
+		return n
+	}
+	return fld.Name
+}
+
 func reValueField(v reflect.Value, name string) reflect.Value {
 	for f, F := 0, v.NumField(); f < F; f++ {
 		fld := v.Type().Field(f)
@@ -98,3 +98,33 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestReshapeBatch(t *testing.T) {
+	rows := reflect.MakeSlice(reflect.SliceOf(schema), 2, 2)
+	rows.Index(0).Set(reflect.ValueOf(value))
+	rows.Index(1).Set(reflect.ValueOf(value))
+	for _, tt := range reshapeTests {
+		t.Run(tt.Shape, func(t *testing.T) {
+			var got []any
+			write, err := reshapeBatch(Shape(tt.Shape), schema, func(rows reflect.Value) error {
+				for i := range rows.Len() {
+					got = append(got, rows.Index(i).Interface())
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := write(rows); err != nil {
+				t.Fatal(err)
+			}
+			if want := []any{tt.Value, tt.Value}; !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v want %+v", got, want)
+			}
+		})
+	}
+
+	if _, err := reshapeBatch("A, D.X", schema, nil); err == nil || err.Error() != `shape: unknown field "D.X"` {
+		t.Errorf("unknown field: got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+type (
+	Dictionary string
+	Stats      string
+)
+
+// dictionaryMaxBytes is how large a column's dictionary may grow under
+// --dictionary auto before later pages fall back to plain encoding.
+const dictionaryMaxBytes = 1 << 20
+
+// rewriteOptions control how rewrite lays out its output, in addition to the
+// compression of writeOptions.
+type rewriteOptions struct {
+	RowGroup    rowGroupLimit
+	PageSize    uint64
+	Dictionary  Dictionary
+	SortBy      OrderBy
+	BloomFilter string
+	Stats       Stats
+}
+
+// rowGroupLimit is a number of rows, or of bytes when given with a unit.
+type rowGroupLimit struct {
+	rows  int64
+	bytes uint64
+}
+
+func parseRowGroupLimit(s string) (rowGroupLimit, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n <= 0 {
+			return rowGroupLimit{}, fmt.Errorf("row group size must be positive")
+		}
+		return rowGroupLimit{rows: n}, nil
+	}
+	n, err := humanize.ParseBytes(s)
+	if err == nil && n == 0 {
+		err = fmt.Errorf("row group size must be positive")
+	}
+	return rowGroupLimit{bytes: n}, err
+}
+
+// rowsFor returns the rows per row group for the data of pf, estimating the
+// rows that fill a size from its average uncompressed bytes per row.
+func (s rowGroupLimit) rowsFor(pf *parquet.File) int64 {
+	if s.bytes == 0 {
+		return s.rows
+	}
+	var size int64
+	for _, rg := range pf.Metadata().RowGroups {
+		size += rg.TotalByteSize
+	}
+	if size == 0 || pf.NumRows() == 0 {
+		return int64(s.bytes)
+	}
+	return max(1, int64(s.bytes)*pf.NumRows()/size)
+}
+
+func rewriteFile(ctx run.Context, writes *writeOptions, rw *rewriteOptions, file string, typer *schemata, in *inputs) error {
+	if err := writes.Compression.checkLevel(writes.Level); err != nil {
+		return err
+	}
+	return in.withFile(file, func(pf *parquet.File) error {
+		schema := writes.schema(pf.Schema())
+		opts := append(writes.options(pf.Metadata().KeyValueMetadata),
+			parquet.MaxRowsPerRowGroup(rw.RowGroup.rowsFor(pf)),
+		)
+		if rw.PageSize > 0 {
+			opts = append(opts, parquet.PageBufferSize(int(rw.PageSize)))
+		}
+
+		switch rw.Dictionary {
+		case "auto":
+			opts = append(opts, parquet.DictionaryMaxBytes(dictionaryMaxBytes))
+			fallthrough
+		case "on", "off":
+			dict := rw.Dictionary != "off"
+			schema = parquet.NewSchema(schema.Name(), mapLeaves(schema, func(leaf parquet.Node) parquet.Node {
+				return dictionaryEncoded(leaf, dict)
+			}))
+		}
+		opts = append(opts, schema)
+
+		if rw.BloomFilter != "" {
+			var filters []parquet.BloomFilterColumn
+			for column := range strings.SplitSeq(rw.BloomFilter, ",") {
+				column = strings.TrimSpace(column)
+				if _, ok := schema.Lookup(strings.Split(column, ".")...); !ok {
+					return fmt.Errorf("bloom filter %q: unknown column", column)
+				}
+				filters = append(filters, parquet.SplitBlockFilter(10, strings.Split(column, ".")...))
+			}
+			opts = append(opts, parquet.BloomFilters(filters...))
+		}
+
+		if rw.Stats == "off" {
+			opts = append(opts, parquet.DataPageStatistics(false))
+			for _, path := range schema.Columns() {
+				opts = append(opts, parquet.SkipPageBounds(path...))
+			}
+		}
+
+		var sorting []parquet.SortingColumn
+		if rw.SortBy != "" {
+			keys, err := ParseOrderBy(rw.SortBy, typer.LogicalTagged(pf.Schema()))
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				path := strings.Split(k.Source, ".")
+				leaf, ok := schema.Lookup(path...)
+				if !ok {
+					return fmt.Errorf("order by %q: %s is not a column", rw.SortBy, k.Source)
+				}
+				// Nulls sort first, as they do for sort.
+				sc := parquet.Ascending(path...)
+				if k.Desc {
+					sc = parquet.Descending(path...)
+				} else if leaf.Node.Optional() {
+					sc = parquet.NullsFirst(sc)
+				}
+				sorting = append(sorting, sc)
+			}
+		}
+
+		var after *format.FileMetaData
+		var written int64
+		err := withOutput(ctx, writes.Output, func(w io.Writer) error {
+			cw := &countWriter{w: w}
+			var pw interface {
+				parquet.RowWriter
+				Close() error
+				File() parquet.FileView
+			}
+			if sorting != nil {
+				pw = parquet.NewSortingWriter[any](cw, rw.RowGroup.rowsFor(pf), append(opts,
+					parquet.SortingWriterConfig(
+						parquet.SortingColumns(sorting...),
+						parquet.SortingBuffers(parquet.NewFileBufferPool("", "parquetry-sort-*")),
+					),
+				)...)
+			} else {
+				pw = parquet.NewWriter(cw, opts...)
+			}
+			for _, rg := range pf.RowGroups() {
+				rows := rg.Rows()
+				_, err := parquet.CopyRows(pw, rows)
+				if err = errors.Join(err, rows.Close()); err != nil {
+					return errors.Join(fmt.Errorf("%s: %w", file, err), pw.Close())
+				}
+			}
+			if err := pw.Close(); err != nil {
+				return err
+			}
+			after, written = pw.File().Metadata(), cw.n
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		report := ctx.Stdout
+		if writes.Output == "" || writes.Output == "-" {
+			report = ctx.Stderr
+		}
+		printRewrite(report, pf.Metadata(), pf.Size(), after, written)
+		return nil
+	})
+}
+
+// dictionaryEncoded returns leaf dictionary encoded, unless it is a boolean,
+// or if not dict, made plain if it was dictionary encoded.
+func dictionaryEncoded(leaf parquet.Node, dict bool) parquet.Node {
+	enc := leaf.Encoding()
+	switch {
+	case dict && leaf.Type().Kind() != parquet.Boolean:
+		return parquet.Encoded(leaf, &parquet.RLEDictionary)
+	case !dict && enc != nil && (enc.Encoding() == format.RLEDictionary || enc.Encoding() == format.PlainDictionary):
+		return parquet.Encoded(leaf, &parquet.Plain)
+	}
+	return leaf
+}
+
+// printRewrite reports the compressed size of each column, and of the whole
+// file, before and after a rewrite.
+func printRewrite(w io.Writer, before *format.FileMetaData, beforeSize int64, after *format.FileMetaData, afterSize int64) {
+	sizes := func(md *format.FileMetaData) (map[string]int64, []string) {
+		sizes := map[string]int64{}
+		var columns []string
+		for _, rg := range md.RowGroups {
+			for _, cc := range rg.Columns {
+				path := strings.Join(cc.MetaData.PathInSchema, ".")
+				if _, ok := sizes[path]; !ok {
+					columns = append(columns, path)
+				}
+				sizes[path] += cc.MetaData.TotalCompressedSize
+			}
+		}
+		return sizes, columns
+	}
+	was, columns := sizes(before)
+	now, _ := sizes(after)
+
+	fmt.Fprintln(w, "rows:", after.NumRows)
+	fmt.Fprintln(w, "row groups:", len(before.RowGroups), "->", len(after.RowGroups))
+	fmt.Fprintln(w, "columns:")
+	for _, c := range columns {
+		fmt.Fprintf(w, "  %s: %s -> %s\n", c, humanize.IBytes(uint64(was[c])), humanize.IBytes(uint64(now[c])))
+	}
+	fmt.Fprintf(w, "size: %s -> %s\n", humanize.IBytes(uint64(beforeSize)), humanize.IBytes(uint64(afterSize)))
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+)
+
+type sampleOptions struct {
+	N        int
+	Fraction float64
+	Seed     *uint64
+}
+
+// defaultSample is the number of rows sampled without --count or --fraction.
+const defaultSample = 10
+
+func parseFraction(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err == nil && (f <= 0 || f > 1) {
+		err = fmt.Errorf("fraction must be above 0 and at most 1")
+	}
+	return f, err
+}
+
+func parseSeed(s string) (*uint64, error) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("seed %q: %w", s, err)
+	}
+	return &n, nil
+}
+
+func printSample(ctx run.Context, format DataFormat, expr Filter, shape Shape, files []string, typer *schemata, sample *sampleOptions, in *inputs) error {
+	n := sample.N
+	switch {
+	case n < 0:
+		return fmt.Errorf("count must not be negative")
+	case n != 0 && sample.Fraction != 0:
+		return fmt.Errorf("only one of --count and --fraction may be used")
+	case n == 0 && sample.Fraction == 0:
+		n = defaultSample
+	}
+	seed := rand.Uint64()
+	if sample.Seed != nil {
+		seed = *sample.Seed
+	}
+	rng := rand.New(rand.NewPCG(seed, seed))
+
+	files, err := expandFiles(files)
+	if err != nil {
+		return err
+	}
+	files = slices.DeleteFunc(files, func(name string) bool {
+		return partitionPrune(expr, typer, name) == matchNone
+	})
+
+	return withBatchWriter(format, ctx.Stdout, func(write BatchFunc) error {
+		res := &reservoir{n: n, rng: rng}
+		var outType reflect.Type
+		var first string // the file outType was found from
+		err := eachFile(files, func(name string) error {
+			return in.withFile(name, func(pf *parquet.File) error {
+				rowType, fill := typer.PartitionedTagged(typer.LogicalTagged(pf.Schema()), name)
+				staged := res.write
+				if sample.Fraction != 0 {
+					staged = write
+				}
+				staged, err := reshapeBatch(shape, rowType, staged)
+				if err != nil {
+					return err
+				}
+				t, err := reshapeType(shape, rowType)
+				if err != nil {
+					return err
+				}
+				if outType == nil {
+					outType, first = t, name
+				} else if t != outType {
+					return fmt.Errorf("%s: schema differs from %s", name, first)
+				}
+				staged, err = filterBatch(expr, rowType, staged)
+				if err != nil {
+					return err
+				}
+				staged = fill.Batch(staged)
+				if sample.Fraction == 0 {
+					return eachBatch(pf, rowSelection{}, rowType, staged)
+				}
+				for _, rg := range pf.RowGroups() {
+					if rng.Float64() >= sample.Fraction {
+						continue
+					}
+					if err := readBatches(rg, 0, rg.NumRows(), rowType, staged); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+		if err != nil || sample.Fraction != 0 {
+			return err
+		}
+		if len(res.when) == 0 {
+			return nil
+		}
+		return write(res.ordered())
+	})
+}
+
+// reservoir keeps a uniform random sample of up to n of the rows written to
+// it, by replacing a random kept row with each later row with probability n
+// over the rows seen so far.
+type reservoir struct {
+	n    int
+	rng  *rand.Rand
+	seen int64
+	rows reflect.Value
+	when []int64 // the row seen at each of rows
+}
+
+func (r *reservoir) write(rows reflect.Value) error {
+	if !r.rows.IsValid() {
+		r.rows = reflect.MakeSlice(rows.Type(), 0, 0)
+	}
+	for i := range rows.Len() {
+		if r.rows.Len() < r.n {
+			r.rows = reflect.Append(r.rows, rows.Index(i))
+			r.when = append(r.when, r.seen)
+		} else if j := r.rng.Int64N(r.seen + 1); j < int64(r.n) {
+			r.rows.Index(int(j)).Set(rows.Index(i))
+			r.when[j] = r.seen
+		}
+		r.seen++
+	}
+	return nil
+}
+
+// ordered returns the rows kept, in the order they were written.
+func (r *reservoir) ordered() reflect.Value {
+	order := make([]int, len(r.when))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int { return cmp.Compare(r.when[a], r.when[b]) })
+	rows := reflect.MakeSlice(r.rows.Type(), len(order), len(order))
+	for i, j := range order {
+		rows.Index(i).Set(r.rows.Index(j))
+	}
+	return rows
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"testing"
+)
+
+func TestReservoir(t *testing.T) {
+	// Each of 8 rows, written in batches of 3, should be kept about as often.
+	const trials, rows, n = 4000, 8, 2
+	counts := make([]int, rows)
+	rng := rand.New(rand.NewPCG(1, 1))
+	for range trials {
+		res := &reservoir{n: n, rng: rng}
+		for i := 0; i < rows; i += 3 {
+			batch := make([]int, 0, 3)
+			for j := i; j < min(i+3, rows); j++ {
+				batch = append(batch, j)
+			}
+			if err := res.write(reflect.ValueOf(batch)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		kept := res.ordered().Interface().([]int)
+		if len(kept) != n || kept[0] >= kept[1] {
+			t.Fatalf("kept %v, want %d rows in order", kept, n)
+		}
+		for _, k := range kept {
+			counts[k]++
+		}
+	}
+	for i, c := range counts {
+		if want := trials * n / rows; c < want*8/10 || c > want*12/10 {
+			t.Errorf("row %d kept %d times, want about %d", i, c, want)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// errLimit stops reading once the rows selected after filtering are written.
+var errLimit = errors.New("row limit reached")
+
+// eachSelectedRows reads files for eachFileRows, selecting the row group of
+// sel from each file by position, then its window from the rows of all the
+// files, as their stages pass them on. A window counting from the end is
+// found by reading row groups backwards from the last, or else by counting
+// every row first.
+func eachSelectedRows(in *inputs, files []string, jobs int, unordered bool, sel rowSelection, prepare func(*fileRows) error, emit emitFunc) error {
+	prepareGroup := func(f *fileRows) error {
+		f.sel = rowSelection{group: sel.group}
+		return prepare(f)
+	}
+	if n, ok := sel.window.fromEnd(); ok {
+		return eachTailRows(in, files, n, prepareGroup, emit)
+	}
+	start, stop, ok := sel.window.fromStart()
+	if !ok {
+		total, err := countStaged(in, files, jobs, prepareGroup)
+		if err != nil {
+			return err
+		}
+		start, stop = sel.window.bounds(total)
+	}
+	prepareWindow, emitWindow := windowRows(start, stop, prepareGroup, emit)
+	err := readFileRows(in, files, jobs, unordered, prepareWindow, emitWindow)
+	if errors.Is(err, errLimit) {
+		return nil
+	}
+	return err
+}
+
+// countStaged counts the rows the stages of files pass on. Those of unfiltered
+// files are counted from their metadata.
+func countStaged(in *inputs, files []string, jobs int, prepare func(*fileRows) error) (int64, error) {
+	var unfiltered, filtered int64
+	err := readFileRows(in, files, jobs, true, func(f *fileRows) error {
+		if err := prepare(f); err != nil || f.filtered {
+			return err
+		}
+		n, err := f.selectedRows()
+		unfiltered += n
+		f.sel.window = rowWindow{{hasStop: true}}
+		return err
+	}, func(f *fileRows, read func(BatchFunc) error) error {
+		return read(func(rows reflect.Value) error {
+			filtered += int64(rows.Len())
+			return nil
+		})
+	})
+	return unfiltered + filtered, err
+}
+
+// windowRows wraps prepare and emit to pass on rows [start, stop) of those the
+// stages of all files pass on. The rows of unfiltered files are selected by
+// position before they are read, and those of filtered files by counting them
+// as they are staged. Once stop is reached, reading ends with errLimit.
+func windowRows(start, stop int64, prepare func(*fileRows) error, emit emitFunc) (func(*fileRows) error, emitFunc) {
+	var before int64 // rows of the unfiltered files prepared so far
+	var staged int64 // rows of the filtered files staged so far
+	return func(f *fileRows) error {
+			if before >= stop {
+				return errLimit
+			}
+			if err := prepare(f); err != nil || f.filtered {
+				return err
+			}
+			n, err := f.selectedRows()
+			if err != nil {
+				return err
+			}
+			f.sel.window = append(f.sel.window, rowSlice{start: max(start-before, 0), stop: stop - before, hasStart: true, hasStop: true})
+			before += n
+			return nil
+		}, func(f *fileRows, read func(BatchFunc) error) error {
+			if !f.filtered {
+				return emit(f, read)
+			}
+			if staged >= stop {
+				return errLimit
+			}
+			err := emit(f, func(write BatchFunc) error {
+				err := read(func(rows reflect.Value) error {
+					n := int64(rows.Len())
+					i, j := min(max(start-staged, 0), n), min(max(stop-staged, 0), n)
+					staged += n
+					if i < j {
+						if err := write(rows.Slice(int(i), int(j))); err != nil {
+							return err
+						}
+					}
+					if staged >= stop {
+						return errLimit
+					}
+					return nil
+				})
+				// The rows written so far may still need sorting.
+				if errors.Is(err, errLimit) {
+					return nil
+				}
+				return err
+			})
+			if err == nil && staged >= stop {
+				return errLimit
+			}
+			return err
+		}
+}
+
+// tailFile is a file holding rows selected by --tail.
+type tailFile struct {
+	fileRows
+	close func() error
+	parts []tailPart
+}
+
+// tailPart is the rows of a row group selected by --tail: rows [from, to) of
+// the group, of which the first limit rows passed on by the stage are kept if
+// limit is not negative, or else rows already staged.
+type tailPart struct {
+	rg       parquet.RowGroup
+	from, to int64
+	limit    int64
+	rows     reflect.Value
+}
+
+// eachTailRows emits the last n rows of all files, or with negative n, all
+// but the last -n. Files are opened from the last, and their row groups read
+// from the last, until enough rows are found. The row groups of unfiltered
+// files are not read until emitted, and then only the rows selected, while
+// those of filtered files are staged as they are found, keeping only the
+// last n rows, or with negative n, a count of them.
+func eachTailRows(in *inputs, files []string, n int64, prepare func(*fileRows) error, emit emitFunc) error {
+	var tails []*tailFile // in the reverse order of files
+	defer func() {
+		for _, t := range tails {
+			t.close()
+		}
+	}()
+
+	need := max(n, -n)
+	for i := len(files) - 1; i >= 0 && need > 0; i-- {
+		t := &tailFile{fileRows: fileRows{name: files[i]}}
+		var err error
+		if t.file, t.close, err = in.openFile(files[i]); err != nil {
+			return err
+		}
+		tails = append(tails, t)
+		if err := prepare(&t.fileRows); err != nil {
+			return err
+		}
+
+		parts, err := t.groupParts()
+		if err != nil {
+			return err
+		}
+		for j := len(parts) - 1; j >= 0 && need > 0; j-- {
+			p := parts[j]
+			switch {
+			case !t.filtered && n > 0:
+				p.from = p.to - min(need, p.to-p.from)
+				need -= p.to - p.from
+			case !t.filtered:
+				skip := min(need, p.to-p.from)
+				p.to -= skip
+				need -= skip
+			case n > 0:
+				ring := &ringRows{n: int(need)}
+				if err := t.stageGroup(p, ring.write); err != nil {
+					return err
+				}
+				if p.rows = ring.ordered(); p.rows.IsValid() {
+					need -= int64(p.rows.Len())
+				} else {
+					p.limit = 0
+				}
+			default:
+				var count int64
+				if err := t.stageGroup(p, func(rows reflect.Value) error {
+					count += int64(rows.Len())
+					return nil
+				}); err != nil {
+					return err
+				}
+				skip := min(need, count)
+				p.limit = count - skip
+				need -= skip
+			}
+			t.parts = append(t.parts, p)
+			if n < 0 && need == 0 {
+				// This group holds the last row kept, after those before it.
+				for j--; j >= 0; j-- {
+					t.parts = append(t.parts, parts[j])
+				}
+			}
+		}
+	}
+
+	if len(tails) == 0 {
+		return nil
+	}
+	if n > 0 {
+		for i := len(tails) - 1; i >= 0; i-- {
+			if err := emit(&tails[i].fileRows, tails[i].read); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// With every row skipped, the first file is emitted without rows, and
+	// otherwise the files before those read for the skipped rows in full.
+	if need > 0 {
+		t := tails[len(tails)-1]
+		t.parts = nil
+		return emit(&t.fileRows, t.read)
+	}
+	skipped := len(files) - len(tails)
+	for _, name := range files[:skipped] {
+		err := in.withFile(name, func(pf *parquet.File) error {
+			t := &tailFile{fileRows: fileRows{name: name, file: pf}}
+			if err := prepare(&t.fileRows); err != nil {
+				return err
+			}
+			parts, err := t.groupParts()
+			if err != nil {
+				return err
+			}
+			t.parts = parts
+			slices.Reverse(t.parts)
+			return emit(&t.fileRows, t.read)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	t := tails[len(tails)-1]
+	return emit(&t.fileRows, t.read)
+}
+
+// groupParts returns a part for each row group of t with rows selected by
+// t.sel, in order.
+func (t *tailFile) groupParts() ([]tailPart, error) {
+	rowGroups := t.file.RowGroups()
+	ranges, err := t.ranges()
+	if err != nil {
+		return nil, err
+	}
+	var parts []tailPart
+	for i, r := range ranges {
+		if r[0] < r[1] {
+			parts = append(parts, tailPart{rg: rowGroups[i], from: r[0], to: r[1], limit: -1})
+		}
+	}
+	return parts, nil
+}
+
+// stageGroup reads every row of p through the stage of t.
+func (t *tailFile) stageGroup(p tailPart, write BatchFunc) error {
+	write, err := t.stage(write)
+	if err != nil {
+		return err
+	}
+	return readBatches(p.rg, p.from, p.to, t.rowType, write)
+}
+
+// read passes the selected rows of t to write.
+func (t *tailFile) read(write BatchFunc) error {
+	var limit int64
+	staged, err := t.stage(func(rows reflect.Value) error {
+		if limit >= 0 {
+			rows = rows.Slice(0, int(min(limit, int64(rows.Len()))))
+			limit -= int64(rows.Len())
+		}
+		if rows.Len() == 0 {
+			return nil
+		}
+		return write(rows)
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(t.parts) - 1; i >= 0; i-- {
+		p := t.parts[i]
+		if p.rows.IsValid() {
+			if p.rows.Len() > 0 {
+				if err := write(p.rows); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if limit = p.limit; p.from < p.to && limit != 0 {
+			if err := readBatches(p.rg, p.from, p.to, t.rowType, staged); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ringRows keeps the last n rows written to it.
+type ringRows struct {
+	n    int
+	rows reflect.Value
+	next int // where the next row goes, once rows holds n
+}
+
+func (r *ringRows) write(rows reflect.Value) error {
+	if !r.rows.IsValid() {
+		r.rows = reflect.MakeSlice(rows.Type(), 0, 0)
+	}
+	for i := max(rows.Len()-r.n, 0); i < rows.Len(); i++ {
+		if r.rows.Len() < r.n {
+			r.rows = reflect.Append(r.rows, rows.Index(i))
+			continue
+		}
+		r.rows.Index(r.next).Set(rows.Index(i))
+		r.next = (r.next + 1) % r.n
+	}
+	return nil
+}
+
+// ordered returns the rows kept, oldest first.
+func (r *ringRows) ordered() reflect.Value {
+	if !r.rows.IsValid() || r.next == 0 {
+		return r.rows
+	}
+	rows := reflect.MakeSlice(r.rows.Type(), r.n, r.n)
+	reflect.Copy(rows, r.rows.Slice(r.next, r.n))
+	reflect.Copy(rows.Slice(r.n-r.next, r.n), r.rows.Slice(0, r.next))
+	return rows
+}
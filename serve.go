@@ -0,0 +1,328 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+)
+
+// defaultLimit is how many rows GET /rows returns without a limit, and
+// maxLimit the most it returns with one.
+const (
+	defaultLimit = 100
+	maxLimit     = 100000
+)
+
+// serveRefresh is how long the files found, and the rows and row groups GET
+// /files lists for them, are kept before they are found and read again.
+const serveRefresh = 10 * time.Second
+
+// serveTypes are the formats GET /rows streams, and their content types.
+var serveTypes = map[DataFormat]string{
+	"jsonl": "application/x-ndjson",
+	"json":  "application/json",
+	"csv":   "text/csv; charset=utf-8",
+}
+
+func serveFiles(ctx run.Context, addr string, files []string, typer *schemata, in *inputs) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:           newServer(files, typer, in, ctx.Stderr),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+	}
+	context.AfterFunc(ctx, func() { srv.Close() })
+	fmt.Fprintf(ctx.Stdout, "serving on http://%s\n", ln.Addr())
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// server serves the parquet files found from its files, as expandFiles finds
+// them at most every serveRefresh. Each is named by its path with forward
+// slashes and no leading slash.
+type server struct {
+	files []string
+	typer *schemata
+	in    *inputs
+	log   io.Writer // errors once a response has begun
+
+	mu     sync.Mutex
+	names  []string              // the files found
+	found  time.Time             // when names were found
+	listed map[string]servedFile // of names, as GET /files lists them
+}
+
+func newServer(files []string, typer *schemata, in *inputs, log io.Writer) http.Handler {
+	s := &server{files: files, typer: typer, in: in, log: log}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files", s.list)
+	mux.HandleFunc("GET /schema/{name...}", s.schema)
+	mux.HandleFunc("GET /meta/{name...}", s.meta)
+	mux.HandleFunc("GET /rows/{name...}", s.rows)
+	return mux
+}
+
+func serveName(name string) string {
+	return strings.TrimPrefix(filepath.ToSlash(name), "/")
+}
+
+// served returns the files served, finding them again once those found are
+// older than serveRefresh.
+func (s *server) served() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.names == nil || time.Since(s.found) >= serveRefresh {
+		names, err := expandFiles(s.files)
+		if err != nil {
+			return nil, err
+		}
+		s.names, s.found, s.listed = names, time.Now(), map[string]servedFile{}
+	}
+	return s.names, nil
+}
+
+// open opens the file named by the request, if it is one of the files served.
+func (s *server) open(w http.ResponseWriter, r *http.Request) (string, *parquet.File, func() error, bool) {
+	names, err := s.served()
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err)
+		return "", nil, nil, false
+	}
+	want := r.PathValue("name")
+	for _, name := range names {
+		if serveName(name) != want {
+			continue
+		}
+		pf, closer, err := s.in.openFile(name)
+		if err != nil {
+			serveError(w, http.StatusInternalServerError, err)
+			return "", nil, nil, false
+		}
+		return name, pf, closer, true
+	}
+	serveError(w, http.StatusNotFound, fmt.Errorf("%s: no such file", want))
+	return "", nil, nil, false
+}
+
+// servedFile is a file listed by GET /files.
+type servedFile struct {
+	Name      string `json:"name"`
+	Rows      int64  `json:"rows"`
+	RowGroups int    `json:"row_groups"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (s *server) list(w http.ResponseWriter, r *http.Request) {
+	names, err := s.served()
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err)
+		return
+	}
+	files := make([]servedFile, len(names))
+	for i, name := range names {
+		files[i] = s.listFile(name)
+	}
+	serveJSON(w, files)
+}
+
+// listFile returns name as GET /files lists it, reading its footer only if
+// it has not been listed since the files were last found. Files that fail
+// to open are read again each time.
+func (s *server) listFile(name string) servedFile {
+	s.mu.Lock()
+	f, ok := s.listed[name]
+	s.mu.Unlock()
+	if ok {
+		return f
+	}
+	f.Name = serveName(name)
+	if err := s.in.withFile(name, func(pf *parquet.File) error {
+		f.Rows = pf.NumRows()
+		f.RowGroups = len(pf.RowGroups())
+		return nil
+	}); err != nil {
+		f.Error = err.Error()
+		return f
+	}
+	s.mu.Lock()
+	s.listed[name] = f
+	s.mu.Unlock()
+	return f
+}
+
+// servedSchema is the schema returned by GET /schema, as a message and a
+// logical struct, and the logical type of each column.
+type servedSchema struct {
+	Name    string         `json:"name"`
+	Message string         `json:"message"`
+	Logical string         `json:"logical"`
+	Columns []servedColumn `json:"columns"`
+}
+
+type servedColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func (s *server) schema(w http.ResponseWriter, r *http.Request) {
+	name, pf, closer, ok := s.open(w, r)
+	if !ok {
+		return
+	}
+	defer closer()
+	logical, _ := s.typer.Partitioned(s.typer.Logical(pf.Schema()), name)
+	tagged, _ := s.typer.PartitionedTagged(s.typer.LogicalTagged(pf.Schema()), name)
+	schema := servedSchema{
+		Name:    serveName(name),
+		Message: pf.Schema().String(),
+		Logical: strings.ReplaceAll(logical.String(), " main.", " "),
+	}
+	for i, col := range columnNames(tagged) {
+		t := strings.ReplaceAll(logical.Field(i).Type.String(), "main.", "")
+		schema.Columns = append(schema.Columns, servedColumn{Name: col, Type: t})
+	}
+	serveJSON(w, schema)
+}
+
+func (s *server) meta(w http.ResponseWriter, r *http.Request) {
+	name, pf, closer, ok := s.open(w, r)
+	if !ok {
+		return
+	}
+	defer closer()
+	serveJSON(w, footerOf(name, pf, s.typer.LogicalTagged(pf.Schema())))
+}
+
+// rows streams the rows of a file matching the filter parameter, reshaped by
+// the shape parameter, skipping offset of them and stopping after limit.
+func (s *server) rows(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := DataFormat(cmp.Or(q.Get("format"), "jsonl"))
+	contentType, ok := serveTypes[format]
+	if !ok {
+		serveError(w, http.StatusBadRequest, fmt.Errorf("format %q: want jsonl, json, or csv", format))
+		return
+	}
+	offset, err := serveCount(q.Get("offset"), "offset", 0, math.MaxInt64-maxLimit)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := serveCount(q.Get("limit"), "limit", defaultLimit, maxLimit)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter, shape := Filter(q.Get("filter")), Shape(q.Get("shape"))
+
+	name, pf, closer, ok := s.open(w, r)
+	if !ok {
+		return
+	}
+	defer closer()
+	rowType, fill := s.typer.PartitionedTagged(s.typer.LogicalTagged(pf.Schema()), name)
+
+	// The filter and shape are compiled before any rows are written, so
+	// their errors are reported as bad requests. Without a filter, rows are
+	// skipped and limited by position, so only those returned are read.
+	var out WriteFunc
+	staged, err := reshapeWrite(shape, rowType, func(v reflect.Value) error { return out(v) })
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err)
+		return
+	}
+	staged, err = filterWrite(filter, rowType, staged)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err)
+		return
+	}
+	var sel rowSelection
+	if filter == "" {
+		sel.window = rowWindow{{start: offset, stop: offset + limit, hasStart: true, hasStop: true}}
+		offset = 0
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	cw := &countWriter{w: w}
+	err = withWriter(format, cw, func(write WriteFunc) error {
+		left := limit
+		out = func(v reflect.Value) error {
+			if offset > 0 {
+				offset--
+				return nil
+			}
+			if err := write(v); err != nil {
+				return err
+			}
+			if left--; left == 0 {
+				return errLimit
+			}
+			return nil
+		}
+		if limit == 0 {
+			return nil
+		}
+		return eachRow(pf, sel, rowType, fill.Write(staged))
+	})
+	if errors.Is(err, errLimit) {
+		err = nil
+	}
+	switch {
+	case err == nil:
+	case cw.n == 0:
+		serveError(w, http.StatusInternalServerError, err)
+	default:
+		fmt.Fprintf(s.log, "%s: %v\n", r.URL.Path, err)
+	}
+}
+
+// serveCount parses a non-negative count of rows, or returns def if s is empty.
+// serveCount parses s as a number of rows up to most, or def if s is empty.
+// The bounds of offset and limit keep their sum from overflowing.
+func serveCount(s, param string, def, most int64) (int64, error) {
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s %q: want a number of rows", param, s)
+	}
+	if n > most {
+		return 0, fmt.Errorf("%s %q: want at most %d rows", param, s, most)
+	}
+	return n, nil
+}
+
+func serveJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+func serveError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
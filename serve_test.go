@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveGet(t *testing.T, srv *httptest.Server, path string) (int, string, string) {
+	t.Helper()
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+}
+
+func TestServe(t *testing.T) {
+	srv := httptest.NewServer(newServer([]string{"testdata/parquet/pages.parquet", "testdata/parquet/example.parquet"}, new(schemata), newInputs(nil), io.Discard))
+	defer srv.Close()
+
+	_, _, body := serveGet(t, srv, "/files")
+	var files []servedFile
+	if err := json.Unmarshal([]byte(body), &files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0] != (servedFile{Name: "testdata/parquet/pages.parquet", Rows: 300, RowGroups: 2}) {
+		t.Errorf("files: got %+v", files)
+	}
+
+	_, _, body = serveGet(t, srv, "/schema/testdata/parquet/example.parquet")
+	var schema servedSchema
+	if err := json.Unmarshal([]byte(body), &schema); err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Columns) != 9 || schema.Columns[8] != (servedColumn{Name: "w", Type: "struct { D Date; T TimeMilliUTC; S StampMilliUTC }"}) {
+		t.Errorf("schema columns: got %+v", schema.Columns)
+	}
+
+	_, _, body = serveGet(t, srv, "/meta/testdata/parquet/pages.parquet")
+	if !strings.Contains(body, `"num_rows": 300`) {
+		t.Errorf("meta: got %s", body)
+	}
+
+	for _, tt := range []struct {
+		query, contentType, want string
+	}{
+		{"limit=2&offset=199", "application/x-ndjson",
+			`{"id":199,"color":"green","code":"c0881","note":"note 9"}` + "\n" +
+				`{"id":200,"color":"blue","code":"c0800","note":null}` + "\n"},
+		{"filter=id>250&shape=id,note&offset=1&limit=2&format=csv", "text/csv; charset=utf-8",
+			"id,note\n252,null\n253,\"\"\"note 3\"\"\"\n"},
+		{"filter=id<0&format=json", "application/json", "[]"},
+		{"shape=id+AS+x&filter=id==3", "application/x-ndjson", `{"x":3}` + "\n"},
+	} {
+		code, contentType, body := serveGet(t, srv, "/rows/testdata/parquet/pages.parquet?"+strings.ReplaceAll(tt.query, ">", "%3E"))
+		if code != http.StatusOK || contentType != tt.contentType || body != tt.want {
+			t.Errorf("rows?%s: got %d %s\n%s", tt.query, code, contentType, body)
+		}
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	srv := httptest.NewServer(newServer([]string{"testdata/parquet/pages.parquet"}, new(schemata), newInputs(nil), io.Discard))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/rows/testdata/parquet/pages.parquet?shape=nope", http.StatusBadRequest, `unknown field \"nope\"`},
+		{"/rows/testdata/parquet/pages.parquet?filter=nope", http.StatusBadRequest, "unknown name nope"},
+		{"/rows/testdata/parquet/pages.parquet?format=xml", http.StatusBadRequest, `format \"xml\"`},
+		{"/rows/testdata/parquet/pages.parquet?limit=-1", http.StatusBadRequest, `limit \"-1\"`},
+		{"/rows/testdata/parquet/pages.parquet?limit=9223372036854775807&offset=1", http.StatusBadRequest, "want at most 100000 rows"},
+		{"/rows/testdata/parquet/pages.parquet?offset=9223372036854775807", http.StatusBadRequest, `offset \"9223372036854775807\"`},
+		{"/rows/testdata/parquet/example.parquet", http.StatusNotFound, "no such file"},
+		{"/schema/go.mod", http.StatusNotFound, "no such file"},
+	} {
+		code, contentType, body := serveGet(t, srv, tt.path)
+		if code != tt.code || contentType != "application/json" || !strings.Contains(body, tt.want) {
+			t.Errorf("%s: got %d %s %s", tt.path, code, contentType, body)
+		}
+	}
+}
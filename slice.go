@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// rowSlice selects rows as a python slice does: rows [start, stop), where
+// either may be omitted, and negatives count back from the end.
+type rowSlice struct {
+	start, stop       int64
+	hasStart, hasStop bool
+}
+
+// parseRowSlice parses START:STOP, where either may be empty.
+func parseRowSlice(s string) (rowSlice, error) {
+	start, stop, ok := strings.Cut(s, ":")
+	if !ok {
+		return rowSlice{}, fmt.Errorf("rows %q: want START:STOP", s)
+	}
+	if strings.Contains(stop, ":") {
+		return rowSlice{}, fmt.Errorf("rows %q: steps are not supported", s)
+	}
+	var r rowSlice
+	var err error
+	if start != "" {
+		if r.start, err = strconv.ParseInt(start, 10, 64); err != nil {
+			return rowSlice{}, fmt.Errorf("rows %q: bad start: %w", s, err)
+		}
+		r.hasStart = true
+	}
+	if stop != "" {
+		if r.stop, err = strconv.ParseInt(stop, 10, 64); err != nil {
+			return rowSlice{}, fmt.Errorf("rows %q: bad stop: %w", s, err)
+		}
+		r.hasStop = true
+	}
+	return r, nil
+}
+
+// parseRowGroup parses the index of a row group.
+func parseRowGroup(s string) (*int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, fmt.Errorf("row group %q: %w", s, err)
+	}
+	return &n, nil
+}
+
+// headSlice returns the slice selected by --head n.
+func headSlice(n int64) rowSlice {
+	if n < 0 {
+		return rowSlice{start: -n, hasStart: true}
+	}
+	return rowSlice{stop: n, hasStop: true}
+}
+
+// tailSlice returns the slice selected by --tail n.
+func tailSlice(n int64) rowSlice {
+	if n < 0 {
+		return rowSlice{stop: n, hasStop: true}
+	}
+	return rowSlice{start: -n, hasStart: true}
+}
+
+// bounds returns the rows [start, stop) that s selects of n rows.
+func (s rowSlice) bounds(n int64) (start, stop int64) {
+	start, stop = 0, n
+	if s.hasStart {
+		start = s.start
+		if start < 0 {
+			start += n
+		}
+	}
+	if s.hasStop {
+		stop = s.stop
+		if stop < 0 {
+			stop += n
+		}
+	}
+	start = min(max(start, 0), n)
+	return start, min(max(stop, start), n)
+}
+
+// rowWindow is slices of rows applied in turn, each to the rows selected by
+// those before it.
+type rowWindow []rowSlice
+
+// bounds returns the rows [start, stop) that w selects of n rows.
+func (w rowWindow) bounds(n int64) (start, stop int64) {
+	stop = n
+	for _, s := range w {
+		i, j := s.bounds(stop - start)
+		start, stop = start+i, start+j
+	}
+	return start, stop
+}
+
+// fromStart reports whether w counts only from the start of the rows, so
+// selects the same rows however many follow them. The stop it returns is
+// math.MaxInt64 when w selects every row from start on.
+func (w rowWindow) fromStart() (start, stop int64, ok bool) {
+	for _, s := range w {
+		if s.hasStart && s.start < 0 || s.hasStop && s.stop < 0 {
+			return 0, 0, false
+		}
+	}
+	start, stop = w.bounds(math.MaxInt64)
+	return start, stop, true
+}
+
+// fromEnd returns n if w selects as --tail n does.
+func (w rowWindow) fromEnd() (n int64, ok bool) {
+	if len(w) != 1 {
+		return 0, false
+	}
+	switch s := w[0]; {
+	case s.hasStart && !s.hasStop && s.start < 0:
+		return -s.start, true
+	case s.hasStop && !s.hasStart && s.stop < 0:
+		return s.stop, true
+	}
+	return 0, false
+}
+
+// rowSelection selects rows of a file by position: those of one row group if
+// group is set, then those of window.
+type rowSelection struct {
+	group  *int
+	window rowWindow
+}
+
+// groupRanges returns the rows of each of rowGroups that sel selects.
+func groupRanges(rowGroups []parquet.RowGroup, sel rowSelection) ([][2]int64, error) {
+	var rows, offset int64
+	for _, rg := range rowGroups {
+		rows += rg.NumRows()
+	}
+	if sel.group != nil {
+		g := *sel.group
+		if g < 0 {
+			g += len(rowGroups)
+		}
+		if g < 0 || g >= len(rowGroups) {
+			return nil, fmt.Errorf("row group %d out of range: %d row groups", *sel.group, len(rowGroups))
+		}
+		for _, rg := range rowGroups[:g] {
+			offset += rg.NumRows()
+		}
+		rows = rowGroups[g].NumRows()
+	}
+	start, stop := sel.window.bounds(rows)
+	start, stop = start+offset, stop+offset
+
+	var ranges [][2]int64
+	offset = 0
+	for _, rg := range rowGroups {
+		n := rg.NumRows()
+		ranges = append(ranges, [2]int64{min(max(start-offset, 0), n), min(max(stop-offset, 0), n)})
+		offset += n
+	}
+	return ranges, nil
+}
+
+// selectedRows returns how many rows of f f.sel selects.
+func (f *fileRows) selectedRows() (int64, error) {
+	ranges, err := f.ranges()
+	var n int64
+	for _, r := range ranges {
+		n += r[1] - r[0]
+	}
+	return n, err
+}
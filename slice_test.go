@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRowWindow(t *testing.T) {
+	tests := []struct {
+		Rows       string
+		Head, Tail int64
+		N          int64
+		Start      int64
+		Stop       int64
+	}{
+		{":", 0, 0, 10, 0, 10},
+		{"2:5", 0, 0, 10, 2, 5},
+		{"-3:", 0, 0, 10, 7, 10},
+		{":-3", 0, 0, 10, 0, 7},
+		{"-5:-2", 0, 0, 10, 5, 8},
+		{"5:2", 0, 0, 10, 5, 5},
+		{"-20:20", 0, 0, 10, 0, 10},
+		{"", 6, 2, 10, 4, 6},
+		{"", 6, 2, 4, 2, 4},
+		{"", -2, -3, 10, 2, 7},
+		{"", -8, -3, 10, 8, 8},
+		{"2:", 5, 2, 10, 5, 7},
+		{"2:", 5, 2, 5, 3, 5},
+	}
+	for _, tt := range tests {
+		rows := &rowOptions{Head: tt.Head, Tail: tt.Tail}
+		if tt.Rows != "" {
+			s, err := parseRowSlice(tt.Rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows.Rows = s
+		}
+		start, stop := rows.selection().window.bounds(tt.N)
+		if start != tt.Start || stop != tt.Stop {
+			t.Errorf("--rows %q --head %d --tail %d of %d: got %d:%d want %d:%d", tt.Rows, tt.Head, tt.Tail, tt.N, start, stop, tt.Start, tt.Stop)
+		}
+	}
+}
+
+func TestRowWindowEnds(t *testing.T) {
+	if start, stop, ok := (rowWindow{{start: 3, hasStart: true}, headSlice(4)}).fromStart(); !ok || start != 3 || stop != 7 {
+		t.Errorf("3: then head 4: got %d:%d %v", start, stop, ok)
+	}
+	if start, stop, ok := (rowWindow{{start: 3, hasStart: true}}).fromStart(); !ok || start != 3 || stop != math.MaxInt64 {
+		t.Errorf("3: got %d:%d %v", start, stop, ok)
+	}
+	if _, _, ok := (rowWindow{headSlice(4), tailSlice(2)}).fromStart(); ok {
+		t.Errorf("head 4 then tail 2 counts from the end")
+	}
+	if n, ok := (rowWindow{tailSlice(4)}).fromEnd(); !ok || n != 4 {
+		t.Errorf("tail 4: got %d %v", n, ok)
+	}
+	if n, ok := (rowWindow{tailSlice(-4)}).fromEnd(); !ok || n != -4 {
+		t.Errorf("tail -4: got %d %v", n, ok)
+	}
+	if _, ok := (rowWindow{{start: -4, stop: -2, hasStart: true, hasStop: true}}).fromEnd(); ok {
+		t.Errorf("-4:-2 is not a tail")
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type sortKey struct {
+	Source string
+	Desc   bool
+}
+
+func (k sortKey) compare(a, b reflect.Value) int {
+	c := compareValue(reValueOf(a, k.Source), reValueOf(b, k.Source))
+	if k.Desc {
+		return -c
+	}
+	return c
+}
+
+// ParseOrderBy parses a comma separated list of dotted field names, each
+// optionally followed by asc or desc, and verifies them against t.
+func ParseOrderBy(order OrderBy, t reflect.Type) ([]sortKey, error) {
+	var keys []sortKey
+	for _, term := range strings.Split(string(order), ",") {
+		words := strings.Fields(term)
+		if len(words) == 0 || len(words) > 2 {
+			return nil, fmt.Errorf("order by %q: invalid term %q", order, strings.TrimSpace(term))
+		}
+		key := sortKey{Source: words[0]}
+		if len(words) == 2 {
+			switch strings.ToLower(words[1]) {
+			case "asc":
+			case "desc":
+				key.Desc = true
+			default:
+				return nil, fmt.Errorf("order by %q: expected asc or desc, got %q", order, words[1])
+			}
+		}
+		if _, ok := reLookupType(t, key.Source); !ok {
+			return nil, fmt.Errorf("order by %q: unknown field %q", order, key.Source)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func reLookupType(t reflect.Type, source string) (reflect.Type, bool) {
+	for step := range strings.SplitSeq(source, ".") {
+		if t.Kind() != reflect.Struct {
+			return nil, false
+		}
+		tf, ok := reTypeField(t, step)
+		if !ok {
+			return nil, false
+		}
+		t = tf.Type
+	}
+	return t, true
+}
+
+func compareKeys(keys []sortKey, a, b reflect.Value) int {
+	for _, k := range keys {
+		if c := k.compare(a, b); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// rowSorter reorders the rows written to it by keys. Rows are buffered in
+// memory up to approximately budget bytes, after which sorted runs are
+// spilled to temporary parquet files and merged by Flush.
+type rowSorter struct {
+	keys    []sortKey
+	budget  uint64
+	rowType reflect.Type
+	rows    []reflect.Value
+	size    uint64
+	runs    []*os.File
+}
+
+func (s *rowSorter) Write(v reflect.Value) error {
+	row := reflect.New(s.rowType).Elem()
+	row.Set(v)
+	s.rows = append(s.rows, row)
+	s.size += sizeOf(row)
+	if s.budget > 0 && s.size >= s.budget {
+		return s.spill()
+	}
+	return nil
+}
+
+func (s *rowSorter) sort() {
+	slices.SortStableFunc(s.rows, func(a, b reflect.Value) int { return compareKeys(s.keys, a, b) })
+}
+
+func (s *rowSorter) spill() error {
+	s.sort()
+	f, err := os.CreateTemp("", "parquetry-sort-*.parquet")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f)
+
+	pw := parquet.NewWriter(f, parquet.SchemaOf(reflect.Zero(s.rowType).Interface()))
+	for _, row := range s.rows {
+		if err := pw.Write(row.Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	s.rows, s.size = s.rows[:0], 0
+	return pw.Close()
+}
+
+// Flush writes all rows in order to w.
+func (s *rowSorter) Flush(w WriteFunc) error {
+	if len(s.runs) == 0 {
+		s.sort()
+		for _, row := range s.rows {
+			if err := w(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(s.rows) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	return s.merge(w)
+}
+
+func (s *rowSorter) merge(w WriteFunc) error {
+	m := &runMerger{keys: s.keys}
+	defer m.Close()
+	for i, f := range s.runs {
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		pf, err := parquet.OpenFile(f, stat.Size())
+		if err != nil {
+			return err
+		}
+		r := &sortRun{index: i, pq: parquet.NewReader(pf), row: reflect.New(s.rowType)}
+		m.open = append(m.open, r)
+		if ok, err := r.next(); err != nil {
+			return err
+		} else if ok {
+			m.runs = append(m.runs, r)
+		}
+	}
+
+	heap.Init(m)
+	for m.Len() > 0 {
+		r := m.runs[0]
+		if err := w(r.row.Elem()); err != nil {
+			return err
+		}
+		if ok, err := r.next(); err != nil {
+			return err
+		} else if ok {
+			heap.Fix(m, 0)
+		} else {
+			heap.Pop(m)
+		}
+	}
+	return nil
+}
+
+func (s *rowSorter) cleanup() error {
+	var errs []error
+	for _, f := range s.runs {
+		errs = append(errs, f.Close(), os.Remove(f.Name()))
+	}
+	s.runs = nil
+	return errors.Join(errs...)
+}
+
+type sortRun struct {
+	index int
+	pq    *parquetReader
+	row   reflect.Value
+}
+
+func (r *sortRun) next() (bool, error) {
+	r.row.Elem().SetZero()
+	if err := r.pq.Read(r.row.Interface()); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// runMerger is a heap of sorted runs ordered by their current rows.
+// Ties are broken by run index to keep the merge stable.
+type runMerger struct {
+	keys []sortKey
+	runs []*sortRun
+	open []*sortRun
+}
+
+func (m *runMerger) Len() int { return len(m.runs) }
+func (m *runMerger) Less(i, j int) bool {
+	if c := compareKeys(m.keys, m.runs[i].row.Elem(), m.runs[j].row.Elem()); c != 0 {
+		return c < 0
+	}
+	return m.runs[i].index < m.runs[j].index
+}
+func (m *runMerger) Swap(i, j int) { m.runs[i], m.runs[j] = m.runs[j], m.runs[i] }
+func (m *runMerger) Push(x any)    { m.runs = append(m.runs, x.(*sortRun)) }
+func (m *runMerger) Pop() any {
+	r := m.runs[len(m.runs)-1]
+	m.runs = m.runs[:len(m.runs)-1]
+	return r
+}
+
+func (m *runMerger) Close() error {
+	var errs []error
+	for _, r := range m.open {
+		errs = append(errs, r.pq.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// sortedByMetadata reports whether every row group declares sorting columns
+// matching keys, and consecutive row groups do not overlap on the first key.
+func sortedByMetadata(file parquet.FileView, keys []sortKey) bool {
+	schema := file.Schema()
+	leaves := make([]parquet.LeafColumn, len(keys))
+	for i, k := range keys {
+		leaf, ok := schema.Lookup(strings.Split(k.Source, ".")...)
+		if !ok {
+			return false
+		}
+		leaves[i] = leaf
+	}
+
+	groups := file.Metadata().RowGroups
+	for _, rg := range groups {
+		if len(rg.SortingColumns) < len(keys) {
+			return false
+		}
+		for i, sc := range rg.SortingColumns[:len(keys)] {
+			if int(sc.ColumnIdx) != leaves[i].ColumnIndex || sc.Descending != keys[i].Desc {
+				return false
+			}
+			if leaves[i].Node.Optional() && sc.NullsFirst != !keys[i].Desc {
+				return false
+			}
+		}
+	}
+
+	rowGroups := file.RowGroups()
+	for i := 1; i < len(rowGroups); i++ {
+		prev, ok := rowGroups[i-1].ColumnChunks()[leaves[0].ColumnIndex].(*parquet.FileColumnChunk)
+		if !ok {
+			return false
+		}
+		next, ok := rowGroups[i].ColumnChunks()[leaves[0].ColumnIndex].(*parquet.FileColumnChunk)
+		if !ok {
+			return false
+		}
+		_, prevMax, ok := prev.Bounds()
+		if !ok {
+			return false
+		}
+		nextMin, _, ok := next.Bounds()
+		if !ok {
+			return false
+		}
+		c := prev.Type().Compare(prevMax, nextMin)
+		if keys[0].Desc {
+			c = -c
+		}
+		if c > 0 || c == 0 && len(keys) > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// sizeOf approximates the memory held by v, including referenced strings,
+// slices, maps and pointers.
+func sizeOf(v reflect.Value) uint64 {
+	return uint64(v.Type().Size()) + sizeOfRefs(v)
+}
+
+func sizeOfRefs(v reflect.Value) uint64 {
+	var n uint64
+	switch v.Kind() {
+	case reflect.String:
+		n += uint64(v.Len())
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			n += sizeOf(v.Elem())
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			n += sizeOf(v.Index(i))
+		}
+	case reflect.Array:
+		for i := range v.Len() {
+			n += sizeOfRefs(v.Index(i))
+		}
+	case reflect.Map:
+		for iter := v.MapRange(); iter.Next(); {
+			n += sizeOf(iter.Key()) + sizeOf(iter.Value())
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			n += sizeOfRefs(v.Field(i))
+		}
+	}
+	return n
+}
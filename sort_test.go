@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+var orderByTests = []struct {
+	Order OrderBy
+	Want  []sortKey
+}{
+	{"A", []sortKey{{"A", false}}},
+	{"A asc", []sortKey{{"A", false}}},
+	{"A DESC", []sortKey{{"A", true}}},
+	{"B desc, D.E", []sortKey{{"B", true}, {"D.E", false}}},
+}
+
+func TestParseOrderBy(t *testing.T) {
+	for _, tt := range orderByTests {
+		t.Run(string(tt.Order), func(t *testing.T) {
+			keys, err := ParseOrderBy(tt.Order, schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(keys, tt.Want) {
+				t.Errorf("keys: got %+v want %+v", keys, tt.Want)
+			}
+		})
+	}
+
+	for _, bad := range []OrderBy{"", "Z", "D.Z", "A sideways", "A asc desc", "A,,B"} {
+		if _, err := ParseOrderBy(bad, schema); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestSortedByMetadata(t *testing.T) {
+	err := newInputs(nil).withFile("testdata/parquet/sorted.parquet", func(pf *parquet.File) error {
+		rowType := new(schemata).LogicalTagged(pf.Schema())
+		for order, want := range map[OrderBy]bool{
+			"n":         true,
+			"n asc":     true,
+			"n desc":    false,
+			"s":         false,
+			"n, s":      false,
+			"s desc, n": false,
+		} {
+			keys, err := ParseOrderBy(order, rowType)
+			if err != nil {
+				return err
+			}
+			if got := sortedByMetadata(pf, keys); got != want {
+				t.Errorf("%q: got %v want %v", order, got, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompareValue(t *testing.T) {
+	one, two := 1, 2
+	tests := []struct {
+		A, B any
+		Want int
+	}{
+		{1, 2, -1},
+		{"b", "a", 1},
+		{Date(3), Date(3), 0},
+		{StampMilliUTC(-1), StampMilliUTC(1), -1},
+		{(*int)(nil), &one, -1},
+		{&two, &one, 1},
+		{[]int{1, 2}, []int{1}, 1},
+		{[]byte("ab"), []byte("b"), -1},
+		{struct{ A, B int }{1, 2}, struct{ A, B int }{1, 3}, -1},
+	}
+	for _, tt := range tests {
+		if got := compareValue(reflect.ValueOf(tt.A), reflect.ValueOf(tt.B)); got != tt.Want {
+			t.Errorf("compare(%v, %v): got %d want %d", tt.A, tt.B, got, tt.Want)
+		}
+	}
+}
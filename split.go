@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// splitOptions control how a file is divided into parts.
+type splitOptions struct {
+	Rows  int64
+	Parts int64
+	Size  uint64
+	By    string
+	Open  int // most files written at once
+}
+
+// hiveDefault names the partition of rows whose --by column is nil.
+const hiveDefault = "__HIVE_DEFAULT_PARTITION__"
+
+func splitFile(ctx run.Context, split *splitOptions, writes *writeOptions, file string, typer *schemata, in *inputs) error {
+	return in.withFile(file, func(pf *parquet.File) error {
+		limit, err := split.rowsPerPart(pf)
+		if err != nil {
+			return err
+		}
+		if split.Open < 1 {
+			return errors.New("--open must be positive")
+		}
+		partition, err := newPartitioner(split.By, pf.Schema(), typer.LogicalTagged(pf.Schema()))
+		if err != nil {
+			return err
+		}
+		s := &splitter{
+			ctx:     ctx,
+			writes:  writes,
+			schema:  pf.Schema(),
+			meta:    pf.Metadata().KeyValueMetadata,
+			limit:   limit,
+			maxOpen: split.Open,
+			parts:   map[string]*splitPart{},
+		}
+		buf := make([]parquet.Row, 64)
+		for _, rg := range pf.RowGroups() {
+			rows := rg.Rows()
+			for {
+				n, err := rows.ReadRows(buf)
+				for _, row := range buf[:n] {
+					if werr := s.write(partition(row), row); werr != nil {
+						return errors.Join(werr, rows.Close(), s.close())
+					}
+				}
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					return errors.Join(fmt.Errorf("%s: %w", file, err), rows.Close(), s.close())
+				}
+			}
+			if err := rows.Close(); err != nil {
+				return errors.Join(err, s.close())
+			}
+		}
+		return s.close()
+	})
+}
+
+// rowsPerPart returns the number of rows to write to each part, or zero for
+// no limit.
+func (o *splitOptions) rowsPerPart(pf *parquet.File) (int64, error) {
+	set := 0
+	for _, n := range []uint64{uint64(o.Rows), uint64(o.Parts), o.Size} {
+		if n != 0 {
+			set++
+		}
+	}
+	switch {
+	case set > 1:
+		return 0, errors.New("only one of --rows, --parts, or --size may be used")
+	case set == 0 && o.By == "":
+		return 0, errors.New("split requires --rows, --parts, --size, or --by")
+	case o.Rows < 0 || o.Parts < 0:
+		return 0, errors.New("--rows and --parts must be positive")
+	}
+
+	numRows := pf.Metadata().NumRows
+	switch {
+	case o.Rows > 0:
+		return o.Rows, nil
+	case o.Parts > 0:
+		return max(1, (numRows+o.Parts-1)/o.Parts), nil
+	case o.Size > 0 && numRows > 0:
+		// Estimate rows per part from the average stored size of a row.
+		var size int64
+		for _, rg := range pf.Metadata().RowGroups {
+			if rg.TotalCompressedSize > 0 {
+				size += rg.TotalCompressedSize
+			} else {
+				size += rg.TotalByteSize
+			}
+		}
+		perRow := max(1, size/numRows)
+		return max(1, int64(o.Size)/perRow), nil
+	}
+	return 0, nil
+}
+
+// newPartitioner returns a function that names the directory of each row's
+// partition, as column=value. Without a column, all rows share the same
+// unnamed partition.
+func newPartitioner(column string, schema *parquet.Schema, rowType reflect.Type) (func(parquet.Row) string, error) {
+	if column == "" {
+		return func(parquet.Row) string { return "" }, nil
+	}
+	path := strings.Split(column, ".")
+	leaf, ok := schema.Lookup(path...)
+	if !ok || !leaf.Node.Leaf() {
+		return nil, fmt.Errorf("split by %q: unknown column", column)
+	}
+	if leaf.MaxRepetitionLevel > 0 {
+		return nil, fmt.Errorf("split by %q: cannot split by repeated column", column)
+	}
+	if _, ok := reLookupType(rowType, column); !ok {
+		return nil, fmt.Errorf("split by %q: unknown field", column)
+	}
+
+	names := map[string]string{}
+	return func(row parquet.Row) string {
+		var pv parquet.Value
+		for _, v := range row {
+			if v.Column() == leaf.ColumnIndex {
+				pv = v
+				break
+			}
+		}
+		if pv.IsNull() {
+			return column + "=" + hiveDefault
+		}
+		key := string(pv.Bytes())
+		if name, ok := names[key]; ok {
+			return name
+		}
+		name := column + "=" + url.PathEscape(logicalText(rowType, path, pv))
+		names[key] = name
+		return name
+	}, nil
+}
+
+// logicalText formats a physical value as the logical field at path of
+// rowType, or as itself if that field cannot hold it.
+func logicalText(rowType reflect.Type, path []string, pv parquet.Value) string {
+	v := reflect.New(rowType).Elem()
+	if !setStat(v, path, pv) {
+		return pv.String()
+	}
+	for _, step := range path {
+		v = reValueField(reflect.Indirect(v), step)
+	}
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if tm, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if b, err := tm.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		return string(v.Bytes())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+type splitter struct {
+	ctx     run.Context
+	writes  *writeOptions
+	schema  *parquet.Schema
+	meta    []format.KeyValue
+	limit   int64
+	maxOpen int
+	parts   map[string]*splitPart
+	order   []*splitPart
+	open    []*splitPart // with files being written, least recently first
+}
+
+// splitPart tracks the file currently written for a partition.
+type splitPart struct {
+	dir   string
+	index int
+	rows  int64
+	name  string
+	file  *os.File
+	pw    *parquet.Writer
+}
+
+func (s *splitter) write(dir string, row parquet.Row) error {
+	part := s.parts[dir]
+	if part == nil {
+		part = &splitPart{dir: dir}
+		s.parts[dir] = part
+		s.order = append(s.order, part)
+	}
+	if part.pw == nil || s.limit > 0 && part.rows >= s.limit {
+		if err := s.next(part); err != nil {
+			return err
+		}
+	} else if last := len(s.open) - 1; s.open[last] != part {
+		i := slices.Index(s.open, part)
+		s.open = append(slices.Delete(s.open, i, i+1), part)
+	}
+	part.rows++
+	_, err := part.pw.WriteRows([]parquet.Row{row})
+	return err
+}
+
+// next finishes the current file of part, if any, and starts its next one.
+// If too many files are open, that of the partition least recently written
+// is finished, and its later rows start its next file.
+func (s *splitter) next(part *splitPart) error {
+	if err := s.finish(part); err != nil {
+		return err
+	}
+	if len(s.open) >= s.maxOpen {
+		if err := s.finish(s.open[0]); err != nil {
+			return err
+		}
+	}
+	dir := filepath.Join(s.writes.Output, filepath.FromSlash(part.dir))
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("part-%d.parquet", part.index))
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	part.index++
+	part.rows = 0
+	part.name, part.file = name, f
+	part.pw = s.writes.writer(f, s.schema, s.meta)
+	s.open = append(s.open, part)
+	return nil
+}
+
+func (s *splitter) finish(part *splitPart) error {
+	if part.pw == nil {
+		return nil
+	}
+	err := errors.Join(part.pw.Close(), part.file.Close())
+	part.pw, part.file = nil, nil
+	s.open = slices.DeleteFunc(s.open, func(p *splitPart) bool { return p == part })
+	if err != nil {
+		return fmt.Errorf("%s: %w", part.name, err)
+	}
+	_, err = fmt.Fprintf(s.ctx.Stdout, "%s: %d rows\n", filepath.ToSlash(part.name), part.rows)
+	return err
+}
+
+func (s *splitter) close() error {
+	var errs []error
+	for _, part := range s.order {
+		errs = append(errs, s.finish(part))
+	}
+	return errors.Join(errs...)
+}
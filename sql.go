@@ -0,0 +1,1159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+)
+
+func printSQL(ctx run.Context, format DataFormat, query Query, typer *schemata, rows *rowOptions, in *inputs) error {
+	stmt, err := parseSQL(query)
+	if err != nil {
+		return err
+	}
+	p := &sqlPlanner{typer: typer, in: in.withMemory(rows.Memory)}
+	defer p.close()
+	q, err := p.plan(stmt, rows.Memory)
+	if err != nil {
+		return err
+	}
+	return withWriter(format, ctx.Stdout, q.run)
+}
+
+// errSQLDone stops reading rows once the LIMIT has been written.
+var errSQLDone = errors.New("sql: limit reached")
+
+// sqlTable is a parquet file named in FROM or JOIN. Only the top level
+// columns a query uses are read.
+type sqlTable struct {
+	alias    string
+	close    func() error
+	pf       *parquet.File
+	rowType  reflect.Type
+	readType reflect.Type
+	used     map[string]bool
+	nullable bool // whether an outer join may leave it without a row
+}
+
+type sqlColumnRef struct {
+	typ     reflect.Type
+	scale   int32
+	decimal bool
+}
+
+type sqlMode int8
+
+const (
+	sqlRows   sqlMode = iota // expressions over the rows of the tables
+	sqlProbe                 // expressions whose columns and aggregates are sought
+	sqlGroups                // expressions over groups of rows
+)
+
+// sqlPlanner translates a SELECT statement into expr programs. Expressions
+// over rows see each table as a field t0, t1, … of their environment, while
+// expressions over groups see group keys as K0, K1, … and aggregates as A0,
+// A1, ….
+type sqlPlanner struct {
+	typer  *schemata
+	in     *inputs
+	tables []*sqlTable
+	mode   sqlMode
+	env    reflect.Type
+	keys   []sqlText
+	aggs   []*sqlAgg
+}
+
+type sqlAgg struct {
+	id   string
+	arg  sqlText
+	typ  reflect.Type
+	prog *vm.Program
+	col  aggColumn
+}
+
+func (p *sqlPlanner) close() {
+	for _, t := range p.tables {
+		t.close()
+	}
+}
+
+func (p *sqlPlanner) translate(n sqlNode) (sqlText, error) {
+	if p.mode != sqlGroups {
+		return n.translate(p)
+	}
+	// Over groups, expressions matching a group key refer to it instead.
+	p.mode = sqlProbe
+	t, err := n.translate(p)
+	p.mode = sqlGroups
+	if err == nil && t.columns && !t.agg {
+		for i, k := range p.keys {
+			if k.expr == t.expr {
+				return sqlText{expr: "K" + strconv.Itoa(i), nullable: k.nullable, column: k.column}, nil
+			}
+		}
+	}
+	return n.translate(p)
+}
+
+func (p *sqlPlanner) open(ref *sqlTableRef) error {
+	name := unquoteSQL(ref.Path)
+	t := &sqlTable{alias: unquoteSQL(ref.Alias), used: map[string]bool{}}
+	if t.alias == "" {
+		t.alias = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	}
+	for _, o := range p.tables {
+		if o.alias == t.alias {
+			return fmt.Errorf("table %q specified more than once", t.alias)
+		}
+	}
+	f, size, closer, err := p.in.open(name)
+	if err != nil {
+		return err
+	}
+	t.close = closer
+	p.tables = append(p.tables, t)
+	if t.pf, err = parquet.OpenFile(f, size); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	t.rowType = p.typer.LogicalTagged(t.pf.Schema())
+	return nil
+}
+
+// column resolves a possibly qualified column name. Unqualified names must
+// belong to exactly one table.
+func (p *sqlPlanner) column(c *sqlColumn) (sqlText, error) {
+	path := make([]string, len(c.Path))
+	for i, step := range c.Path {
+		path[i] = unquoteSQL(step)
+	}
+	name := strings.Join(path, ".")
+	if p.mode == sqlGroups {
+		return sqlText{}, fmt.Errorf("column %s must appear in GROUP BY or be used in an aggregate", name)
+	}
+
+	table := -1
+	if len(path) > 1 {
+		for i, t := range p.tables {
+			if t.alias == path[0] {
+				table, path = i, path[1:]
+			}
+		}
+	}
+	if table < 0 {
+		for i, t := range p.tables {
+			if _, ok := reTypeField(t.rowType, path[0]); ok {
+				if table >= 0 {
+					return sqlText{}, fmt.Errorf("column %s is ambiguous", name)
+				}
+				table = i
+			}
+		}
+	}
+	if table < 0 {
+		return sqlText{}, fmt.Errorf("unknown column %s", name)
+	}
+
+	t := p.tables[table]
+	text := "t" + strconv.Itoa(table)
+	ft := reflect.PointerTo(t.rowType)
+	null := t.nullable
+	for _, step := range path {
+		access := "["
+		if ft.Kind() == reflect.Pointer {
+			if text != "t"+strconv.Itoa(table) || t.nullable {
+				access = "?.["
+			}
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct {
+			return sqlText{}, fmt.Errorf("unknown column %s", name)
+		}
+		f, ok := reTypeField(ft, step)
+		if !ok {
+			return sqlText{}, fmt.Errorf("unknown column %s", name)
+		}
+		text += access + strconv.Quote(step) + "]"
+		ft = f.Type
+		null = null || ft.Kind() == reflect.Pointer
+	}
+	t.used[path[0]] = true
+
+	ref := &sqlColumnRef{typ: ft}
+	if t.nullable {
+		ref.typ = nullable(ft)
+	}
+	ref.scale, ref.decimal = decimalScale(t.pf.Schema(), strings.Join(path, "."))
+	if ref.decimal {
+		// Decimals are scaled as they are read, so that every clause sees
+		// their values rather than their storage.
+		fn := "sql_decimal"
+		ref.typ = reflect.TypeFor[Decimal]()
+		if null {
+			fn, ref.typ = "sql_nullable_decimal", reflect.TypeFor[*Decimal]()
+		}
+		text = fn + "(" + text + ", " + strconv.Itoa(int(ref.scale)) + ")"
+	}
+	return sqlText{expr: text, nullable: null, tables: 1 << table, columns: true, column: ref}, nil
+}
+
+func (p *sqlPlanner) call(c *sqlCall) (sqlText, error) {
+	fn := strings.ToLower(c.Func)
+	switch fn {
+	case "count", "sum", "avg", "min", "max":
+		return p.aggregate(fn, c)
+	}
+	if c.Star || c.Distinct {
+		return sqlText{}, fmt.Errorf("%s is not an aggregate", fn)
+	}
+	args := make([]sqlText, len(c.Args))
+	for i, arg := range c.Args {
+		var err error
+		if args[i], err = p.translate(arg); err != nil {
+			return sqlText{}, err
+		}
+	}
+	if fn == "coalesce" {
+		if len(args) == 0 {
+			return sqlText{}, errors.New("coalesce requires an argument")
+		}
+		texts := make([]string, len(args))
+		for i, a := range args {
+			texts[i] = a.expr
+		}
+		return merge("("+strings.Join(texts, " ?? ")+")", args[len(args)-1].nullable, args...), nil
+	}
+	if len(args) != 1 {
+		return sqlText{}, fmt.Errorf("%s takes one argument", fn)
+	}
+	switch fn {
+	case "lower", "upper", "abs", "round", "floor", "ceil":
+		return guard(fn+"("+args[0].expr+")", args[0]), nil
+	case "length":
+		return guard("len("+args[0].expr+")", args[0]), nil
+	case "year", "month", "day", "hour", "date":
+		return guard("sql_"+fn+"("+args[0].expr+")", args[0]), nil
+	}
+	return sqlText{}, fmt.Errorf("unknown function %s", c.Func)
+}
+
+// aggregate translates an aggregate function. Over groups, each distinct
+// aggregate becomes a column of the grouped rows.
+func (p *sqlPlanner) aggregate(fn string, c *sqlCall) (sqlText, error) {
+	if c.Distinct {
+		if fn != "count" {
+			return sqlText{}, fmt.Errorf("%s does not support DISTINCT", fn)
+		}
+		fn = "count_distinct"
+	}
+	if c.Star && fn != "count" || !c.Star && len(c.Args) != 1 {
+		return sqlText{}, fmt.Errorf("%s takes one argument", fn)
+	}
+	if p.mode == sqlRows {
+		return sqlText{}, fmt.Errorf("aggregate %s is not allowed here", fn)
+	}
+
+	mode := p.mode
+	p.mode = sqlRows
+	var arg sqlText
+	var err error
+	if !c.Star {
+		arg, err = p.translate(c.Args[0])
+	}
+	p.mode = mode
+	if err != nil || mode == sqlProbe {
+		return sqlText{expr: fn, agg: true}, err
+	}
+
+	id := fn + "(" + arg.expr + ")"
+	for i, a := range p.aggs {
+		if a.id == id {
+			return sqlText{expr: "A" + strconv.Itoa(i), nullable: a.col.typ.Kind() == reflect.Pointer, agg: true}, nil
+		}
+	}
+	a := &sqlAgg{id: id, arg: arg}
+	var scale int32
+	var decimal bool
+	if !c.Star {
+		if a.prog, a.typ, err = p.compile(arg, p.env); err != nil {
+			return sqlText{}, err
+		}
+		if arg.column != nil {
+			scale, decimal = arg.column.scale, arg.column.decimal
+		}
+	}
+	if a.col, err = aggregateColumn(fn, a.typ, scale, decimal); err != nil {
+		return sqlText{}, fmt.Errorf("%s: %w", id, err)
+	}
+	if a.typ != nil {
+		a.col.source = "X" + strconv.Itoa(len(p.aggs))
+	}
+	p.aggs = append(p.aggs, a)
+	return sqlText{expr: "A" + strconv.Itoa(len(p.aggs)-1), nullable: a.col.typ.Kind() == reflect.Pointer, agg: true}, nil
+}
+
+// compile compiles t for evaluation in env, returning the type of its values.
+func (p *sqlPlanner) compile(t sqlText, env reflect.Type) (*vm.Program, reflect.Type, error) {
+	prog, err := expr.Compile(t.expr, append(exprOptions(env), sqlFunctions()...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.column != nil {
+		return prog, t.column.typ, nil
+	}
+	typ := prog.Node().Type()
+	if typ == nil || typ.Kind() == reflect.Interface {
+		return prog, reflect.TypeFor[any](), nil
+	}
+	if t.nullable {
+		typ = nullable(typ)
+	}
+	return prog, typ, nil
+}
+
+// compileBool compiles a condition, which may also be nil.
+func (p *sqlPlanner) compileBool(what string, t sqlText, env reflect.Type) (*vm.Program, error) {
+	prog, typ, err := p.compile(t, env)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", what, err)
+	}
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if k := typ.Kind(); k != reflect.Bool && k != reflect.Interface {
+		return nil, fmt.Errorf("%s: expected a condition, not %s", what, typ)
+	}
+	return prog, nil
+}
+
+func sqlFunctions() []expr.Option {
+	var opts []expr.Option
+	for _, name := range []string{"year", "month", "day", "hour", "date"} {
+		part, typ := timePart(name)
+		opts = append(opts, expr.Function("sql_"+name,
+			func(params ...any) (any, error) {
+				t, ok := timeOf(reflect.ValueOf(params[0]))
+				if !ok {
+					return nil, fmt.Errorf("%s requires a date, time or timestamp, not %T", name, params[0])
+				}
+				return reflect.ValueOf(part(t)).Convert(typ).Interface(), nil
+			},
+			reflect.New(reflect.FuncOf([]reflect.Type{reflect.TypeFor[any]()}, []reflect.Type{typ}, false)).Interface(),
+		))
+	}
+
+	// Decimal columns are read from their storage with their scale.
+	opts = append(opts,
+		expr.Function("sql_decimal",
+			func(params ...any) (any, error) {
+				return decimalOf(reflect.ValueOf(params[0]), int32(params[1].(int)))
+			},
+			new(func(any, int) Decimal),
+		),
+		expr.Function("sql_nullable_decimal",
+			func(params ...any) (any, error) {
+				v, ok := present(reflect.ValueOf(params[0]))
+				if !ok {
+					return nil, nil
+				}
+				d, err := decimalOf(v, int32(params[1].(int)))
+				return &d, err
+			},
+			new(func(any, int) *Decimal),
+		),
+	)
+
+	// Decimals compare to numbers and each other, and stay exact in sums,
+	// differences, and products with integers and each other. Quotients,
+	// and arithmetic with floats, are float64.
+	var numbers []reflect.Type
+	for _, v := range []any{Decimal{}, 0, int8(0), int16(0), int32(0), int64(0), uint(0), uint8(0), uint16(0), uint32(0), uint64(0), float32(0), 0.0} {
+		t := reflect.TypeOf(v)
+		numbers = append(numbers, t, reflect.PointerTo(t))
+	}
+	decimals := numbers[:2]
+	isFloatArg := func(t reflect.Type) bool { return isFloat(t) || t.Kind() == reflect.Pointer && isFloat(t.Elem()) }
+	signatures := func(result func(a, b reflect.Type) reflect.Type) []any {
+		var sigs []any
+		for _, a := range numbers {
+			for _, b := range numbers {
+				if slices.Contains(decimals, a) || slices.Contains(decimals, b) {
+					sig := reflect.FuncOf([]reflect.Type{a, b}, []reflect.Type{result(a, b)}, false)
+					sigs = append(sigs, reflect.New(sig).Interface())
+				}
+			}
+		}
+		return sigs
+	}
+	for op, is := range map[string]func(int) bool{
+		"==": func(n int) bool { return n == 0 },
+		"!=": func(n int) bool { return n != 0 },
+		"<":  func(n int) bool { return n < 0 },
+		"<=": func(n int) bool { return n <= 0 },
+		">":  func(n int) bool { return n > 0 },
+		">=": func(n int) bool { return n >= 0 },
+	} {
+		name := "sql_decimal" + op
+		opts = append(opts,
+			expr.Operator(op, name),
+			expr.Function(name,
+				func(params ...any) (any, error) { return is(ratOf(params[0]).Cmp(ratOf(params[1]))), nil },
+				signatures(func(a, b reflect.Type) reflect.Type { return reflect.TypeFor[bool]() })...,
+			),
+		)
+	}
+	for _, op := range []string{"+", "-", "*", "/"} {
+		name := "sql_decimal" + op
+		opts = append(opts,
+			expr.Operator(op, name),
+			expr.Function(name,
+				func(params ...any) (any, error) {
+					a, aok := decimalArg(params[0])
+					b, bok := decimalArg(params[1])
+					if aok && bok && op != "/" {
+						return decimalArith(op, a, b), nil
+					}
+					x, y := floatArg(params[0]), floatArg(params[1])
+					switch op {
+					case "+":
+						return x + y, nil
+					case "-":
+						return x - y, nil
+					case "*":
+						return x * y, nil
+					}
+					return x / y, nil
+				},
+				signatures(func(a, b reflect.Type) reflect.Type {
+					if op == "/" || isFloatArg(a) || isFloatArg(b) {
+						return reflect.TypeFor[float64]()
+					}
+					return reflect.TypeFor[Decimal]()
+				})...,
+			),
+		)
+	}
+	return opts
+}
+
+// decimalArg returns the exact value of an argument to a decimal operator,
+// reporting false for a float.
+func decimalArg(v any) (Decimal, bool) {
+	rv, _ := present(reflect.ValueOf(v))
+	switch {
+	case rv.Type() == reflect.TypeFor[Decimal]():
+		return rv.Interface().(Decimal), true
+	case rv.CanInt():
+		return Decimal{Unscaled: big.NewInt(rv.Int())}, true
+	case rv.CanUint():
+		return Decimal{Unscaled: new(big.Int).SetUint64(rv.Uint())}, true
+	}
+	return Decimal{}, false
+}
+
+// floatArg returns the value of an argument to a decimal operator as float64.
+func floatArg(v any) float64 {
+	if d, ok := decimalArg(v); ok {
+		return d.Float64()
+	}
+	rv, _ := present(reflect.ValueOf(v))
+	return rv.Float()
+}
+
+// decimalArith returns the exact sum, difference, or product of a and b.
+func decimalArith(op string, a, b Decimal) Decimal {
+	if op == "*" {
+		a = a.rescale(a.Scale)
+		a.Unscaled.Mul(a.Unscaled, b.rescale(b.Scale).Unscaled)
+		a.Scale += b.Scale
+		return a
+	}
+	scale := max(a.Scale, b.Scale)
+	a, b = a.rescale(scale), b.rescale(scale)
+	if op == "-" {
+		a.Unscaled.Sub(a.Unscaled, b.Unscaled)
+	} else {
+		a.Unscaled.Add(a.Unscaled, b.Unscaled)
+	}
+	return a
+}
+
+func ratOf(v any) *big.Rat {
+	if d, ok := decimalArg(v); ok {
+		return d.Rat()
+	}
+	if r := new(big.Rat).SetFloat64(floatArg(v)); r != nil {
+		return r
+	}
+	return new(big.Rat)
+}
+
+// sqlQuery is a planned SELECT statement. Rows of the first table are read
+// one at a time and joined in turn with the rows of each other table, which
+// are held in memory. Joined rows are filtered by WHERE, then either
+// projected onto the select list, or grouped and aggregated before HAVING
+// filters the groups and they are projected. Projected rows carry hidden
+// fields for ORDER BY, which are removed before writing.
+type sqlQuery struct {
+	tables []*sqlTable
+	env    reflect.Type
+	joins  []*sqlJoinStage
+	where  *vm.Program
+
+	inter     reflect.Type
+	interExpr []*vm.Program
+	group     *aggregation
+	having    *vm.Program
+
+	out     reflect.Type
+	outExpr []*vm.Program
+	visible reflect.Type
+	order   []sortKey
+	budget  uint64
+	limit   *int64
+	offset  int64
+}
+
+// sqlJoinStage joins a table to the rows of those before it. Rows are found
+// by hashing equalities in ON between this table and earlier ones, and
+// checked against the whole ON condition.
+type sqlJoinStage struct {
+	kind      string
+	rows      []reflect.Value
+	matched   []bool
+	index     map[string][]int
+	leftKeys  []*vm.Program
+	rightKeys []*vm.Program
+	on        *vm.Program
+}
+
+type sqlOutColumn struct {
+	name string
+	text sqlText
+}
+
+func (p *sqlPlanner) plan(stmt *sqlSelect, budget uint64) (*sqlQuery, error) {
+	q := &sqlQuery{budget: budget, limit: stmt.Limit, offset: stmt.Offset}
+	if err := p.open(stmt.From); err != nil {
+		return nil, err
+	}
+	kinds := []string{""}
+	for _, j := range stmt.Joins {
+		if err := p.open(j.Table); err != nil {
+			return nil, err
+		}
+		kind := strings.ToUpper(j.Type)
+		if kind == "" {
+			kind = "INNER"
+		}
+		kinds = append(kinds, kind)
+	}
+	for i, t := range p.tables {
+		t.nullable = kinds[i] == "LEFT" || kinds[i] == "FULL"
+		for _, kind := range kinds[i+1:] {
+			t.nullable = t.nullable || kind == "RIGHT" || kind == "FULL"
+		}
+	}
+	q.tables = p.tables
+
+	grouped, err := p.probe(stmt)
+	if err != nil {
+		return nil, err
+	}
+	var env []reflect.StructField
+	for i, t := range p.tables {
+		var fields []reflect.StructField
+		for i := range t.rowType.NumField() {
+			if f := t.rowType.Field(i); t.used[reFieldName(f)] {
+				fields = append(fields, f)
+			}
+		}
+		if len(fields) == 0 {
+			fields = append(fields, t.rowType.Field(0))
+		}
+		t.readType = reflect.StructOf(fields)
+		env = append(env, reflect.StructField{
+			Name: "T" + strconv.Itoa(i),
+			Type: reflect.PointerTo(t.readType),
+			Tag:  reflect.StructTag(`expr:"t` + strconv.Itoa(i) + `"`),
+		})
+	}
+	p.env = reflect.StructOf(env)
+	q.env = p.env
+
+	for k, j := range stmt.Joins {
+		stage, err := p.join(k+1, kinds[k+1], j)
+		if err != nil {
+			return nil, err
+		}
+		q.joins = append(q.joins, stage)
+	}
+	if stmt.Where != nil {
+		where, err := p.translate(stmt.Where)
+		if err != nil {
+			return nil, fmt.Errorf("where: %w", err)
+		}
+		if q.where, err = p.compileBool("where", where, p.env); err != nil {
+			return nil, err
+		}
+	}
+	if grouped {
+		for _, by := range stmt.GroupBy {
+			key, err := p.translate(by)
+			if err != nil {
+				return nil, fmt.Errorf("group by: %w", err)
+			}
+			p.keys = append(p.keys, key)
+		}
+		p.mode = sqlGroups
+	}
+
+	cols, err := p.selectList(stmt.Items)
+	if err != nil {
+		return nil, err
+	}
+	var having sqlText
+	if stmt.Having != nil {
+		if having, err = p.translate(stmt.Having); err != nil {
+			return nil, fmt.Errorf("having: %w", err)
+		}
+	}
+	var order []sqlText
+	for _, o := range stmt.OrderBy {
+		t, err := p.orderTerm(o, cols)
+		if err != nil {
+			return nil, fmt.Errorf("order by: %w", err)
+		}
+		order = append(order, t)
+		q.order = append(q.order, sortKey{Source: "parquetry_sort_" + strconv.Itoa(len(order)-1), Desc: o.Desc})
+	}
+
+	outEnv := p.env
+	if grouped {
+		if outEnv, err = p.grouping(q); err != nil {
+			return nil, err
+		}
+		if stmt.Having != nil {
+			if q.having, err = p.compileBool("having", having, outEnv); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var fields []reflect.StructField
+	for _, c := range cols {
+		prog, typ, err := p.compile(c.text, outEnv)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+		q.outExpr = append(q.outExpr, prog)
+		fields = append(fields, reflect.StructField{
+			Name: fieldName(c.name),
+			Type: typ,
+			Tag:  reflect.StructTag(fmt.Sprintf("json:%[1]q parquet:%[1]q expr:%[1]q", c.name)),
+		})
+	}
+	q.visible = reflect.StructOf(fields)
+	for i, o := range order {
+		prog, typ, err := p.compile(o, outEnv)
+		if err != nil {
+			return nil, fmt.Errorf("order by: %w", err)
+		}
+		q.outExpr = append(q.outExpr, prog)
+		fields = append(fields, reflect.StructField{
+			Name: "Sort_" + strconv.Itoa(i),
+			Type: typ,
+			Tag:  reflect.StructTag(`parquet:"parquetry_sort_` + strconv.Itoa(i) + `"`),
+		})
+	}
+	q.out = reflect.StructOf(fields)
+	return q, nil
+}
+
+// probe finds the columns a statement uses, and whether it aggregates.
+func (p *sqlPlanner) probe(stmt *sqlSelect) (bool, error) {
+	p.mode = sqlProbe
+	defer func() { p.mode = sqlRows }()
+	grouped := len(stmt.GroupBy) > 0 || stmt.Having != nil
+	var exprs []*sqlExpr
+	for _, item := range stmt.Items {
+		if item.Expr != nil {
+			exprs = append(exprs, item.Expr)
+			continue
+		}
+		for _, t := range p.tables {
+			if item.Star || t.alias == unquoteSQL(item.TableStar) {
+				for i := range t.rowType.NumField() {
+					t.used[reFieldName(t.rowType.Field(i))] = true
+				}
+			}
+		}
+	}
+	for _, j := range stmt.Joins {
+		exprs = append(exprs, j.On)
+	}
+	if stmt.Where != nil {
+		exprs = append(exprs, stmt.Where)
+	}
+	exprs = append(exprs, stmt.GroupBy...)
+	if stmt.Having != nil {
+		exprs = append(exprs, stmt.Having)
+	}
+	for _, e := range exprs {
+		t, err := p.translate(e)
+		if err != nil {
+			return false, err
+		}
+		grouped = grouped || t.agg
+	}
+	// ORDER BY may name selected columns, so its errors are left for later.
+	for _, o := range stmt.OrderBy {
+		t, _ := p.translate(o.Expr)
+		grouped = grouped || t.agg
+	}
+	return grouped, nil
+}
+
+// selectList names and translates the columns of the select list. Columns
+// are named by their alias, column, or aggregate and its column, or
+// otherwise by position.
+func (p *sqlPlanner) selectList(items []*sqlItem) ([]sqlOutColumn, error) {
+	var cols []sqlOutColumn
+	names := map[string]bool{}
+	add := func(name, alias string, t sqlText) error {
+		if (names[name] || names[fieldName(name)]) && alias != "" {
+			name = alias + "." + name
+		}
+		if names[name] || names[fieldName(name)] {
+			return fmt.Errorf("duplicate column name %q", name)
+		}
+		names[name], names[fieldName(name)] = true, true
+		cols = append(cols, sqlOutColumn{name: name, text: t})
+		return nil
+	}
+	for n, item := range items {
+		if item.Expr == nil {
+			if p.mode == sqlGroups {
+				return nil, errors.New("cannot select * from groups")
+			}
+			for _, t := range p.tables {
+				if !item.Star && t.alias != unquoteSQL(item.TableStar) {
+					continue
+				}
+				for i := range t.rowType.NumField() {
+					name := reFieldName(t.rowType.Field(i))
+					c, err := p.column(&sqlColumn{Path: []string{t.alias, name}})
+					if err != nil {
+						return nil, err
+					}
+					if err := add(name, t.alias, c); err != nil {
+						return nil, err
+					}
+				}
+			}
+			continue
+		}
+		t, err := p.translate(item.Expr)
+		if err != nil {
+			return nil, err
+		}
+		name, alias := unquoteSQL(item.Alias), ""
+		if name == "" {
+			name, alias = item.Expr.defaultName(n+1, p.tables)
+		}
+		if err := add(name, alias, t); err != nil {
+			return nil, err
+		}
+	}
+	return cols, nil
+}
+
+// defaultName names a selected expression, returning also the alias of the
+// table of a column so that colliding names can be qualified.
+func (e *sqlExpr) defaultName(pos int, tables []*sqlTable) (string, string) {
+	col := "col" + strconv.Itoa(pos)
+	v := e.primary()
+	switch {
+	case v == nil:
+		return col, ""
+	case v.Column != nil:
+		path := v.Column.Path
+		alias := ""
+		for _, t := range tables {
+			if len(path) > 1 && t.alias == unquoteSQL(path[0]) {
+				alias = t.alias
+			}
+		}
+		return unquoteSQL(path[len(path)-1]), alias
+	case v.Call != nil:
+		fn := strings.ToLower(v.Call.Func)
+		if v.Call.Distinct {
+			fn += "_distinct"
+		}
+		if len(v.Call.Args) == 1 {
+			if arg := v.Call.Args[0].primary(); arg != nil && arg.Column != nil {
+				return fn + "_" + unquoteSQL(arg.Column.Path[len(arg.Column.Path)-1]), ""
+			}
+		}
+		return fn, ""
+	}
+	return col, ""
+}
+
+// primary returns the expression if it is a single value.
+func (e *sqlExpr) primary() *sqlPrimary {
+	if len(e.Or) != 1 || len(e.Or[0].And) != 1 {
+		return nil
+	}
+	cmp := e.Or[0].And[0].Cmp
+	if cmp == nil || cmp.Rest != nil || len(cmp.Left.Ops) != 0 || len(cmp.Left.Left.Ops) != 0 {
+		return nil
+	}
+	return cmp.Left.Left.Left.Value
+}
+
+// orderTerm translates an ORDER BY term, which may also be the position or
+// name of a selected column.
+func (p *sqlPlanner) orderTerm(o *sqlOrder, cols []sqlOutColumn) (sqlText, error) {
+	if v := o.Expr.primary(); v != nil {
+		if v.Number != nil {
+			n, err := strconv.Atoi(*v.Number)
+			if err != nil || n < 1 || n > len(cols) {
+				return sqlText{}, fmt.Errorf("position %s is not in the select list", *v.Number)
+			}
+			return cols[n-1].text, nil
+		}
+		if v.Column != nil && len(v.Column.Path) == 1 {
+			for _, c := range cols {
+				if c.name == unquoteSQL(v.Column.Path[0]) {
+					return c.text, nil
+				}
+			}
+		}
+	}
+	return p.translate(o.Expr)
+}
+
+// join plans joining table k to those before it.
+func (p *sqlPlanner) join(k int, kind string, j *sqlJoin) (*sqlJoinStage, error) {
+	stage := &sqlJoinStage{kind: kind}
+	on, err := p.translate(j.On)
+	if err != nil {
+		return nil, fmt.Errorf("on: %w", err)
+	}
+	if stage.on, err = p.compileBool("on", on, p.env); err != nil {
+		return nil, err
+	}
+	if len(j.On.Or) != 1 {
+		return stage, nil
+	}
+	before, this := uint64(1)<<k-1, uint64(1)<<k
+	for _, conj := range j.On.Or[0].And {
+		cmp := conj.Cmp
+		if cmp == nil || cmp.Rest == nil || cmp.Rest.Op != "=" {
+			continue
+		}
+		l, err := p.translate(cmp.Left)
+		if err != nil {
+			return nil, err
+		}
+		r, err := p.translate(cmp.Rest.Right)
+		if err != nil {
+			return nil, err
+		}
+		if l.tables == this {
+			l, r = r, l
+		}
+		if r.tables != this || l.tables == 0 || l.tables&^before != 0 {
+			continue
+		}
+		lp, _, err := p.compile(l, p.env)
+		if err != nil {
+			return nil, err
+		}
+		rp, _, err := p.compile(r, p.env)
+		if err != nil {
+			return nil, err
+		}
+		stage.leftKeys = append(stage.leftKeys, lp)
+		stage.rightKeys = append(stage.rightKeys, rp)
+	}
+	return stage, nil
+}
+
+// grouping creates the aggregation of the joined rows, returning the type
+// of the grouped rows. Joined rows are first evaluated into an intermediate
+// row holding the group keys K0, … and aggregate arguments X0, ….
+func (p *sqlPlanner) grouping(q *sqlQuery) (reflect.Type, error) {
+	ag := &aggregation{groups: map[string]*aggGroup{}}
+	var inter, group []reflect.StructField
+	for i, k := range p.keys {
+		prog, typ, err := p.compile(k, p.env)
+		if err != nil {
+			return nil, fmt.Errorf("group by: %w", err)
+		}
+		name := "K" + strconv.Itoa(i)
+		q.interExpr = append(q.interExpr, prog)
+		inter = append(inter, reflect.StructField{Name: name, Type: typ})
+		group = append(group, reflect.StructField{Name: name, Type: typ})
+		ag.keys = append(ag.keys, aggKey{source: name, typ: typ, eval: func(v reflect.Value) reflect.Value { return v }})
+	}
+	for i, a := range p.aggs {
+		if a.prog != nil {
+			q.interExpr = append(q.interExpr, a.prog)
+			inter = append(inter, reflect.StructField{Name: a.col.source, Type: a.typ})
+		}
+		ag.aggs = append(ag.aggs, a.col)
+		group = append(group, reflect.StructField{Name: "A" + strconv.Itoa(i), Type: a.col.typ})
+	}
+	q.inter = reflect.StructOf(inter)
+	ag.source = q.inter
+	ag.row = reflect.StructOf(group)
+	q.group = ag
+	return ag.row, nil
+}
+
+func (q *sqlQuery) run(w WriteFunc) error {
+	write := q.limitWrite(w)
+	var s *rowSorter
+	if len(q.order) > 0 {
+		s = &rowSorter{keys: q.order, budget: q.budget, rowType: q.out}
+		defer s.cleanup()
+		write = s.Write
+	}
+	project := func(env any) error {
+		row := reflect.New(q.out).Elem()
+		if err := evalInto(row, q.outExpr, env); err != nil {
+			return err
+		}
+		return write(row)
+	}
+
+	emit := func(env reflect.Value) error { return project(env.Interface()) }
+	if q.group != nil {
+		inter := reflect.New(q.inter).Elem()
+		emit = func(env reflect.Value) error {
+			inter.SetZero()
+			if err := evalInto(inter, q.interExpr, env.Interface()); err != nil {
+				return err
+			}
+			return q.group.Write(inter)
+		}
+	}
+	if q.where != nil {
+		next := emit
+		emit = func(env reflect.Value) error {
+			if ok, err := evalBool(q.where, env.Interface()); !ok || err != nil {
+				return err
+			}
+			return next(env)
+		}
+	}
+
+	err := q.scan(emit)
+	if err == nil && q.group != nil {
+		err = q.group.Flush(func(v reflect.Value) error {
+			if q.having != nil {
+				if ok, err := evalBool(q.having, v.Interface()); !ok || err != nil {
+					return err
+				}
+			}
+			return project(v.Interface())
+		})
+	}
+	if err == nil && s != nil {
+		err = s.Flush(q.limitWrite(w))
+	}
+	if errors.Is(err, errSQLDone) {
+		return nil
+	}
+	return err
+}
+
+// limitWrite removes hidden fields and applies OFFSET and LIMIT, stopping
+// the query once the last row is written.
+func (q *sqlQuery) limitWrite(w WriteFunc) WriteFunc {
+	var n int64
+	visible := reflect.New(q.visible).Elem()
+	return func(v reflect.Value) error {
+		n++
+		if n <= q.offset {
+			return nil
+		}
+		if q.limit != nil && n > q.offset+*q.limit {
+			return errSQLDone
+		}
+		if q.out != q.visible {
+			for i := range visible.NumField() {
+				visible.Field(i).Set(v.Field(i))
+			}
+			v = visible
+		}
+		if err := w(v); err != nil {
+			return err
+		}
+		if q.limit != nil && n == q.offset+*q.limit {
+			return errSQLDone
+		}
+		return nil
+	}
+}
+
+// scan emits each joined row of the tables.
+func (q *sqlQuery) scan(emit func(env reflect.Value) error) error {
+	for k, stage := range q.joins {
+		if err := stage.load(q.tables[k+1], k+1, q.env); err != nil {
+			return err
+		}
+	}
+
+	env := reflect.New(q.env).Elem()
+	first := q.tables[0]
+	err := eachRow(first.pf, rowSelection{}, first.readType, func(v reflect.Value) error {
+		env.SetZero()
+		env.Field(0).Set(v.Addr())
+		return q.stage(1, env, emit)
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, stage := range q.joins {
+		if stage.kind != "RIGHT" && stage.kind != "FULL" {
+			continue
+		}
+		for i, row := range stage.rows {
+			if !stage.matched[i] {
+				env.SetZero()
+				env.Field(k + 1).Set(row)
+				if err := q.stage(k+2, env, emit); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// stage joins the rows of table k and later to env.
+func (q *sqlQuery) stage(k int, env reflect.Value, emit func(reflect.Value) error) error {
+	if k > len(q.joins) {
+		return emit(env)
+	}
+	s := q.joins[k-1]
+	candidates, err := s.candidates(env)
+	if err != nil {
+		return err
+	}
+	matched := false
+	for _, i := range candidates {
+		env.Field(k).Set(s.rows[i])
+		ok, err := evalBool(s.on, env.Interface())
+		if err != nil {
+			return err
+		}
+		if ok {
+			matched, s.matched[i] = true, true
+			if err := q.stage(k+1, env, emit); err != nil {
+				return err
+			}
+		}
+	}
+	env.Field(k).SetZero()
+	if !matched && (s.kind == "LEFT" || s.kind == "FULL") {
+		return q.stage(k+1, env, emit)
+	}
+	return nil
+}
+
+// load reads the rows of table k, indexing them by their join keys.
+func (s *sqlJoinStage) load(t *sqlTable, k int, envType reflect.Type) error {
+	err := eachRow(t.pf, rowSelection{}, t.readType, func(v reflect.Value) error {
+		row := reflect.New(t.readType)
+		row.Elem().Set(v)
+		s.rows = append(s.rows, row)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.matched = make([]bool, len(s.rows))
+	if len(s.rightKeys) == 0 {
+		return nil
+	}
+	s.index = map[string][]int{}
+	env := reflect.New(envType).Elem()
+	for i, row := range s.rows {
+		env.Field(k).Set(row)
+		key, ok, err := evalKey(s.rightKeys, env.Interface())
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.index[key] = append(s.index[key], i)
+		}
+	}
+	return nil
+}
+
+// candidates returns the indexes of rows that may join env.
+func (s *sqlJoinStage) candidates(env reflect.Value) ([]int, error) {
+	if s.index == nil {
+		all := make([]int, len(s.rows))
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+	key, ok, err := evalKey(s.leftKeys, env.Interface())
+	if !ok || err != nil {
+		return nil, err
+	}
+	return s.index[key], nil
+}
+
+func evalKey(progs []*vm.Program, env any) (string, bool, error) {
+	vals := make([]reflect.Value, len(progs))
+	for i, prog := range progs {
+		out, err := expr.Run(prog, env)
+		if err != nil {
+			return "", false, err
+		}
+		vals[i] = reflect.ValueOf(out)
+	}
+	return encodeKey(vals)
+}
+
+// evalBool runs a condition, treating nil as false.
+func evalBool(prog *vm.Program, env any) (bool, error) {
+	out, err := expr.Run(prog, env)
+	return out == true, err
+}
+
+// evalInto sets each field of row to the value of the corresponding program.
+func evalInto(row reflect.Value, progs []*vm.Program, env any) error {
+	for i, prog := range progs {
+		out, err := expr.Run(prog, env)
+		if err != nil {
+			return err
+		}
+		if out == nil {
+			continue
+		}
+		if f := row.Field(i); f.Kind() == reflect.Interface {
+			f.Set(reflect.ValueOf(out))
+		} else {
+			assign(f, reflect.ValueOf(out))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+type Query string
+
+var (
+	sqlParserOnce sync.Once
+	sqlParser     *participle.Parser[sqlSelect]
+)
+
+func parseSQL(query Query) (*sqlSelect, error) {
+	sqlParserOnce.Do(func() {
+		sqlParser = participle.MustBuild[sqlSelect](
+			participle.Lexer(lexer.MustSimple([]lexer.SimpleRule{
+				{Name: "whitespace", Pattern: `\s+`},
+				{Name: "Keyword", Pattern: `(?i)\b(?:SELECT|FROM|AS|JOIN|INNER|LEFT|RIGHT|FULL|OUTER|ON|WHERE|GROUP|BY|HAVING|ORDER|ASC|DESC|LIMIT|OFFSET|AND|OR|NOT|IS|NULL|IN|BETWEEN|LIKE|TRUE|FALSE|DISTINCT|DATE|TIME|TIMESTAMP)\b`},
+				{Name: "Ident", Pattern: `[a-zA-Z_][a-zA-Z0-9_]*`},
+				{Name: "QuotedIdent", Pattern: `"(?:[^"]|"")*"`},
+				{Name: "String", Pattern: `'(?:[^']|'')*'`},
+				{Name: "Number", Pattern: `(?:\d+(?:\.\d*)?|\.\d+)(?:[eE][-+]?\d+)?`},
+				{Name: "Operator", Pattern: `<>|!=|<=|>=|\|\||[-+*/%=<>(),.;]`},
+			})),
+			participle.CaseInsensitive("Keyword"),
+			participle.UseLookahead(4),
+		)
+	})
+	return sqlParser.ParseString("query", string(query))
+}
+
+type sqlSelect struct {
+	Items   []*sqlItem   `parser:"'SELECT' @@ ( ',' @@ )*"`
+	From    *sqlTableRef `parser:"'FROM' @@"`
+	Joins   []*sqlJoin   `parser:"@@*"`
+	Where   *sqlExpr     `parser:"( 'WHERE' @@ )?"`
+	GroupBy []*sqlExpr   `parser:"( 'GROUP' 'BY' @@ ( ',' @@ )* )?"`
+	Having  *sqlExpr     `parser:"( 'HAVING' @@ )?"`
+	OrderBy []*sqlOrder  `parser:"( 'ORDER' 'BY' @@ ( ',' @@ )* )?"`
+	Limit   *int64       `parser:"( 'LIMIT' @Number"`
+	Offset  int64        `parser:"  ( 'OFFSET' @Number )? )? ';'?"`
+}
+
+type sqlItem struct {
+	Star      bool     `parser:"  @'*'"`
+	TableStar string   `parser:"| @( Ident | QuotedIdent ) '.' '*'"`
+	Expr      *sqlExpr `parser:"| @@"`
+	Alias     string   `parser:"  ( 'AS'? @( Ident | QuotedIdent ) )?"`
+}
+
+type sqlTableRef struct {
+	Path  string `parser:"@( String | QuotedIdent )"`
+	Alias string `parser:"( 'AS'? @( Ident | QuotedIdent ) )?"`
+}
+
+type sqlJoin struct {
+	Type  string       `parser:"( @( 'INNER' | 'LEFT' | 'RIGHT' | 'FULL' ) 'OUTER'? )?"`
+	Table *sqlTableRef `parser:"'JOIN' @@"`
+	On    *sqlExpr     `parser:"'ON' @@"`
+}
+
+type sqlOrder struct {
+	Expr *sqlExpr `parser:"@@"`
+	Desc bool     `parser:"( @'DESC' | 'ASC' )?"`
+}
+
+type sqlExpr struct {
+	Or []*sqlAnd `parser:"@@ ( 'OR' @@ )*"`
+}
+
+type sqlAnd struct {
+	And []*sqlNot `parser:"@@ ( 'AND' @@ )*"`
+}
+
+type sqlNot struct {
+	Not *sqlNot `parser:"  'NOT' @@"`
+	Cmp *sqlCmp `parser:"| @@"`
+}
+
+type sqlCmp struct {
+	Left *sqlSum     `parser:"@@"`
+	Rest *sqlCmpRest `parser:"@@?"`
+}
+
+type sqlCmpRest struct {
+	Op      string     `parser:"  @( '=' | '<>' | '!=' | '<=' | '>=' | '<' | '>' )"`
+	Right   *sqlSum    `parser:"  @@"`
+	Is      bool       `parser:"| @'IS'"`
+	IsNot   bool       `parser:"  @'NOT'? 'NULL'"`
+	Not     bool       `parser:"| @'NOT'?"`
+	In      []*sqlExpr `parser:"  ( 'IN' '(' @@ ( ',' @@ )* ')'"`
+	Between *sqlSum    `parser:"  | 'BETWEEN' @@"`
+	And     *sqlSum    `parser:"    'AND' @@"`
+	Like    *sqlSum    `parser:"  | 'LIKE' @@ )"`
+}
+
+type sqlSum struct {
+	Left *sqlProduct `parser:"@@"`
+	Ops  []*sqlSumOp `parser:"@@*"`
+}
+
+type sqlSumOp struct {
+	Op    string      `parser:"@( '+' | '-' | '||' )"`
+	Right *sqlProduct `parser:"@@"`
+}
+
+type sqlProduct struct {
+	Left *sqlUnary       `parser:"@@"`
+	Ops  []*sqlProductOp `parser:"@@*"`
+}
+
+type sqlProductOp struct {
+	Op    string    `parser:"@( '*' | '/' | '%' )"`
+	Right *sqlUnary `parser:"@@"`
+}
+
+type sqlUnary struct {
+	Neg   *sqlUnary   `parser:"  '-' @@"`
+	Value *sqlPrimary `parser:"| @@"`
+}
+
+type sqlPrimary struct {
+	Number *string    `parser:"  @Number"`
+	String *string    `parser:"| @String"`
+	Bool   *string    `parser:"| @( 'TRUE' | 'FALSE' )"`
+	Null   bool       `parser:"| @'NULL'"`
+	Typed  *sqlTyped  `parser:"| @@"`
+	Call   *sqlCall   `parser:"| @@"`
+	Column *sqlColumn `parser:"| @@"`
+	Paren  *sqlExpr   `parser:"| '(' @@ ')'"`
+}
+
+type sqlTyped struct {
+	Type  string `parser:"@( 'DATE' | 'TIME' | 'TIMESTAMP' )"`
+	Value string `parser:"@String"`
+}
+
+type sqlCall struct {
+	Func     string     `parser:"@Ident '('"`
+	Star     bool       `parser:"( @'*'"`
+	Distinct bool       `parser:"| @'DISTINCT'?"`
+	Args     []*sqlExpr `parser:"  ( @@ ( ',' @@ )* )? ) ')'"`
+}
+
+type sqlColumn struct {
+	Path []string `parser:"@( Ident | QuotedIdent ) ( '.' @( Ident | QuotedIdent | Keyword ) )*"`
+}
+
+// unquoteSQL removes the quotes from a SQL string or quoted identifier.
+func unquoteSQL(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		q := s[:1]
+		return strings.ReplaceAll(s[1:len(s)-1], q+q, q)
+	}
+	return s
+}
+
+// sqlText is a SQL expression translated to the expr language. Comparisons and
+// arithmetic involving nullable values are guarded to produce nil rather than
+// fail, approximating SQL's handling of NULL.
+type sqlText struct {
+	expr     string
+	nullable bool
+	tables   uint64 // bitmask of tables referenced
+	columns  bool   // whether any columns are referenced
+	agg      bool   // whether any aggregates are referenced
+	lets     int    // depth of the variables bound by let within it
+
+	// column describes the expression if it is a plain column reference.
+	column *sqlColumnRef
+}
+
+type sqlNode interface {
+	translate(p *sqlPlanner) (sqlText, error)
+}
+
+func (e *sqlExpr) translate(p *sqlPlanner) (sqlText, error) {
+	return foldSQL(p, e.Or, sqlOr)
+}
+
+func (e *sqlAnd) translate(p *sqlPlanner) (sqlText, error) {
+	return foldSQL(p, e.And, sqlAnd3)
+}
+
+// sqlOr and sqlAnd3 combine booleans with SQL's three valued logic, where
+// NULL represents an unknown value.
+func sqlOr(a, b sqlText) sqlText {
+	if !a.nullable && !b.nullable {
+		return merge("("+a.expr+" or "+b.expr+")", false, a, b)
+	}
+	return bind(a, b, "((%[1]s == true || %[2]s == true) ? true : ((%[1]s == nil || %[2]s == nil) ? nil : false))")
+}
+
+func sqlAnd3(a, b sqlText) sqlText {
+	if !a.nullable && !b.nullable {
+		return merge("("+a.expr+" and "+b.expr+")", false, a, b)
+	}
+	return bind(a, b, "((%[1]s == false || %[2]s == false) ? false : ((%[1]s == nil || %[2]s == nil) ? nil : true))")
+}
+
+// bind returns the nullable body, which refers to a and b as %[1]s and %[2]s,
+// with each bound by let so that its text appears only once. Variables are
+// named by their depth, so that nested lets never redeclare one, and the same
+// SQL always translates to the same text.
+func bind(a, b sqlText, body string) sqlText {
+	t := merge("", true, a, b)
+	t.lets++
+	va, vb := fmt.Sprintf("_sql%da", t.lets), fmt.Sprintf("_sql%db", t.lets)
+	t.expr = fmt.Sprintf("(let %s = %s; let %s = %s; %s)", va, a.expr, vb, b.expr, fmt.Sprintf(body, va, vb))
+	return t
+}
+
+func (e *sqlNot) translate(p *sqlPlanner) (sqlText, error) {
+	if e.Cmp != nil {
+		return p.translate(e.Cmp)
+	}
+	t, err := p.translate(e.Not)
+	if err != nil {
+		return t, err
+	}
+	return guard("not "+t.expr, t), nil
+}
+
+func (e *sqlCmp) translate(p *sqlPlanner) (sqlText, error) {
+	left, err := p.translate(e.Left)
+	if err != nil || e.Rest == nil {
+		return left, err
+	}
+	r := e.Rest
+	switch {
+	case r.Op != "":
+		right, err := p.translate(r.Right)
+		if err != nil {
+			return left, err
+		}
+		return binary(left, sqlOperator(r.Op), right), nil
+	case r.Is:
+		op := "=="
+		if r.IsNot {
+			op = "!="
+		}
+		return merge("("+left.expr+" "+op+" nil)", false, left), nil
+	case r.In != nil:
+		var items []string
+		list := left
+		for _, in := range r.In {
+			item, err := p.translate(in)
+			if err != nil {
+				return left, err
+			}
+			items = append(items, item.expr)
+			list = merge("", false, list, item)
+		}
+		t := guard(left.expr+" in ["+strings.Join(items, ", ")+"]", left)
+		t.tables, t.columns, t.agg, t.lets = list.tables, list.columns, list.agg, list.lets
+		return negate(t, r.Not), nil
+	case r.Between != nil:
+		lo, err := p.translate(r.Between)
+		if err != nil {
+			return left, err
+		}
+		hi, err := p.translate(r.And)
+		if err != nil {
+			return left, err
+		}
+		return negate(sqlAnd3(binary(left, ">=", lo), binary(left, "<=", hi)), r.Not), nil
+	case r.Like != nil:
+		pattern := r.Like.literal()
+		if pattern == nil {
+			return left, fmt.Errorf("LIKE requires a string pattern")
+		}
+		return negate(guard(left.expr+" matches "+strconv.Quote(likePattern(*pattern)), left), r.Not), nil
+	}
+	return left, nil
+}
+
+func negate(t sqlText, not bool) sqlText {
+	if !not {
+		return t
+	}
+	return guard("not "+t.expr, t)
+}
+
+// likePattern converts a SQL LIKE pattern to an anchored regular expression.
+func likePattern(like string) string {
+	var re strings.Builder
+	re.WriteString("^")
+	for _, r := range like {
+		switch r {
+		case '%':
+			re.WriteString(".*")
+		case '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	return re.String()
+}
+
+func (e *sqlSum) literal() *string {
+	if len(e.Ops) == 0 && len(e.Left.Ops) == 0 && e.Left.Left.Value != nil && e.Left.Left.Value.String != nil {
+		s := unquoteSQL(*e.Left.Left.Value.String)
+		return &s
+	}
+	return nil
+}
+
+func sqlOperator(op string) string {
+	switch op {
+	case "=":
+		return "=="
+	case "<>":
+		return "!="
+	case "||":
+		return "+"
+	}
+	return op
+}
+
+func (e *sqlSum) translate(p *sqlPlanner) (sqlText, error) {
+	t, err := p.translate(e.Left)
+	for _, op := range e.Ops {
+		if err != nil {
+			return t, err
+		}
+		var right sqlText
+		right, err = p.translate(op.Right)
+		t = binary(t, sqlOperator(op.Op), right)
+	}
+	return t, err
+}
+
+func (e *sqlProduct) translate(p *sqlPlanner) (sqlText, error) {
+	t, err := p.translate(e.Left)
+	for _, op := range e.Ops {
+		if err != nil {
+			return t, err
+		}
+		var right sqlText
+		right, err = p.translate(op.Right)
+		if op.Op == "/" {
+			t = divide(t, right)
+		} else {
+			t = binary(t, op.Op, right)
+		}
+	}
+	return t, err
+}
+
+// divide divides a by b, yielding nil, as for NULL, when b is zero.
+func divide(a, b sqlText) sqlText {
+	t := binary(a, "/", b)
+	return merge("("+b.expr+" == 0 ? nil : "+t.expr+")", true, t)
+}
+
+func (e *sqlUnary) translate(p *sqlPlanner) (sqlText, error) {
+	if e.Value != nil {
+		return p.translate(e.Value)
+	}
+	t, err := p.translate(e.Neg)
+	if err != nil {
+		return t, err
+	}
+	return guard("-"+t.expr, t), nil
+}
+
+func (e *sqlPrimary) translate(p *sqlPlanner) (sqlText, error) {
+	switch {
+	case e.Number != nil:
+		return sqlText{expr: *e.Number}, nil
+	case e.String != nil:
+		return sqlText{expr: strconv.Quote(unquoteSQL(*e.String))}, nil
+	case e.Bool != nil:
+		return sqlText{expr: strings.ToLower(*e.Bool)}, nil
+	case e.Null:
+		return sqlText{expr: "nil", nullable: true}, nil
+	case e.Typed != nil:
+		return sqlText{expr: strconv.Quote(unquoteSQL(e.Typed.Value))}, nil
+	case e.Call != nil:
+		return p.call(e.Call)
+	case e.Column != nil:
+		return p.column(e.Column)
+	}
+	t, err := p.translate(e.Paren)
+	t.column = nil
+	return t, err
+}
+
+// binary applies a binary operator, yielding nil if either operand is nil.
+func binary(a sqlText, op string, b sqlText) sqlText {
+	text := "(" + a.expr + " " + op + " " + b.expr + ")"
+	var checks []string
+	for _, t := range []sqlText{a, b} {
+		if t.nullable {
+			checks = append(checks, t.expr+" == nil")
+		}
+	}
+	if len(checks) == 0 {
+		return merge(text, false, a, b)
+	}
+	return merge("("+strings.Join(checks, " || ")+" ? nil : "+text+")", true, a, b)
+}
+
+// guard applies a unary operation or function to t, yielding nil if t is nil.
+func guard(text string, t sqlText) sqlText {
+	if !t.nullable {
+		return merge("("+text+")", false, t)
+	}
+	return merge("("+t.expr+" == nil ? nil : ("+text+"))", true, t)
+}
+
+func merge(text string, nullable bool, from ...sqlText) sqlText {
+	t := sqlText{expr: text, nullable: nullable}
+	for _, f := range from {
+		t.tables |= f.tables
+		t.columns = t.columns || f.columns
+		t.agg = t.agg || f.agg
+		t.lets = max(t.lets, f.lets)
+	}
+	return t
+}
+
+func foldSQL[T sqlNode](p *sqlPlanner, nodes []T, combine func(a, b sqlText) sqlText) (sqlText, error) {
+	t, err := p.translate(nodes[0])
+	for _, n := range nodes[1:] {
+		if err != nil {
+			return t, err
+		}
+		var next sqlText
+		next, err = p.translate(n)
+		t = combine(t, next)
+	}
+	return t, err
+}
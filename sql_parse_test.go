@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/expr-lang/expr"
+)
+
+var sqlNullTests = []struct {
+	Where string
+	Want  any
+}{
+	{"1 = 1", true},
+	{"NULL = 1", nil},
+	{"1 + NULL IS NULL", true},
+	{"NULL AND FALSE", false},
+	{"NULL AND TRUE", nil},
+	{"NULL OR TRUE", true},
+	{"NULL OR FALSE", nil},
+	{"NOT NULL", nil},
+	{"NOT (1 <> 1)", true},
+	{"2 BETWEEN 1 AND 3", true},
+	{"2 NOT IN (1, 3)", true},
+	{"'a.c' LIKE 'a_c%'", true},
+	{"'abc' LIKE 'a.c'", false},
+	{"coalesce(NULL, 'x') || 'y' = 'xy'", true},
+	{"(NULL OR FALSE) AND (NULL OR TRUE) OR (FALSE AND NULL) OR TRUE", true},
+	{"NULL OR (NULL OR (NULL OR FALSE))", nil},
+}
+
+func TestSQLLogicSize(t *testing.T) {
+	// each operand of a chain of nullable ORs is translated once
+	where := "NULL = 1"
+	for range 30 {
+		where += " OR NULL = 1"
+	}
+	stmt, err := parseSQL(Query(`SELECT * FROM "x" WHERE ` + where))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := (&sqlPlanner{}).translate(stmt.Where)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(text.expr) > 100*len(where) {
+		t.Fatalf("translated %d bytes to %d", len(where), len(text.expr))
+	}
+	if got, err := expr.Eval(text.expr, nil); err != nil || got != nil {
+		t.Errorf("got %v, %v", got, err)
+	}
+}
+
+func TestSQLNulls(t *testing.T) {
+	for _, tt := range sqlNullTests {
+		t.Run(tt.Where, func(t *testing.T) {
+			stmt, err := parseSQL(Query(`SELECT * FROM "x" WHERE ` + tt.Where))
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, err := (&sqlPlanner{}).translate(stmt.Where)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := expr.Eval(text.expr, nil)
+			if err != nil {
+				t.Fatal(text.expr, err)
+			}
+			if got != tt.Want {
+				t.Errorf("%s: got %v want %v", text.expr, got, tt.Want)
+			}
+		})
+	}
+}
@@ -4,11 +4,16 @@ package main
 
 import (
 	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math"
 	"os"
 	"slices"
 	"time"
 
 	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/encoding/thrift"
+	"github.com/parquet-go/parquet-go/format"
 )
 
 func main() {
@@ -130,12 +135,168 @@ func main() {
 		"Tus", parquet.Timestamp(parquet.Microsecond),
 		"Tns", parquet.Timestamp(parquet.Nanosecond),
 	)))
+
+	write("sorted.parquet", []struct {
+		N int32  `parquet:"n"`
+		S string `parquet:"s"`
+	}{
+		{1, "f"}, {2, "e"}, {3, "d"}, {4, "c"}, {5, "b"}, {6, "a"},
+	}, parquet.MaxRowsPerRowGroup(2), parquet.SortingWriterConfig(
+		parquet.SortingColumns(parquet.Ascending("n")),
+	))
+
+	user := func(s string) *string { return &s }
+	write("sales.parquet", []struct {
+		Region string  `parquet:"region"`
+		D      int32   `parquet:"d"`
+		Amount int64   `parquet:"amount"`
+		Price  float64 `parquet:"price"`
+		User   *string `parquet:"user"`
+	}{
+		{"EU", 19723, 1250, 1.5, user("ann")},
+		{"US", 19724, 999, 2.25, user("bob")},
+		{"EU", 19724, -50, 0.5, user("ann")},
+		{"EU", 20089, 10001, 4, nil},
+		{"US", 20090, 1, 3, user("cid")},
+	}, parquet.NewSchema("", StructOf(
+		"region", parquet.String(),
+		"d", parquet.Date(),
+		"amount", parquet.Decimal(2, 12, parquet.Int64Type),
+		"price", parquet.Leaf(parquet.DoubleType),
+		"user", parquet.Optional(parquet.String()),
+	)))
+	write("customers.parquet", []struct {
+		ID    int64  `parquet:"id"`
+		Name  string `parquet:"name"`
+		Since int32  `parquet:"since"`
+	}{
+		{1, "ada", 18262}, {2, "bob", 18779}, {3, "cyd", 19066}, {4, "dee", 19400},
+	}, parquet.NewSchema("", StructOf(
+		"id", parquet.Int(64),
+		"name", parquet.String(),
+		"since", parquet.Date(),
+	)))
+
+	id := func(n int32) *int32 { return &n }
+	write("orders.parquet", []struct {
+		Order  int32   `parquet:"order"`
+		ID     *int32  `parquet:"id,optional"`
+		Name   string  `parquet:"name"`
+		Amount float64 `parquet:"amount"`
+	}{
+		{100, id(1), "pen", 1.5},
+		{101, id(3), "ink", 2.25},
+		{102, id(1), "pad", 3},
+		{103, id(5), "cap", 4},
+		{104, nil, "box", 5},
+	})
+
+	write("scores_a.parquet", []struct {
+		ID    int32   `parquet:"id"`
+		Name  string  `parquet:"name"`
+		Score float32 `parquet:"score"`
+	}{
+		{1, "ann", 1.5}, {2, "bob", 2.5},
+	}, parquet.KeyValueMetadata("source", "a"), parquet.KeyValueMetadata("team", "red"))
+	name := func(s string) *string { return &s }
+	write("scores_b.parquet", []struct {
+		ID    int64   `parquet:"id"`
+		Name  *string `parquet:"name,optional"`
+		Tag   string  `parquet:"tag"`
+		Score float64 `parquet:"score"`
+	}{
+		{3, name("cid"), "x", 3.25}, {4, nil, "y", 4},
+	}, parquet.KeyValueMetadata("source", "b"))
+
+	type pageRow struct {
+		ID    int64   `parquet:"id"`
+		Color string  `parquet:"color,dict"`
+		Code  string  `parquet:"code,dict"`
+		Note  *string `parquet:"note,optional"`
+	}
+	pageRows := make([]pageRow, 300)
+	colors := []string{"red", "green", "blue"}
+	for i := range pageRows {
+		pageRows[i] = pageRow{ID: int64(i), Color: colors[i%3], Code: fmt.Sprintf("c%04d", i*7919%1000)}
+		if i%4 != 0 {
+			pageRows[i].Note = name(fmt.Sprint("note ", i%10))
+		}
+	}
+	write("pages.parquet", pageRows,
+		parquet.PageBufferSize(512), parquet.MaxRowsPerRowGroup(200), parquet.Compression(&parquet.Snappy))
+
+	// Each row group's values interleave, so lie within the others' bounds.
+	type bloomRow struct {
+		UserID *string `parquet:"user_id"`
+		N      int64   `parquet:"n"`
+		K      int32   `parquet:"k"`
+	}
+	var bloomRows []bloomRow
+	for rg := range 3 {
+		for i := range 3 {
+			k := rg + 1 + 3*i
+			bloomRows = append(bloomRows, bloomRow{UserID: name(fmt.Sprint("u", k)), N: int64(10 * k), K: int32(k)})
+		}
+	}
+	bloomRows[5].UserID = nil
+	write("bloom.parquet", bloomRows, parquet.MaxRowsPerRowGroup(3), parquet.BloomFilters(
+		parquet.SplitBlockFilter(10, "user_id"),
+		parquet.SplitBlockFilter(10, "n"),
+	))
+
+	// Floats that json cannot encode, and that compare equal despite their
+	// bits: each NaN, and -0 with 0.
+	nan := math.NaN()
+	write("floats.parquet", []struct {
+		G float64 `parquet:"g"`
+		N int64   `parquet:"n"`
+	}{
+		{nan, 1}, {math.Float64frombits(math.Float64bits(nan) | 1), 2},
+		{math.Inf(1), 3}, {math.Inf(-1), 4}, {math.Copysign(0, -1), 5}, {0, 6}, {1.5, 7}, {nan, 8},
+	})
+
+	// Damaged copies of pages.parquet, for verify.
+	pagesData, err := os.ReadFile("pages.parquet")
+	if err != nil {
+		panic(err)
+	}
+	save("truncated.parquet", pagesData[:len(pagesData)/2])
+
+	footerLength := int(binary.LittleEndian.Uint32(pagesData[len(pagesData)-8:]))
+	footerStart := len(pagesData) - 8 - footerLength
+	var md format.FileMetaData
+	if err := thrift.Unmarshal(new(thrift.CompactProtocol), pagesData[footerStart:len(pagesData)-8], &md); err != nil {
+		panic(err)
+	}
+
+	// the last byte of a column chunk is always page data
+	badcrc := slices.Clone(pagesData)
+	idChunk := md.RowGroups[0].Columns[0].MetaData
+	badcrc[idChunk.DataPageOffset+idChunk.TotalCompressedSize-1] ^= 0xff
+	save("badcrc.parquet", badcrc)
+
+	md.NumRows++
+	md.RowGroups[0].Columns[0].MetaData.Statistics.MaxValue = binary.LittleEndian.AppendUint64(nil, 150)
+	md.RowGroups[1].Columns[3].MetaData.Statistics.NullCount = 0
+	footer, err := thrift.Marshal(new(thrift.CompactProtocol), &md)
+	if err != nil {
+		panic(err)
+	}
+	badmeta := slices.Concat(pagesData[:footerStart], footer, binary.LittleEndian.AppendUint32(nil, uint32(len(footer))), []byte("PAR1"))
+	save("badmeta.parquet", badmeta)
 }
 
 func timeof[T int32 | int64](t time.Time, dur time.Duration) T {
 	return T(t.Sub(time.Unix(0, 0).UTC()) / dur)
 }
 
+func save(name string, data []byte) {
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		panic(err)
+	}
+	println("wrote", len(data), "bytes to", name)
+}
+
 func write[T any](name string, content []T, opts ...parquet.WriterOption) {
 	f, err := os.Create(name)
 	if err != nil {
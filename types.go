@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"cmp"
 	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
 	"time"
 )
 
@@ -31,6 +35,94 @@ const (
 	timeOnlyRFC3339Milli = "15:04:05.999Z07:00"
 )
 
+// Decimal is a fixed point number with Scale digits after the decimal point.
+type Decimal struct {
+	Unscaled *big.Int
+	Scale    int32
+}
+
+// decimalOf interprets v as the unscaled value of a decimal. Parquet stores
+// decimals as int32, int64, or big-endian two's complement bytes. A Decimal
+// is returned as it is, whatever its scale.
+func decimalOf(v reflect.Value, scale int32) (Decimal, error) {
+	d := Decimal{Unscaled: new(big.Int), Scale: scale}
+	var b []byte
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == reflect.TypeFor[Decimal]() {
+			return v.Interface().(Decimal), nil
+		}
+		return d, fmt.Errorf("unsupported decimal storage %s", v.Type())
+	case reflect.Int32, reflect.Int64:
+		d.Unscaled.SetInt64(v.Int())
+		return d, nil
+	case reflect.String:
+		b = []byte(v.String())
+	case reflect.Slice, reflect.Array:
+		b = make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+	default:
+		return d, fmt.Errorf("unsupported decimal storage %s", v.Type())
+	}
+	d.Unscaled.SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		d.Unscaled.Sub(d.Unscaled, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	return d, nil
+}
+
+func (d Decimal) String() string {
+	if d.Unscaled == nil {
+		return "0"
+	}
+	s := new(big.Int).Abs(d.Unscaled).String()
+	if d.Scale > 0 {
+		if pad := int(d.Scale) + 1 - len(s); pad > 0 {
+			s = strings.Repeat("0", pad) + s
+		}
+		s = s[:len(s)-int(d.Scale)] + "." + s[len(s)-int(d.Scale):]
+	}
+	if d.Unscaled.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+func (d Decimal) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+// Float64 returns the nearest float64 to d.
+func (d Decimal) Float64() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+// Rat returns d as a fraction.
+func (d Decimal) Rat() *big.Rat {
+	u := d.Unscaled
+	if u == nil {
+		u = new(big.Int)
+	}
+	return new(big.Rat).SetFrac(u, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d.Scale)), nil))
+}
+
+// Cmp compares d and e by value, whatever their scales.
+func (d Decimal) Cmp(e Decimal) int {
+	if d.Scale == e.Scale && d.Unscaled != nil && e.Unscaled != nil {
+		return d.Unscaled.Cmp(e.Unscaled)
+	}
+	return d.Rat().Cmp(e.Rat())
+}
+
+// rescale returns d with scale digits after the decimal point, which must not
+// be fewer than it has.
+func (d Decimal) rescale(scale int32) Decimal {
+	u := new(big.Int)
+	if d.Unscaled != nil {
+		u.Mul(d.Unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale-d.Scale)), nil))
+	}
+	return Decimal{Unscaled: u, Scale: scale}
+}
+
 func epochTime(offset time.Duration) time.Time {
 	return time.Unix(0, 0).Add(offset)
 }
@@ -82,6 +174,65 @@ func timeCompare[T inttime](a T, b any) (int, error) {
 	return 0, fmt.Errorf("unsupported comparison type for %T: %T", a, b)
 }
 
+// compareValue orders two values of the same type.
+// Logical dates, times and timestamps are stored as offsets from their epoch,
+// so they order chronologically by their underlying integers.
+// Nil sorts before any other value; structs, arrays and slices compare
+// element by element, and maps compare by length.
+func compareValue(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return cmp.Compare(boolInt(!a.IsNil()), boolInt(!b.IsNil()))
+		}
+		return compareValue(a.Elem(), b.Elem())
+	case reflect.Bool:
+		return cmp.Compare(boolInt(a.Bool()), boolInt(b.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp.Compare(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return cmp.Compare(a.Uint(), b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return cmp.Compare(a.Float(), b.Float())
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Slice:
+		if a.Type().Elem().Kind() == reflect.Uint8 {
+			return bytes.Compare(a.Bytes(), b.Bytes())
+		}
+		fallthrough
+	case reflect.Array:
+		for i := range min(a.Len(), b.Len()) {
+			if c := compareValue(a.Index(i), b.Index(i)); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.Len(), b.Len())
+	case reflect.Struct:
+		if a.Type() == reflect.TypeFor[Decimal]() {
+			return a.Interface().(Decimal).Cmp(b.Interface().(Decimal))
+		}
+		for i := range a.NumField() {
+			if c := compareValue(a.Field(i), b.Field(i)); c != 0 {
+				return c
+			}
+		}
+		return 0
+	case reflect.Map:
+		return cmp.Compare(a.Len(), b.Len())
+	}
+	return 0
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func marshalEpoch[T inttime](t T) ([]byte, error) {
 	return epochTime(time.Duration(t)*t.unit()).In(t.loc()).AppendFormat(nil, t.layout()), nil
 }
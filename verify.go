@@ -0,0 +1,304 @@
+package main
+
+import (
+	byteorder "encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// problem is something wrong with a parquet file, and where it was found.
+type problem struct {
+	rowGroup int    // -1 when not in a row group
+	column   string // empty when not in a column chunk
+	offset   int64  // -1 when unknown
+	msg      string
+}
+
+func (p problem) String() string {
+	var where []string
+	if p.rowGroup >= 0 {
+		where = append(where, fmt.Sprint("row group ", p.rowGroup))
+	}
+	if p.column != "" {
+		where = append(where, "column "+p.column)
+	}
+	if p.offset >= 0 {
+		where = append(where, fmt.Sprint("offset ", p.offset))
+	}
+	if len(where) == 0 {
+		return p.msg
+	}
+	return strings.Join(where, ", ") + ": " + p.msg
+}
+
+func printVerify(ctx run.Context, files []string, typer *schemata, in *inputs) error {
+	files, err := expandFiles(files)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, name := range files {
+		problems := verifyFile(name, typer, in)
+		if len(problems) == 0 {
+			fmt.Fprintln(ctx.Stdout, name+": ok")
+			continue
+		}
+		failed++
+		for _, p := range problems {
+			fmt.Fprintf(ctx.Stdout, "%s: %s\n", name, p)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, len(files))
+	}
+	return nil
+}
+
+// verifyFile checks the structure and content of a parquet file, returning
+// the problems it finds. Problems with the magic bytes or footer stop the
+// check; those in a column chunk skip the rest of that chunk.
+func verifyFile(name string, typer *schemata, in *inputs) []problem {
+	fail := func(offset int64, msg string, args ...any) []problem {
+		return []problem{{rowGroup: -1, offset: offset, msg: fmt.Sprintf(msg, args...)}}
+	}
+	r, size, closer, err := in.open(name)
+	if err != nil {
+		return fail(-1, "%v", err)
+	}
+	defer closer()
+
+	const magic = "PAR1"
+	if size < int64(2*len(magic)+4) {
+		return fail(-1, "too small for parquet: %d bytes", size)
+	}
+	head, tail := make([]byte, len(magic)), make([]byte, 4+len(magic))
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return fail(0, "%v", err)
+	}
+	if _, err := r.ReadAt(tail, size-int64(len(tail))); err != nil && err != io.EOF {
+		return fail(size-int64(len(tail)), "%v", err)
+	}
+	if string(head) != magic {
+		return fail(0, "missing magic header: found %q", head)
+	}
+	if string(tail[4:]) != magic {
+		return fail(size-int64(len(magic)), "missing magic footer: found %q, file may be truncated", tail[4:])
+	}
+	footerLength := int64(byteorder.LittleEndian.Uint32(tail))
+	footer := size - int64(len(tail)) - footerLength
+	if footer < int64(len(magic)) {
+		return fail(size-int64(len(tail)), "footer length %d exceeds file size %d", footerLength, size)
+	}
+
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return fail(footer, "decoding footer: %v", err)
+	}
+
+	var problems []problem
+	md := pf.Metadata()
+	var rows int64
+	for _, rg := range md.RowGroups {
+		rows += rg.NumRows
+	}
+	if rows != md.NumRows {
+		problems = append(problems, fail(footer, "row groups hold %d rows, footer says %d", rows, md.NumRows)...)
+	}
+
+	rowType := typer.LogicalTagged(pf.Schema())
+	for i, rg := range pf.RowGroups() {
+		for j, cc := range rg.ColumnChunks() {
+			cmd := md.RowGroups[i].Columns[j].MetaData
+			v := chunkVerifier{
+				r:        r,
+				rowGroup: i,
+				rows:     rg.NumRows(),
+				chunk:    cc,
+				md:       cmd,
+				path:     strings.Join(cmd.PathInSchema, "."),
+				rowType:  rowType,
+				dataEnd:  footer,
+			}
+			problems = append(problems, v.verify()...)
+		}
+	}
+	return problems
+}
+
+// chunkVerifier checks a column chunk's pages against its metadata.
+type chunkVerifier struct {
+	r        io.ReaderAt
+	rowGroup int
+	rows     int64
+	chunk    parquet.ColumnChunk
+	md       format.ColumnMetaData
+	path     string
+	rowType  reflect.Type
+	dataEnd  int64
+
+	problems []problem
+}
+
+func (v *chunkVerifier) report(offset int64, msg string, args ...any) {
+	v.problems = append(v.problems, problem{
+		rowGroup: v.rowGroup,
+		column:   v.path,
+		offset:   offset,
+		msg:      fmt.Sprintf(msg, args...),
+	})
+}
+
+func (v *chunkVerifier) verify() []problem {
+	start := v.md.DataPageOffset
+	if v.md.DictionaryPageOffset > 0 && v.md.DictionaryPageOffset < start {
+		start = v.md.DictionaryPageOffset
+	}
+	if start < 4 || start+v.md.TotalCompressedSize > v.dataEnd {
+		v.report(start, "column chunk of %d bytes lies outside the data", v.md.TotalCompressedSize)
+		return v.problems
+	}
+
+	headers, err := readPageHeaders(v.r, v.md)
+	if err != nil {
+		offset := start
+		if n := len(headers); n > 0 {
+			offset = headers[n-1].dataOffset + int64(headers[n-1].CompressedPageSize)
+		}
+		v.report(offset, "reading page %d header: %v", len(headers), err)
+		return v.problems
+	}
+	for page, h := range headers {
+		if h.CRC == 0 {
+			continue // no checksum was written
+		}
+		data := make([]byte, h.CompressedPageSize)
+		if _, err := v.r.ReadAt(data, h.dataOffset); err != nil {
+			v.report(h.dataOffset, "reading page %d: %v", page, err)
+		} else if sum := crc32.ChecksumIEEE(data); sum != uint32(h.CRC) {
+			v.report(h.offset, "page %d checksum mismatch: header has %08x, data has %08x", page, uint32(h.CRC), sum)
+		}
+	}
+	if len(v.problems) > 0 {
+		return v.problems
+	}
+
+	var dataPages []pageHeader
+	for _, h := range headers {
+		if h.Type != format.DictionaryPage {
+			dataPages = append(dataPages, h)
+		}
+	}
+	v.decode(start, dataPages)
+	return v.problems
+}
+
+// decode reads every value of the column chunk, checking the counts and
+// statistics of its metadata against them.
+func (v *chunkVerifier) decode(start int64, dataPages []pageHeader) {
+	typ := v.chunk.Type()
+	pages := v.chunk.Pages()
+	defer pages.Close()
+
+	var rows, values, nulls int64
+	var minValue, maxValue parquet.Value
+	var bounded bool
+	buf := make([]parquet.Value, 1024)
+	for page := 0; ; page++ {
+		offset := start
+		if page < len(dataPages) {
+			offset = dataPages[page].offset
+		}
+		p, err := pages.ReadPage()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			v.report(offset, "decoding data page %d: %v", page, err)
+			return
+		}
+		rows += p.NumRows()
+		vr := p.Values()
+		for {
+			n, err := vr.ReadValues(buf)
+			for _, value := range buf[:n] {
+				values++
+				switch {
+				case value.IsNull():
+					nulls++
+				case isNaN(value):
+					// NaN is excluded from statistics.
+				case !bounded:
+					minValue, maxValue, bounded = value.Clone(), value.Clone(), true
+				case typ.Compare(value, minValue) < 0:
+					minValue = value.Clone()
+				case typ.Compare(value, maxValue) > 0:
+					maxValue = value.Clone()
+				}
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				parquet.Release(p)
+				v.report(offset, "decoding data page %d: %v", page, err)
+				return
+			}
+		}
+		parquet.Release(p)
+	}
+
+	if rows != v.rows {
+		v.report(start, "column holds %d rows, row group says %d", rows, v.rows)
+	}
+	if values != v.md.NumValues {
+		v.report(start, "column holds %d values, metadata says %d", values, v.md.NumValues)
+	}
+
+	// Only the newer min_value and max_value have a defined sort order; the
+	// deprecated min and max may compare bytes signed, so are not checked.
+	st := v.md.Statistics
+	if st.MinValue == nil && st.MaxValue == nil && st.NullCount == 0 {
+		return
+	}
+	if st.NullCount != nulls {
+		v.report(start, "column holds %d nulls, statistics say %d", nulls, st.NullCount)
+	}
+	if !bounded {
+		return
+	}
+	kind := typ.Kind()
+	if b := st.MinValue; b != nil {
+		if size := physicalSize(kind); size > 0 && len(b) != size {
+			v.report(start, "statistics min has %d bytes, expected %d", len(b), size)
+		} else if stat := kind.Value(b); typ.Compare(stat, minValue) > 0 {
+			v.report(start, "statistics min %s is above the least value %s", v.text(stat), v.text(minValue))
+		}
+	}
+	if b := st.MaxValue; b != nil {
+		if size := physicalSize(kind); size > 0 && len(b) != size {
+			v.report(start, "statistics max has %d bytes, expected %d", len(b), size)
+		} else if stat := kind.Value(b); typ.Compare(stat, maxValue) < 0 {
+			v.report(start, "statistics max %s is below the greatest value %s", v.text(stat), v.text(maxValue))
+		}
+	}
+}
+
+func (v *chunkVerifier) text(value parquet.Value) string {
+	return logicalText(v.rowType, v.md.PathInSchema, value)
+}
+
+func isNaN(v parquet.Value) bool {
+	switch v.Kind() {
+	case parquet.Float:
+		return math.IsNaN(float64(v.Float()))
+	case parquet.Double:
+		return math.IsNaN(v.Double())
+	}
+	return false
+}
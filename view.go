@@ -0,0 +1,744 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/mutility/cli/run"
+	"github.com/parquet-go/parquet-go"
+	"golang.org/x/term"
+)
+
+// viewGroups is how many row groups the viewer keeps read at once.
+const viewGroups = 4
+
+const (
+	sgrReset   = "\x1b[m"
+	sgrBold    = "\x1b[1m"
+	sgrReverse = "\x1b[7m"
+)
+
+// viewKeys is shown by ? in the status line.
+const viewKeys = "j/k rows  h/l columns  </> move  x hide  a all  : jump  / filter  s schema  ⏎ detail  q quit"
+
+func viewFile(ctx run.Context, file string, typer *schemata, in *inputs) error {
+	return in.withFile(file, func(pf *parquet.File) error {
+		in, ok := ctx.Stdin.(*os.File)
+		out, ok2 := ctx.Stdout.(*os.File)
+		if !ok || !ok2 || !term.IsTerminal(int(in.Fd())) || !term.IsTerminal(int(out.Fd())) {
+			return fmt.Errorf("view needs a terminal")
+		}
+		v := newViewer(file, pf, typer)
+
+		state, err := term.MakeRaw(int(in.Fd()))
+		if err != nil {
+			return err
+		}
+		defer term.Restore(int(in.Fd()), state)
+		fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+		defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+		buf := make([]byte, 256)
+		for !v.quit {
+			width, height, err := term.GetSize(int(out.Fd()))
+			if err != nil {
+				return err
+			}
+			lines, err := v.render(width, height)
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(out, "\x1b[H"+strings.Join(lines, "\x1b[K\r\n")+"\x1b[K"); err != nil {
+				return err
+			}
+			n, err := in.Read(buf)
+			if err != nil {
+				return err
+			}
+			for _, key := range parseKeys(buf[:n]) {
+				if err := v.handle(key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// viewer is the state of parquetry view: a window onto the rows of a file,
+// which are read a row group at a time as they come into view. With a filter,
+// the rows shown are those found to match so far, and row groups are scanned
+// for more only as they are needed.
+type viewer struct {
+	name    string
+	file    *parquet.File
+	rowType reflect.Type
+	logical reflect.Type
+	names   []string
+	starts  []int64 // the first row of each row group, then the rows in all
+
+	groups map[int]reflect.Value // row groups read
+	recent []int                 // row groups read, least recently used first
+
+	filter  Filter
+	prev    Filter // the filter before, restored if filter fails on a row
+	failed  Filter // the filter that last failed on a row, and why
+	failure string
+	match   *vm.Program
+	machine vm.VM
+	matched []int64 // rows found to match so far
+	scanned int     // row groups scanned for matches
+
+	columns   []int // fields shown, in order
+	col, left int   // selected and first shown of columns
+	row, top  int64 // selected and first shown of the rows shown
+	page      int64 // rows that fit on the screen
+
+	schemaPanel, detailPane bool
+
+	prompt, input string // prompt is ":" or "/" while input is typed
+	saved         Filter // the filter before /, restored by esc
+	status        string
+	quit          bool
+}
+
+func newViewer(name string, pf *parquet.File, typer *schemata) *viewer {
+	v := &viewer{
+		name:    name,
+		file:    pf,
+		rowType: typer.LogicalTagged(pf.Schema()),
+		logical: typer.Logical(pf.Schema()),
+		groups:  map[int]reflect.Value{},
+	}
+	v.names = columnNames(v.rowType)
+	v.columns = make([]int, len(v.names))
+	for i := range v.columns {
+		v.columns[i] = i
+	}
+	v.starts = []int64{0}
+	for _, rg := range pf.RowGroups() {
+		v.starts = append(v.starts, v.starts[len(v.starts)-1]+rg.NumRows())
+	}
+	return v
+}
+
+// group returns the rows of row group g, reading it if it is not kept.
+func (v *viewer) group(g int) (reflect.Value, error) {
+	if rows, ok := v.groups[g]; ok {
+		v.recent = append(slices.DeleteFunc(v.recent, func(r int) bool { return r == g }), g)
+		return rows, nil
+	}
+	rg := v.file.RowGroups()[g]
+	rows := reflect.MakeSlice(reflect.SliceOf(v.rowType), 0, int(rg.NumRows()))
+	err := readBatches(rg, 0, rg.NumRows(), v.rowType, func(batch reflect.Value) error {
+		rows = reflect.AppendSlice(rows, batch)
+		return nil
+	})
+	if err != nil {
+		return rows, err
+	}
+	if len(v.recent) == viewGroups {
+		delete(v.groups, v.recent[0])
+		v.recent = v.recent[1:]
+	}
+	v.groups[g] = rows
+	v.recent = append(v.recent, g)
+	return rows, nil
+}
+
+// setFilter shows only rows matching filter, or all rows if it is empty.
+func (v *viewer) setFilter(filter Filter) error {
+	var match *vm.Program
+	if filter != "" {
+		var err error
+		if match, err = expr.Compile(string(filter), filterOptions(v.rowType)...); err != nil {
+			return err
+		}
+	}
+	if filter != v.filter {
+		v.prev = v.filter
+	}
+	v.filter, v.match = filter, match
+	v.matched, v.scanned = nil, 0
+	v.row, v.top = 0, 0
+	return nil
+}
+
+// scan finds the rows of the next row group that match the filter. A filter
+// that fails on a row is replaced by the one before, as one that does not
+// compile is never applied.
+func (v *viewer) scan() error {
+	rows, err := v.group(v.scanned)
+	if err != nil {
+		return err
+	}
+	for i := range rows.Len() {
+		include, err := v.machine.Run(v.match, rows.Index(i).Addr().Interface())
+		if err != nil {
+			msg, _, _ := strings.Cut(err.Error(), "\n")
+			v.failed = v.filter
+			v.failure = fmt.Sprintf("filter fails on row %d: %s; showing %q", v.starts[v.scanned]+int64(i), msg, v.prev)
+			v.status = v.failure
+			// The filter before has compiled already, and if it fails too
+			// no filter is left to fall back on.
+			v.setFilter(v.prev)
+			v.prev = ""
+			return nil
+		}
+		if include.(bool) {
+			v.matched = append(v.matched, v.starts[v.scanned]+int64(i))
+		}
+	}
+	v.scanned++
+	return nil
+}
+
+// scannedAll reports whether every row group has been scanned for the filter.
+func (v *viewer) scannedAll() bool {
+	return v.scanned == len(v.starts)-1
+}
+
+// shown returns how many rows are shown, and whether that is all of them.
+func (v *viewer) shown() (int64, bool) {
+	if v.match == nil {
+		return v.starts[len(v.starts)-1], true
+	}
+	return int64(len(v.matched)), v.scannedAll()
+}
+
+// fileRow returns the row of the file shown at i, scanning for it if needed.
+func (v *viewer) fileRow(i int64) (int64, bool, error) {
+	if v.match == nil {
+		return i, i < v.starts[len(v.starts)-1], nil
+	}
+	for int64(len(v.matched)) <= i && !v.scannedAll() {
+		if err := v.scan(); err != nil {
+			return 0, false, err
+		}
+	}
+	if i < int64(len(v.matched)) {
+		return v.matched[i], true, nil
+	}
+	return 0, false, nil
+}
+
+// at returns the row shown at i, and its row of the file.
+func (v *viewer) at(i int64) (reflect.Value, int64, bool, error) {
+	r, ok, err := v.fileRow(i)
+	if !ok || err != nil {
+		return reflect.Value{}, 0, false, err
+	}
+	g := sort.Search(len(v.starts)-1, func(g int) bool { return v.starts[g+1] > r })
+	rows, err := v.group(g)
+	if err != nil {
+		return reflect.Value{}, 0, false, err
+	}
+	return rows.Index(int(r - v.starts[g])), r, true, nil
+}
+
+// move selects the row n after the selected one, or the last row shown.
+func (v *viewer) move(n int64) error {
+	target := max(v.row+n, 0)
+	_, ok, err := v.fileRow(target)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		total, _ := v.shown()
+		target = max(total-1, 0)
+	}
+	v.row = target
+	return nil
+}
+
+// jump selects row s of the file, or the first row shown after it.
+func (v *viewer) jump(s string) error {
+	r, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		v.status = fmt.Sprintf("row %q: not a number", s)
+		return nil
+	}
+	if r < 0 {
+		r += v.starts[len(v.starts)-1]
+	}
+	if v.match == nil {
+		return v.move(r - v.row)
+	}
+	for (len(v.matched) == 0 || v.matched[len(v.matched)-1] < r) && !v.scannedAll() {
+		if err := v.scan(); err != nil {
+			return err
+		}
+	}
+	i, _ := slices.BinarySearch(v.matched, r)
+	if i == len(v.matched) {
+		v.status = fmt.Sprintf("no row matches at or after %d", r)
+		return nil
+	}
+	v.row = int64(i)
+	return nil
+}
+
+// handle updates the viewer for a key pressed.
+func (v *viewer) handle(key string) error {
+	if v.prompt != "" {
+		return v.edit(key)
+	}
+	v.status = ""
+	page := max(v.page, 1)
+	switch key {
+	case "q", "ctrl+c":
+		v.quit = true
+	case "j", "down":
+		return v.move(1)
+	case "k", "up":
+		return v.move(-1)
+	case " ", "pgdown":
+		return v.move(page)
+	case "b", "pgup":
+		return v.move(-page)
+	case "g", "home":
+		v.row = 0
+	case "G", "end":
+		for v.match != nil && !v.scannedAll() {
+			if err := v.scan(); err != nil {
+				return err
+			}
+		}
+		return v.move(v.starts[len(v.starts)-1])
+	case "h", "left":
+		v.col = max(v.col-1, 0)
+	case "l", "right":
+		v.col = min(v.col+1, len(v.columns)-1)
+	case "<":
+		if v.col > 0 {
+			v.columns[v.col-1], v.columns[v.col] = v.columns[v.col], v.columns[v.col-1]
+			v.col--
+		}
+	case ">":
+		if v.col < len(v.columns)-1 {
+			v.columns[v.col+1], v.columns[v.col] = v.columns[v.col], v.columns[v.col+1]
+			v.col++
+		}
+	case "x":
+		if len(v.columns) == 1 {
+			v.status = "cannot hide the last column"
+			break
+		}
+		v.columns = slices.Delete(v.columns, v.col, v.col+1)
+		v.col = min(v.col, len(v.columns)-1)
+	case "a":
+		v.columns = v.columns[:0]
+		for i := range v.names {
+			v.columns = append(v.columns, i)
+		}
+	case "s":
+		v.schemaPanel = !v.schemaPanel
+	case "enter":
+		v.detailPane = !v.detailPane
+	case ":":
+		v.prompt, v.input = ":", ""
+	case "/":
+		v.prompt, v.input, v.saved = "/", string(v.filter), v.filter
+	case "?":
+		v.status = viewKeys
+	}
+	return nil
+}
+
+// edit updates the input of a prompt for a key pressed. A filter is applied
+// as it is typed, whenever it compiles.
+func (v *viewer) edit(key string) error {
+	v.status = ""
+	switch key {
+	case "esc", "ctrl+c":
+		if v.prompt == "/" && v.filter != v.saved {
+			v.setFilter(v.saved)
+		}
+		v.prompt = ""
+		return nil
+	case "enter":
+		prompt := v.prompt
+		v.prompt = ""
+		if prompt == ":" {
+			return v.jump(v.input)
+		}
+		switch Filter(v.input) {
+		case v.filter:
+		case v.failed:
+			v.status = v.failure
+		default:
+			v.status = "filter does not compile; showing " + strconv.Quote(string(v.filter))
+		}
+		return nil
+	case "backspace":
+		if v.input == "" {
+			return nil
+		}
+		_, n := utf8.DecodeLastRuneInString(v.input)
+		v.input = v.input[:len(v.input)-n]
+	default:
+		if utf8.RuneCountInString(key) != 1 {
+			return nil
+		}
+		v.input += key
+	}
+	if v.prompt == "/" {
+		if err := v.setFilter(Filter(v.input)); err != nil {
+			v.status, _, _ = strings.Cut(err.Error(), "\n")
+		}
+	}
+	return nil
+}
+
+// render returns the lines of a screen of width and height.
+func (v *viewer) render(width, height int) ([]string, error) {
+	if width < 1 || height < 1 {
+		return nil, nil
+	}
+	gridWidth, panelWidth := width, 0
+	if v.schemaPanel && width >= 40 {
+		panelWidth = min(max(width/3, 20), 50)
+		gridWidth = width - panelWidth - 1
+	}
+	gridHeight, detailHeight := height-1, 0
+	if v.detailPane && height >= 8 {
+		detailHeight = (height - 1) / 2
+		gridHeight -= detailHeight
+	}
+
+	lines, err := v.grid(gridWidth, gridHeight)
+	if err != nil {
+		return nil, err
+	}
+	if detailHeight > 0 {
+		detail, err := v.detail(gridWidth, detailHeight)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, detail...)
+	}
+	if panelWidth > 0 {
+		panel := v.schema(panelWidth, height-1)
+		for i := range lines {
+			lines[i] += "│" + panel[i]
+		}
+	}
+	return append(lines, v.statusLine(width)), nil
+}
+
+// grid returns the lines of the header and the rows shown, scrolled to keep
+// the selected row and column in view.
+func (v *viewer) grid(width, height int) ([]string, error) {
+	v.page = int64(max(height-1, 1))
+	if v.row < v.top {
+		v.top = v.row
+	} else if v.row >= v.top+v.page {
+		v.top = v.row - v.page + 1
+	}
+
+	var rows [][]string
+	var fileRows []int64
+	for i := v.top; i < v.top+v.page; i++ {
+		row, r, ok, err := v.at(i)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		cells := make([]string, len(v.columns))
+		for k, c := range v.columns {
+			if cells[k], err = asciiTable.cell(row.Field(c)); err != nil {
+				return nil, err
+			}
+		}
+		rows = append(rows, cells)
+		fileRows = append(fileRows, r)
+	}
+
+	gutter := 1
+	if len(fileRows) > 0 {
+		gutter = len(strconv.FormatInt(fileRows[len(fileRows)-1], 10))
+	}
+	widths := make([]int, len(v.columns))
+	right := make([]bool, len(v.columns))
+	for k, c := range v.columns {
+		widths[k] = utf8.RuneCountInString(v.names[c])
+		for _, cells := range rows {
+			widths[k] = max(widths[k], utf8.RuneCountInString(cells[k]))
+		}
+		widths[k] = min(widths[k], maxCellWidth)
+		right[k] = alignRight(v.rowType.Field(c).Type)
+	}
+
+	// Scroll right until the selected column fits, then show as many
+	// columns from the first shown as fit, truncating the last.
+	sep := boxTable.row[1]
+	avail := width - gutter - utf8.RuneCountInString(sep)
+	span := func(from, to int) int {
+		n := 0
+		for _, w := range widths[from : to+1] {
+			n += w
+		}
+		return n + (to-from)*utf8.RuneCountInString(sep)
+	}
+	v.left = min(v.left, v.col)
+	for v.left < v.col && span(v.left, v.col) > avail {
+		v.left++
+	}
+	shown := 0
+	for k := v.left; k < len(widths); k++ {
+		if rest := avail - span(v.left, k) + widths[k]; rest < widths[k] {
+			if rest >= minCellWidth {
+				widths[k] = rest
+				shown++
+			}
+			break
+		}
+		shown++
+	}
+	cols := v.left + shown
+
+	line := func(gut string, cells []string) (string, []int) {
+		parts := []string{fitCell(gut, gutter, true, true)}
+		offsets := []int{}
+		at := gutter
+		for k := v.left; k < cols; k++ {
+			at += utf8.RuneCountInString(sep)
+			offsets = append(offsets, at)
+			parts = append(parts, fitCell(cells[k], widths[k], right[k], true))
+			at += widths[k]
+		}
+		return fitCell(strings.Join(parts, sep), width, false, true), offsets
+	}
+
+	names := make([]string, len(v.columns))
+	for k, c := range v.columns {
+		names[k] = v.names[c]
+	}
+	header, offsets := line("#", names)
+	if v.col < cols && len(offsets) > 0 {
+		start := offsets[v.col-v.left]
+		header = styleRunes(header, start, start+widths[v.col], sgrReverse)
+	}
+	lines := []string{sgrBold + header + sgrReset}
+	for i, cells := range rows {
+		l, _ := line(strconv.FormatInt(fileRows[i], 10), cells)
+		if v.top+int64(i) == v.row {
+			l = sgrReverse + l + sgrReset
+		}
+		lines = append(lines, l)
+	}
+	if len(rows) == 0 {
+		empty := "no rows"
+		if v.match != nil {
+			empty = "no rows match"
+		}
+		lines = append(lines, fitCell(empty, width, false, true))
+	}
+	for len(lines) < height {
+		lines = append(lines, strings.Repeat(" ", width))
+	}
+	return lines[:height], nil
+}
+
+// styleRunes applies sgr to the runes [from, to) of s, a line drawn bold.
+func styleRunes(s string, from, to int, sgr string) string {
+	r := []rune(s)
+	to = min(to, len(r))
+	if from >= to {
+		return s
+	}
+	return string(r[:from]) + sgr + string(r[from:to]) + sgrReset + sgrBold + string(r[to:])
+}
+
+// detail returns the lines of a pane showing each field of the selected row,
+// with nested maps, lists, and structs as indented JSON.
+func (v *viewer) detail(width, height int) ([]string, error) {
+	lines := []string{strings.Repeat("─", width)}
+	row, r, ok, err := v.at(v.row)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		lines = append(lines, sgrBold+fitCell("row "+strconv.FormatInt(r, 10), width, false, true)+sgrReset)
+		for _, c := range v.columns {
+			text, err := detailText(row.Field(c))
+			if err != nil {
+				return nil, err
+			}
+			for i, t := range strings.Split(text, "\n") {
+				if i == 0 {
+					t = v.names[c] + ": " + t
+				} else {
+					t = "  " + t
+				}
+				lines = append(lines, fitCell(tableEscape.Replace(t), width, false, true))
+			}
+		}
+	}
+	for len(lines) < height {
+		lines = append(lines, strings.Repeat(" ", width))
+	}
+	return lines[:height], nil
+}
+
+// detailText returns v as text, spread over lines if it is nested.
+func detailText(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return asciiTable.null, nil
+		}
+		v = v.Elem()
+	}
+	if _, ok := v.Interface().(encoding.TextMarshaler); !ok {
+		switch v.Kind() {
+		case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+			var b bytes.Buffer
+			e := json.NewEncoder(&b)
+			e.SetEscapeHTML(false)
+			e.SetIndent("", "  ")
+			err := e.Encode(v.Interface())
+			return strings.TrimSuffix(b.String(), "\n"), err
+		}
+	}
+	return cellText(v)
+}
+
+// schema returns the lines of a panel showing the logical schema.
+func (v *viewer) schema(width, height int) []string {
+	lines := []string{sgrBold + fitCell("schema", width, false, true) + sgrReset}
+	for _, l := range schemaLines(v.logical, v.names, "") {
+		lines = append(lines, fitCell(l, width, false, true))
+	}
+	for len(lines) < height {
+		lines = append(lines, strings.Repeat(" ", width))
+	}
+	return lines[:height]
+}
+
+// schemaLines returns a line for each field of t, named by names if given,
+// with the fields of nested structs indented below them.
+func schemaLines(t reflect.Type, names []string, indent string) []string {
+	var lines []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name := f.Name
+		if names != nil {
+			name = names[i]
+		}
+		ft, prefix := f.Type, ""
+	elems:
+		for {
+			switch ft.Kind() {
+			case reflect.Pointer:
+				prefix += "*"
+			case reflect.Slice:
+				prefix += "[]"
+			case reflect.Map:
+				prefix += "map[" + typeName(ft.Key()) + "]"
+			default:
+				break elems
+			}
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && !ft.Implements(reflect.TypeFor[encoding.TextMarshaler]()) {
+			lines = append(lines, indent+name+" "+prefix+"struct")
+			lines = append(lines, schemaLines(ft, nil, indent+"  ")...)
+			continue
+		}
+		lines = append(lines, indent+name+" "+prefix+typeName(ft))
+	}
+	return lines
+}
+
+func typeName(t reflect.Type) string {
+	return strings.TrimPrefix(t.String(), "main.")
+}
+
+// statusLine returns the prompt being typed, or the position, filter, and
+// any message.
+func (v *viewer) statusLine(width int) string {
+	if v.prompt != "" {
+		text := v.prompt + v.input + "█"
+		if v.status != "" {
+			text += "  " + v.status
+		}
+		return sgrReverse + fitCell(text, width, false, true) + sgrReset
+	}
+	total, all := v.shown()
+	of := strconv.FormatInt(total, 10)
+	if !all {
+		of += "+"
+	}
+	text := fmt.Sprintf("%s  %d of %s", v.name, min(v.row+1, total), of)
+	if v.filter != "" {
+		text += "  where " + string(v.filter)
+	}
+	if v.status != "" {
+		text += "  " + v.status
+	} else {
+		text += "  ? keys"
+	}
+	return sgrReverse + fitCell(text, width, false, true) + sgrReset
+}
+
+// escapeKeys names the keys sent as escape sequences.
+var escapeKeys = map[string]string{
+	"[A": "up", "[B": "down", "[C": "right", "[D": "left",
+	"[5~": "pgup", "[6~": "pgdown",
+	"[H": "home", "[F": "end", "[1~": "home", "[4~": "end", "OH": "home", "OF": "end",
+}
+
+// parseKeys returns the names of the keys read from a terminal: a character,
+// or the name of a key such as up, enter, or esc.
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		key, n := parseKey(b)
+		if key != "" {
+			keys = append(keys, key)
+		}
+		b = b[n:]
+	}
+	return keys
+}
+
+func parseKey(b []byte) (string, int) {
+	switch b[0] {
+	case 0x1b:
+		if len(b) == 1 || b[1] != '[' && b[1] != 'O' {
+			return "esc", 1
+		}
+		// A control sequence ends with a byte from @ to ~.
+		end := 2
+		for end < len(b) && (b[end] < 0x40 || b[end] > 0x7e) {
+			end++
+		}
+		end = min(end+1, len(b))
+		return escapeKeys[string(b[1:end])], end
+	case '\r', '\n':
+		return "enter", 1
+	case 0x7f, 0x08:
+		return "backspace", 1
+	case 0x03:
+		return "ctrl+c", 1
+	}
+	r, n := utf8.DecodeRune(b)
+	if r < ' ' {
+		return "", n
+	}
+	return string(r), n
+}
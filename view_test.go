@@ -0,0 +1,158 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var sgr = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// screen renders v as plain text, with trailing spaces trimmed.
+func screen(t *testing.T, v *viewer, width, height int) []string {
+	t.Helper()
+	lines, err := v.render(width, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(sgr.ReplaceAllString(l, ""), " ")
+	}
+	return lines
+}
+
+func press(t *testing.T, v *viewer, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := v.handle(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestViewer(t *testing.T) {
+	pf, _ := openBench(t, "pages.parquet")
+	v := newViewer("pages.parquet", pf, new(schemata))
+	got := screen(t, v, 40, 5)
+	want := []string{
+		"# │ id │ color │ code  │ note",
+		"0 │  0 │ red   │ c0000 │ ∅",
+		"1 │  1 │ green │ c0919 │ note 1",
+		"2 │  2 │ blue  │ c0838 │ note 2",
+		"pages.parquet  1 of 300  ? keys",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// scrolling past a row group reads the next
+	press(t, v, ":", "2", "0", "1", "enter")
+	got = screen(t, v, 40, 5)
+	if got[3] != "201 │ 201 │ red   │ c0719 │ note 1" || got[4] != "pages.parquet  202 of 300  ? keys" {
+		t.Errorf("after jump got\n%s", strings.Join(got, "\n"))
+	}
+	press(t, v, "G")
+	if got = screen(t, v, 40, 5); got[3] != "299 │ 299 │ blue  │ c0781 │ note 9" {
+		t.Errorf("at end got\n%s", strings.Join(got, "\n"))
+	}
+
+	// columns hide and move
+	press(t, v, "g", "x", ">", "a", "l", "l", "<")
+	if got = screen(t, v, 40, 5); got[0] != "# │ id │ color │ note   │ code" {
+		t.Errorf("moved columns got %q", got[0])
+	}
+	press(t, v, "l", "x", "h", "x")
+	if got = screen(t, v, 40, 5); got[0] != "# │ id │ note" {
+		t.Errorf("hid columns got %q", got[0])
+	}
+	press(t, v, "a")
+	if got = screen(t, v, 40, 5); got[0] != "# │ id │ color │ code  │ note" {
+		t.Errorf("all columns got %q", got[0])
+	}
+}
+
+func TestViewerFilter(t *testing.T) {
+	pf, _ := openBench(t, "pages.parquet")
+	v := newViewer("pages.parquet", pf, new(schemata))
+	press(t, v, "/")
+	for _, key := range strings.Split(`id > 250 && color == "blue"`, "") {
+		press(t, v, key)
+	}
+	got := screen(t, v, 60, 4)
+	want := []string{
+		"  # │  id │ color │ code  │ note",
+		"251 │ 251 │ blue  │ c0669 │ note 1",
+		"254 │ 254 │ blue  │ c0426 │ note 4",
+		`/id > 250 && color == "blue"█`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	press(t, v, "enter", "G")
+	if got = screen(t, v, 80, 4); got[3] != `pages.parquet  17 of 17  where id > 250 && color == "blue"  ? keys` {
+		t.Errorf("got status %q", got[3])
+	}
+
+	// a filter that does not compile keeps the last that did, and esc
+	// restores the filter from before
+	press(t, v, "/", "backspace", "backspace")
+	if got = screen(t, v, 60, 4); !strings.HasPrefix(got[3], `/id > 250 && color == "blu█  `) {
+		t.Errorf("got status %q", got[3])
+	}
+	press(t, v, "esc", ":", "2", "6", "1", "enter")
+	if got = screen(t, v, 80, 4); got[3] != `pages.parquet  5 of 17  where id > 250 && color == "blue"  ? keys` {
+		t.Errorf("got status %q", got[3])
+	}
+}
+
+// a filter that fails on a row keeps the filter from before
+func TestViewerFilterFails(t *testing.T) {
+	pf, _ := openBench(t, "pages.parquet")
+	v := newViewer("pages.parquet", pf, new(schemata))
+	press(t, v, "/", "i", "d", " ", "<", " ", "9", "enter", "/")
+	for _, key := range strings.Split(` && id % (id - 5) == 0`, "") {
+		press(t, v, key)
+	}
+	got := screen(t, v, 120, 4)
+	want := `/id < 9 && id % (id - 5) == 0█  filter fails on row 5: runtime error: integer divide by zero (1:14); showing "id < 9 "`
+	if got[3] != want {
+		t.Errorf("got status %q\nwant %q", got[3], want)
+	}
+	press(t, v, "enter")
+	got = screen(t, v, 160, 4)
+	want = `pages.parquet  1 of 9+  where id < 9   filter fails on row 5: runtime error: integer divide by zero (1:14); showing "id < 9 "`
+	if got[1] != "0 │  0 │ red   │ c0000 │ ∅" || got[3] != want {
+		t.Errorf("got\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestViewerPanes(t *testing.T) {
+	pf, _ := openBench(t, "example.parquet")
+	v := newViewer("example.parquet", pf, new(schemata))
+	press(t, v, "s", "enter")
+	got := strings.Join(screen(t, v, 90, 30), "\n")
+	for _, want := range []string{
+		"│schema",
+		"│m map[string]string",
+		"│w struct",
+		"│  D Date",
+		"row 0",
+		"ps: ∅",
+		`m: {`,
+		`  "hello": "world"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("j\x1b[A\x1b[6~\x1b\r\x7fé\x1b[2~\x03"))
+	want := []string{"j", "up", "pgdown", "esc", "enter", "backspace", "é", "ctrl+c"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
@@ -27,15 +28,7 @@ func (w *csvWriter) Write(v reflect.Value) error {
 		if t.Kind() != reflect.Struct {
 			return fmt.Errorf("csv: unsupported output %s", t)
 		}
-		hdr := make([]string, t.NumField())
-		for i := range hdr {
-			f := t.Field(i)
-			hdr[i] = f.Name
-			if n, _, _ := strings.Cut(f.Tag.Get("parquet"), ","); n != "" {
-				hdr[i] = n
-			}
-		}
-		if w.err = w.c.Write(hdr); w.err != nil {
+		if w.err = w.c.Write(columnNames(t)); w.err != nil {
 			return w.err
 		}
 		w.vals = make([]string, t.NumField())
@@ -43,18 +36,8 @@ func (w *csvWriter) Write(v reflect.Value) error {
 
 	if w.vals != nil {
 		for i := range w.vals {
-			switch v := v.Field(i); v.Kind() {
-			case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8,
-				reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8,
-				reflect.Float64, reflect.Float32, reflect.String:
-				w.vals[i] = fmt.Sprint(v.Interface())
-			default:
-				var b []byte
-				b, w.err = json.Marshal(v.Interface())
-				if w.err != nil {
-					return w.err
-				}
-				w.vals[i] = string(b)
+			if w.vals[i], w.err = cellText(v.Field(i)); w.err != nil {
+				return w.err
 			}
 		}
 		w.err = w.c.Write(w.vals)
@@ -62,7 +45,49 @@ func (w *csvWriter) Write(v reflect.Value) error {
 	return w.err
 }
 
+func (w *csvWriter) WriteBatch(rows reflect.Value) error {
+	for i := range rows.Len() {
+		if err := w.Write(rows.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (w *csvWriter) Close() error {
+	if w.c == nil {
+		return w.err
+	}
 	w.c.Flush()
 	return errors.Join(w.err, w.c.Error())
 }
+
+// columnNames returns the parquet names of the fields of t.
+func columnNames(t reflect.Type) []string {
+	names := make([]string, t.NumField())
+	for i := range names {
+		f := t.Field(i)
+		names[i] = f.Name
+		if n, _, _ := strings.Cut(f.Tag.Get("parquet"), ","); n != "" {
+			names[i] = n
+		}
+	}
+	return names
+}
+
+// cellText returns v as text: numbers and strings as they are, values that
+// marshal as text so, and anything else as JSON.
+func cellText(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8,
+		reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8,
+		reflect.Float64, reflect.Float32, reflect.String:
+		return fmt.Sprint(v.Interface()), nil
+	}
+	if tm, ok := v.Interface().(encoding.TextMarshaler); ok && (v.Kind() != reflect.Pointer || !v.IsNil()) {
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+	b, err := json.Marshal(v.Interface())
+	return string(b), err
+}
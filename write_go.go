@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"reflect"
+)
+
+// goWriter writes each row in go syntax.
+type goWriter struct {
+	w *bufio.Writer
+}
+
+func (w *goWriter) Write(v reflect.Value) error {
+	if _, err := fmt.Fprintf(w.w, "%+v\n", v); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+func (w *goWriter) WriteBatch(rows reflect.Value) error {
+	for i := range rows.Len() {
+		if _, err := fmt.Fprintf(w.w, "%+v\n", rows.Index(i)); err != nil {
+			return err
+		}
+	}
+	return w.w.Flush()
+}
+
+func (w *goWriter) Close() error { return w.w.Flush() }
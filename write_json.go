@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"io"
@@ -9,6 +10,7 @@ import (
 
 type jsonWriter struct {
 	w      io.Writer
+	bw     *bufio.Writer
 	b      bytes.Buffer
 	e      *json.Encoder
 	err    error
@@ -16,27 +18,47 @@ type jsonWriter struct {
 }
 
 func (w *jsonWriter) Write(v reflect.Value) error {
+	if w.write(v) == nil {
+		w.err = w.bw.Flush()
+	}
+	return w.err
+}
+
+func (w *jsonWriter) WriteBatch(rows reflect.Value) error {
+	for i := range rows.Len() {
+		if w.write(rows.Index(i)) != nil {
+			return w.err
+		}
+	}
+	if w.bw != nil {
+		w.err = w.bw.Flush()
+	}
+	return w.err
+}
+
+func (w *jsonWriter) write(v reflect.Value) error {
 	if w.err != nil {
 		return w.err
 	}
 
 	if w.e == nil {
+		w.bw = bufio.NewWriter(w.w)
 		w.e = json.NewEncoder(&w.b)
 		w.e.SetEscapeHTML(false)
 		w.prefix = []byte("[\n  ")
 	}
 
-	if w.err = w.e.Encode(v.Interface()); w.err != nil {
+	if w.err = w.e.Encode(addrOf(v)); w.err != nil {
 		return w.err
 	}
 
 	j := bytes.TrimSuffix(w.b.Bytes(), []byte{'\n'})
 	defer w.b.Reset()
-	if _, w.err = w.w.Write(w.prefix); w.err != nil {
+	if _, w.err = w.bw.Write(w.prefix); w.err != nil {
 		return w.err
 	}
 	w.prefix[0] = ','
-	_, w.err = w.w.Write(j)
+	_, w.err = w.bw.Write(j)
 	return w.err
 }
 
@@ -49,3 +71,43 @@ func (w *jsonWriter) Close() error {
 	}
 	return w.err
 }
+
+// jsonlWriter writes each row as a line of JSON.
+type jsonlWriter struct {
+	bw *bufio.Writer
+	e  *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	bw := bufio.NewWriter(w)
+	e := json.NewEncoder(bw)
+	e.SetEscapeHTML(false)
+	return &jsonlWriter{bw: bw, e: e}
+}
+
+func (w *jsonlWriter) Write(v reflect.Value) error {
+	if err := w.e.Encode(addrOf(v)); err != nil {
+		return err
+	}
+	return w.bw.Flush()
+}
+
+func (w *jsonlWriter) WriteBatch(rows reflect.Value) error {
+	for i := range rows.Len() {
+		if err := w.e.Encode(addrOf(rows.Index(i))); err != nil {
+			return err
+		}
+	}
+	return w.bw.Flush()
+}
+
+func (w *jsonlWriter) Close() error { return w.bw.Flush() }
+
+// addrOf returns a pointer to v if it is addressable, which encodes the same
+// as v without copying it, or else v itself.
+func addrOf(v reflect.Value) any {
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	return v.Interface()
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/deprecated"
+	"github.com/parquet-go/parquet-go/encoding"
+)
+
+type parquetWriter struct {
+	w      io.Writer
+	pw     *parquet.Writer
+	schema *parquet.Schema
+	rows   []parquet.Row
+	err    error
+}
+
+func (w *parquetWriter) Write(v reflect.Value) error {
+	if !v.CanAddr() {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		v = p.Elem()
+	}
+	if w.open(v) == nil {
+		if err := w.pw.Write(v.Addr().Interface()); w.err == nil {
+			w.err = err
+		}
+	}
+	return w.err
+}
+
+// WriteBatch deconstructs the rows of a batch into parquet rows, reusing
+// their buffers, and writes them together.
+func (w *parquetWriter) WriteBatch(rows reflect.Value) error {
+	if rows.Len() == 0 || w.open(rows.Index(0)) != nil {
+		return w.err
+	}
+	n := rows.Len()
+	if cap(w.rows) < n {
+		w.rows = append(w.rows[:cap(w.rows)], make([]parquet.Row, n-cap(w.rows))...)
+	}
+	w.rows = w.rows[:n]
+	for i := range n {
+		w.rows[i] = w.schema.Deconstruct(w.rows[i][:0], rows.Index(i).Addr().Interface())
+	}
+	if w.err == nil {
+		_, w.err = w.pw.WriteRows(w.rows)
+	}
+	return w.err
+}
+
+// open starts writing rows like the first, v, on first use.
+func (w *parquetWriter) open(v reflect.Value) error {
+	if w.pw == nil && w.err == nil {
+		if w.schema, w.err = w.schemaOf(v); w.err == nil {
+			w.pw = parquet.NewWriter(w.w, w.schema)
+		}
+	}
+	return w.err
+}
+
+// Close finishes the file. Errors from writing rows were already returned by
+// Write or WriteBatch, so are not returned again.
+func (w *parquetWriter) Close() error {
+	if w.pw == nil || w.err != nil {
+		return nil
+	}
+	w.err = w.pw.Close()
+	return w.err
+}
+
+// schemaOf returns a schema for writing rows like the first, v, restoring the
+// parquet logical types of dates, times, timestamps, and decimals.
+func (w *parquetWriter) schemaOf(v reflect.Value) (*parquet.Schema, error) {
+	node, err := w.nodeOf(v.Type(), v)
+	if err != nil {
+		return nil, err
+	}
+	return parquet.NewSchema("", node), nil
+}
+
+// nodeOf returns the node for values of type t, like v if it is valid.
+func (w *parquetWriter) nodeOf(t reflect.Type, v reflect.Value) (parquet.Node, error) {
+	switch t {
+	case reflect.TypeFor[Date]():
+		return parquet.Date(), nil
+	case reflect.TypeFor[TimeMilliLoc]():
+		return parquet.TimeAdjusted(parquet.Millisecond, false), nil
+	case reflect.TypeFor[TimeMilliUTC]():
+		return parquet.TimeAdjusted(parquet.Millisecond, true), nil
+	case reflect.TypeFor[TimeMicroLoc]():
+		return parquet.TimeAdjusted(parquet.Microsecond, false), nil
+	case reflect.TypeFor[TimeMicroUTC]():
+		return parquet.TimeAdjusted(parquet.Microsecond, true), nil
+	case reflect.TypeFor[TimeNanoLoc]():
+		return parquet.TimeAdjusted(parquet.Nanosecond, false), nil
+	case reflect.TypeFor[TimeNanoUTC]():
+		return parquet.TimeAdjusted(parquet.Nanosecond, true), nil
+	case reflect.TypeFor[StampMilliLoc]():
+		return parquet.TimestampAdjusted(parquet.Millisecond, false), nil
+	case reflect.TypeFor[StampMilliUTC]():
+		return parquet.TimestampAdjusted(parquet.Millisecond, true), nil
+	case reflect.TypeFor[StampMicroLoc]():
+		return parquet.TimestampAdjusted(parquet.Microsecond, false), nil
+	case reflect.TypeFor[StampMicroUTC]():
+		return parquet.TimestampAdjusted(parquet.Microsecond, true), nil
+	case reflect.TypeFor[StampNanoLoc]():
+		return parquet.TimestampAdjusted(parquet.Nanosecond, false), nil
+	case reflect.TypeFor[StampNanoUTC]():
+		return parquet.TimestampAdjusted(parquet.Nanosecond, true), nil
+	case reflect.TypeFor[Decimal]():
+		// decimalField writes the decimals of struct fields.
+		return nil, fmt.Errorf("parquet: cannot write %s in a list or map", t)
+	case reflect.TypeFor[deprecated.Int96]():
+		return parquet.Leaf(parquet.Int96Type), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return parquet.Leaf(parquet.BooleanType), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return parquet.Int(t.Bits()), nil
+	case reflect.Int:
+		return parquet.Int(64), nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return parquet.Uint(t.Bits()), nil
+	case reflect.Uint:
+		return parquet.Uint(64), nil
+	case reflect.Float32:
+		return parquet.Leaf(parquet.FloatType), nil
+	case reflect.Float64:
+		return parquet.Leaf(parquet.DoubleType), nil
+	case reflect.String:
+		return parquet.String(), nil
+	case reflect.Pointer:
+		if v.IsValid() && !v.IsNil() {
+			v = v.Elem()
+		} else {
+			v = reflect.Value{}
+		}
+		elem, err := w.nodeOf(t.Elem(), v)
+		return parquet.Optional(elem), err
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return parquet.Leaf(parquet.ByteArrayType), nil
+		}
+		elem, err := w.nodeOf(t.Elem(), reflect.Value{})
+		return parquet.Repeated(elem), err
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return parquet.Leaf(parquet.FixedLenByteArrayType(t.Len())), nil
+		}
+	case reflect.Map:
+		key, err := w.nodeOf(t.Key(), reflect.Value{})
+		if err != nil {
+			return nil, err
+		}
+		value, err := w.nodeOf(t.Elem(), reflect.Value{})
+		return parquet.Map(key, value), err
+	case reflect.Struct:
+		g := make(orderedGroup, t.NumField())
+		for i := range g {
+			f := t.Field(i)
+			name := reFieldName(f)
+			var fv reflect.Value
+			if v.IsValid() {
+				fv = v.Field(i)
+			}
+			if f.Type == reflect.TypeFor[Decimal]() || f.Type == reflect.TypeFor[*Decimal]() {
+				g[i] = w.decimalField(f.Type, fv, name, i)
+				continue
+			}
+			node, err := w.nodeOf(f.Type, fv)
+			if err != nil {
+				return nil, err
+			}
+			g[i] = &orderedField{Node: node, name: name, index: i}
+		}
+		return g, nil
+	}
+	return nil, fmt.Errorf("parquet: cannot write %s", t)
+}
+
+// orderedGroup is a group whose fields keep the order of the go struct they
+// were derived from, where parquet.Group would sort them by name.
+type orderedGroup []parquet.Field
+
+func (g orderedGroup) ID() int                     { return 0 }
+func (g orderedGroup) String() string              { return g.group().String() }
+func (g orderedGroup) Type() parquet.Type          { return g.group().Type() }
+func (g orderedGroup) Optional() bool              { return false }
+func (g orderedGroup) Repeated() bool              { return false }
+func (g orderedGroup) Required() bool              { return true }
+func (g orderedGroup) Leaf() bool                  { return false }
+func (g orderedGroup) Fields() []parquet.Field     { return g }
+func (g orderedGroup) Encoding() encoding.Encoding { return nil }
+func (g orderedGroup) Compression() compress.Codec { return nil }
+func (g orderedGroup) GoType() reflect.Type        { return g.group().GoType() }
+
+func (g orderedGroup) group() parquet.Group {
+	group := make(parquet.Group, len(g))
+	for _, f := range g {
+		group[f.Name()] = f
+	}
+	return group
+}
+
+type orderedField struct {
+	parquet.Node
+	name    string
+	index   int
+	convert func(reflect.Value) reflect.Value // to the node's storage, if set
+}
+
+func (f *orderedField) Name() string { return f.name }
+
+// decimalPrecision is the most digits a decimal written as 16 bytes can hold.
+const decimalPrecision = 38
+
+// decimalField returns a field writing the decimals of a struct field as
+// 16 byte two's complement numbers. Its scale is that of its value in the
+// first row, v, or 0 if that is nil; other values are rescaled to it if they
+// can be exactly, and otherwise fail the write.
+func (w *parquetWriter) decimalField(t reflect.Type, v reflect.Value, name string, index int) *orderedField {
+	var scale int32
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		scale = v.Interface().(Decimal).Scale
+	}
+	var node parquet.Node = parquet.Decimal(int(scale), decimalPrecision, parquet.FixedLenByteArrayType(16))
+	if t.Kind() == reflect.Pointer {
+		node = parquet.Optional(node)
+	}
+	f := &orderedField{Node: node, name: name, index: index}
+	f.convert = func(v reflect.Value) reflect.Value {
+		optional := v.Kind() == reflect.Pointer
+		if optional {
+			if v.IsNil() {
+				return reflect.Zero(reflect.TypeFor[*[16]byte]())
+			}
+			v = v.Elem()
+		}
+		b, err := decimalBytes(v.Interface().(Decimal), scale)
+		if err != nil && w.err == nil {
+			w.err = fmt.Errorf("parquet: %s: %w", name, err)
+		}
+		if optional {
+			return reflect.ValueOf(b)
+		}
+		return reflect.ValueOf(b).Elem()
+	}
+	return f
+}
+
+// decimalBytes returns d at the given scale as 16 bytes of big-endian two's
+// complement.
+func decimalBytes(d Decimal, scale int32) (*[16]byte, error) {
+	b := new([16]byte)
+	u := new(big.Int)
+	if d.Unscaled != nil {
+		u.Set(d.Unscaled)
+	}
+	if n := scale - d.Scale; n != 0 {
+		pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(max(n, -n))), nil)
+		if n > 0 {
+			u.Mul(u, pow)
+		} else if _, m := u.QuoRem(u, pow, new(big.Int)); m.Sign() != 0 {
+			return b, fmt.Errorf("decimal %s does not fit scale %d", d, scale)
+		}
+	}
+	if u.BitLen() > 127 {
+		return b, fmt.Errorf("decimal %s does not fit %d digits", d, decimalPrecision)
+	}
+	if u.Sign() < 0 {
+		u.Add(u, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+	u.FillBytes(b[:])
+	return b, nil
+}
+
+func (f *orderedField) Value(base reflect.Value) reflect.Value {
+	if base.Kind() == reflect.Pointer {
+		if base.IsNil() {
+			base.Set(reflect.New(base.Type().Elem()))
+		}
+		base = base.Elem()
+	}
+	if f.convert != nil {
+		return f.convert(base.Field(f.index))
+	}
+	return base.Field(f.index)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"encoding"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// tableStyle is how a tableWriter draws a table. Each line is drawn as its
+// left edge, its cells divided by the separator, and its right edge.
+type tableStyle struct {
+	row               [3]string // left edge, separator, and right edge of a row
+	top, rule, bottom [4]string // edges, fill, and separator of lines, drawn if set
+	null              string    // drawn for null cells
+	escape            *strings.Replacer
+	align             bool // mark right aligned columns in the rule
+	fit               bool // truncate cells to fit maxCellWidth and the terminal
+}
+
+var (
+	tableEscape    = strings.NewReplacer("\n", `\n`, "\r", `\r`, "\t", `\t`)
+	markdownEscape = strings.NewReplacer("\n", "<br>", "\r", "", "|", `\|`)
+
+	asciiTable = &tableStyle{
+		row:    [3]string{"", " | ", ""},
+		rule:   [4]string{"", "-", "-+-", ""},
+		null:   "∅",
+		escape: tableEscape,
+		fit:    true,
+	}
+	boxTable = &tableStyle{
+		row:    [3]string{"│ ", " │ ", " │"},
+		top:    [4]string{"┌─", "─", "─┬─", "─┐"},
+		rule:   [4]string{"├─", "─", "─┼─", "─┤"},
+		bottom: [4]string{"└─", "─", "─┴─", "─┘"},
+		null:   "∅",
+		escape: tableEscape,
+		fit:    true,
+	}
+	markdownTable = &tableStyle{
+		row:    [3]string{"| ", " | ", " |"},
+		rule:   [4]string{"| ", "-", " | ", " |"},
+		null:   "*null*",
+		escape: markdownEscape,
+		align:  true,
+	}
+)
+
+const (
+	// tableWindow is how many rows a tableWriter holds to size its columns.
+	// Columns widen for later rows that need it, so far as the style allows.
+	tableWindow = 100
+
+	// maxCellWidth is the widest a cell is drawn when the style fits cells.
+	maxCellWidth = 40
+
+	// minCellWidth is the narrowest a column is truncated to fit the terminal.
+	minCellWidth = 3
+)
+
+// tableWriter writes rows as a table with aligned columns, headed by their
+// parquet names.
+type tableWriter struct {
+	w      *bufio.Writer
+	style  *tableStyle
+	width  int // of the terminal, or 0 if unknown
+	names  []string
+	right  []bool // numeric columns, aligned right
+	widths []int
+	held   [][]string // rows read before the columns are sized
+	drawn  bool
+	err    error
+}
+
+func newTableWriter(w io.Writer, style *tableStyle) *tableWriter {
+	tw := &tableWriter{w: bufio.NewWriter(w), style: style}
+	if style.fit {
+		tw.width = terminalWidth(w)
+	}
+	return tw
+}
+
+// terminalWidth returns the width of w if it is a terminal, or else the
+// width set by $COLUMNS, or 0 if neither is known.
+func terminalWidth(w io.Writer) int {
+	if f, ok := w.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil {
+			return width
+		}
+	}
+	width, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	return width
+}
+
+func (w *tableWriter) Write(v reflect.Value) error {
+	if w.write(v) == nil {
+		w.err = w.w.Flush()
+	}
+	return w.err
+}
+
+func (w *tableWriter) WriteBatch(rows reflect.Value) error {
+	for i := range rows.Len() {
+		if w.write(rows.Index(i)) != nil {
+			return w.err
+		}
+	}
+	w.err = w.w.Flush()
+	return w.err
+}
+
+func (w *tableWriter) write(v reflect.Value) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.names == nil {
+		t := v.Type()
+		if t.Kind() != reflect.Struct {
+			w.err = fmt.Errorf("table: unsupported output %s", t)
+			return w.err
+		}
+		w.names = columnNames(t)
+		w.right = make([]bool, t.NumField())
+		for i := range w.right {
+			w.right[i] = alignRight(t.Field(i).Type)
+		}
+	}
+
+	cells := make([]string, len(w.names))
+	for i := range cells {
+		if cells[i], w.err = w.style.cell(v.Field(i)); w.err != nil {
+			return w.err
+		}
+	}
+	if w.drawn {
+		w.grow(cells)
+		w.line(w.style.row, cells)
+		return w.err
+	}
+	w.held = append(w.held, cells)
+	if len(w.held) == tableWindow {
+		w.draw()
+	}
+	return w.err
+}
+
+// alignRight reports whether cells of t are aligned right: plain numbers, but
+// not values such as dates that are written as text.
+func alignRight(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return isNumeric(t) && !t.Implements(reflect.TypeFor[encoding.TextMarshaler]())
+}
+
+// cell returns the text of v for a cell drawn in style s.
+func (s *tableStyle) cell(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return s.null, nil
+		}
+		v = v.Elem()
+	}
+	text, err := cellText(v)
+	return s.escape.Replace(text), err
+}
+
+// draw sizes the columns to the rows held, then writes the header and them.
+func (w *tableWriter) draw() {
+	w.drawn = true
+	w.widths = make([]int, len(w.names))
+	for i, name := range w.names {
+		w.widths[i] = utf8.RuneCountInString(name)
+	}
+	for _, cells := range w.held {
+		for i, c := range cells {
+			w.widths[i] = max(w.widths[i], utf8.RuneCountInString(c))
+		}
+	}
+	if w.style.align {
+		for i := range w.widths {
+			w.widths[i] = max(w.widths[i], minCellWidth)
+		}
+	}
+	if w.style.fit {
+		w.fit()
+	}
+
+	w.rule(w.style.top)
+	w.line(w.style.row, w.names)
+	w.rule(w.style.rule)
+	for _, cells := range w.held {
+		w.line(w.style.row, cells)
+	}
+	w.held = nil
+}
+
+// fit narrows columns to maxCellWidth, then the widest in turn until the rows
+// fit the terminal or every column is minCellWidth.
+func (w *tableWriter) fit() {
+	for i := range w.widths {
+		w.widths[i] = min(w.widths[i], maxCellWidth)
+	}
+	for w.width != 0 && w.spare() < 0 {
+		widest := 0
+		for i, n := range w.widths {
+			if n > w.widths[widest] {
+				widest = i
+			}
+		}
+		if w.widths[widest] <= minCellWidth {
+			return
+		}
+		w.widths[widest]--
+	}
+}
+
+// grow widens columns for cells of a row read after they were sized, so far
+// as the style fits cells.
+func (w *tableWriter) grow(cells []string) {
+	for i, c := range cells {
+		n := utf8.RuneCountInString(c)
+		if n <= w.widths[i] {
+			continue
+		}
+		if w.style.fit {
+			n = min(n, maxCellWidth)
+			if w.width != 0 {
+				n = min(n, w.widths[i]+max(w.spare(), 0))
+			}
+		}
+		w.widths[i] = max(w.widths[i], n)
+	}
+}
+
+// spare returns how much narrower rows are than the terminal.
+func (w *tableWriter) spare() int {
+	row := w.style.row
+	used := utf8.RuneCountInString(row[0]) + utf8.RuneCountInString(row[2]) +
+		(len(w.widths)-1)*utf8.RuneCountInString(row[1])
+	for _, n := range w.widths {
+		used += n
+	}
+	return w.width - used
+}
+
+// line writes cells padded to their columns, truncating them if the style
+// fits cells.
+func (w *tableWriter) line(edges [3]string, cells []string) {
+	if w.err != nil {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(edges[0])
+	for i, c := range cells {
+		if i > 0 {
+			b.WriteString(edges[1])
+		}
+		b.WriteString(fitCell(c, w.widths[i], w.right[i], w.style.fit))
+	}
+	b.WriteString(edges[2])
+	_, w.err = fmt.Fprintln(w.w, strings.TrimRight(b.String(), " "))
+}
+
+// fitCell pads c to width, aligned right or left, truncating it with an
+// ellipsis if it is wider and truncate is set.
+func fitCell(c string, width int, right, truncate bool) string {
+	n := utf8.RuneCountInString(c)
+	if n > width && truncate {
+		if width < 1 {
+			return ""
+		}
+		c = string([]rune(c)[:width-1]) + "…"
+		n = width
+	}
+	pad := strings.Repeat(" ", max(width-n, 0))
+	if right {
+		return pad + c
+	}
+	return c + pad
+}
+
+// rule writes a line across the table, if the style draws one.
+func (w *tableWriter) rule(parts [4]string) {
+	if parts[1] == "" || w.err != nil {
+		return
+	}
+	fills := make([]string, len(w.widths))
+	for i, n := range w.widths {
+		fills[i] = strings.Repeat(parts[1], n)
+		if w.style.align && w.right[i] {
+			fills[i] = fills[i][:n-1] + ":"
+		}
+	}
+	_, w.err = fmt.Fprintln(w.w, parts[0]+strings.Join(fills, parts[2])+parts[3])
+}
+
+func (w *tableWriter) Close() error {
+	if w.names != nil && w.err == nil {
+		if !w.drawn {
+			w.draw()
+		}
+		w.rule(w.style.bottom)
+	}
+	if err := w.w.Flush(); w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTableEscape(t *testing.T) {
+	type row struct {
+		Name string  `parquet:"name"`
+		Note *string `parquet:"note,optional"`
+	}
+	note := "a|b\tc\nd"
+	rows := reflect.ValueOf([]row{{Name: "x", Note: &note}, {Name: "y|z"}})
+	for _, tt := range []struct {
+		style *tableStyle
+		want  string
+	}{
+		{asciiTable, "name | note\n-----+----------\nx    | a|b\\tc\\nd\ny|z  | ∅\n"},
+		{markdownTable, "| name | note        |\n| ---- | ----------- |\n| x    | a\\|b\tc<br>d |\n| y\\|z | *null*      |\n"},
+	} {
+		var b strings.Builder
+		w := newTableWriter(&b, tt.style)
+		if err := w.WriteBatch(rows); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+		}
+	}
+}